@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// revokeTimeout limits revocation of all tokens of the user on logout, it's best-effort.
+const revokeTimeout = 10 * time.Second
+
+// revokeTokens revokes refresh tokens on Gira side, so that they are not valid after they are deleted
+// from the database. Errors are only logged, tokens are deleted locally anyway.
+func (s *server) revokeTokens(uid int64, tokens []Token) {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+
+	for _, t := range tokens {
+		if t.Token == nil || t.Token.RefreshToken == "" {
+			continue
+		}
+		if err := s.auth.Logout(ctx, t.Token.RefreshToken); err != nil {
+			log.Printf("[uid:%d] ignored token %d revoke error: %v", uid, t.ID, err)
+		}
+	}
+}
+
+// forgetTokenSources drops cached token sources of deleted tokens.
+func (s *server) forgetTokenSources(tokens []Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tokens {
+		delete(s.tokenSources, t.ID)
+	}
+}
+
+func (c *customContext) handleLogout() error {
+	if c.user.CurrentTripCode != "" || c.user.CurrentTripRateAwaiting {
+		return c.Send("Please finish and rate the current trip before logging out.")
+	}
+
+	tokens, err := c.getAccounts()
+	if err != nil {
+		return err
+	}
+	if err := c.s.db.Where("user_id = ?", c.user.ID).Delete(&Token{}).Error; err != nil {
+		return err
+	}
+	c.s.forgetTokenSources(tokens)
+	c.s.revokeTokens(c.user.ID, tokens)
+
+	c.user.State = UserStateNone
+	c.user.ActiveAccount = 0
+	c.user.TripAccount = 0
+	log.Printf("[uid:%d] logged out of %d accounts", c.user.ID, len(tokens))
+
+	return c.Send(
+		"👋 Logged out, Gira login tokens are revoked and deleted. "+
+			"Your settings and favorites are kept, use /login to log in again.",
+		&tele.ReplyMarkup{RemoveKeyboard: true},
+	)
+}
+
+func (c *customContext) handleDeleteAccount() error {
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(
+		tele.Row{{
+			Unique: btnKeyTypeDeleteAccount,
+			Text:   "🗑 Yes, delete all my data",
+		}},
+		tele.Row{{
+			Unique: btnKeyTypeCloseMenuKeepReply,
+			Text:   "Cancel",
+		}},
+	)
+
+	return c.Send(
+		"⚠️ This will delete all data I store about you:\n"+
+			"• your account settings, favorite stations and bikes\n"+
+			"• Gira login tokens\n"+
+			"• station reports and feedback messages\n"+
+			"• riding streaks, badges and stats\n\n"+
+			"Your Gira account and trips in it are not affected. This can't be undone.",
+		rm,
+	)
+}
+
+func (c *customContext) handleDeleteAccountConfirm() error {
+	uid := c.user.ID
+	var deleted []string
+
+	tokens, err := c.getAccounts()
+	if err != nil {
+		return err
+	}
+
+	err = c.s.db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range []struct {
+			name  string
+			model any
+			where string
+		}{
+			{"login tokens", &Token{}, "user_id = ?"},
+			{"station reports", &StationReport{}, "user_id = ?"},
+			{"feedback messages", &Feedback{}, "user_id = ?"},
+			{"ride days", &RideDay{}, "user_id = ?"},
+			{"queued notifications", &QueuedNotification{}, "user_id = ?"},
+		} {
+			res := tx.Where(t.where, uid).Delete(t.model)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				deleted = append(deleted, fmt.Sprintf("%d %s", res.RowsAffected, t.name))
+			}
+		}
+
+		return tx.Delete(&User{}, uid).Error
+	})
+	if err != nil {
+		return err
+	}
+	c.userDeleted = true
+
+	c.s.mu.Lock()
+	if cancel, ok := c.s.activeTripsCancels[uid]; ok {
+		cancel()
+		delete(c.s.activeTripsCancels, uid)
+	}
+	if ll, ok := c.s.liveLocations[uid]; ok {
+		ll.cancel()
+	}
+	c.s.mu.Unlock()
+	c.s.forgetTokenSources(tokens)
+	c.s.revokeTokens(uid, tokens)
+
+	log.Printf("[uid:%d] account deleted: %v", uid, deleted)
+
+	summary := fmt.Sprintf(
+		"%d favorite stations, %d favorite and %d avoided bikes",
+		len(c.user.Favorites), len(c.user.FavoriteBikes), len(c.user.AvoidedBikes),
+	)
+	if len(deleted) > 0 {
+		summary += ", " + strings.Join(deleted, ", ")
+	}
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	return c.Edit(
+		"🗑 Your account is deleted. Removed: account settings and stats, "+summary+".\n\n"+
+			"Thanks for using BetterGiraBot! Send /start if you want to come back.",
+		&tele.ReplyMarkup{},
+	)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/giraauth"
+)
+
+// Users can log in to several Gira accounts, e.g. to manage partner's account too.
+// Token of the first (primary) account has ID equal to the telegram user ID, for compatibility
+// with tokens saved before multiple accounts were supported. Additional accounts get negative IDs,
+// so that they never clash with telegram IDs.
+
+// tokenID returns ID of the token of currently active Gira account.
+func (u *User) tokenID() int64 {
+	if u.ActiveAccount != 0 {
+		return u.ActiveAccount
+	}
+	return u.ID
+}
+
+// migrateTokens fills user IDs of tokens saved before multiple accounts were supported.
+func migrateTokens(db *gorm.DB) error {
+	return db.Model(&Token{}).
+		Where("user_id = 0 OR user_id IS NULL").
+		Update("user_id", gorm.Expr("id")).
+		Error
+}
+
+// saveLoginToken saves the token after successful login, either for primary account or as a new one.
+func (c *customContext) saveLoginToken(dbToken *Token) error {
+	dbToken.UserID = c.user.ID
+	dbToken.ID = c.user.ID
+
+	if c.user.AddingAccount {
+		var minID int64
+		if err := c.s.db.Model(&Token{}).Select("COALESCE(MIN(id), 0)").Where("id < 0").Scan(&minID).Error; err != nil {
+			return err
+		}
+		dbToken.ID = min(minID, 0) - 1
+		c.user.AddingAccount = false
+	}
+
+	if err := c.s.db.Save(dbToken).Error; err != nil {
+		return err
+	}
+
+	c.user.ActiveAccount = 0
+	if dbToken.ID != c.user.ID {
+		c.user.ActiveAccount = dbToken.ID
+	}
+	// the rest of the handler should use the new account
+	c.gira = c.s.newGiraClient(c.user.tokenID())
+	return nil
+}
+
+func (c *customContext) getAccounts() ([]Token, error) {
+	var tokens []Token
+	// primary account goes first, then additional ones in order they were added
+	err := c.s.db.Where("user_id = ?", c.user.ID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// getAccountName returns Gira client name of the account for display, falling back to its number.
+func (c *customContext) getAccountName(ctx context.Context, tokenID int64, num int) string {
+	info, err := c.s.newGiraClient(tokenID).GetClientInfo(ctx)
+	if gira.IsAuthError(err) {
+		log.Printf("[uid:%d] account %d auth error: %v", c.user.ID, tokenID, err)
+		return fmt.Sprintf("Account %d (⚠️ login expired)", num)
+	}
+	if err != nil {
+		log.Printf("[uid:%d] ignored account %d info error: %v", c.user.ID, tokenID, err)
+		return fmt.Sprintf("Account %d", num)
+	}
+	return info.Name
+}
+
+// getProfile returns Gira auth profile of the active account with fields, see giraauth.UserField.
+func (c *customContext) getProfile(fields giraauth.UserField) (giraauth.User, error) {
+	tok, err := c.getTokenSource().Token()
+	if err != nil {
+		return giraauth.User{}, err
+	}
+	return c.s.auth.User(c, tok.AccessToken, fields)
+}
+
+func (c *customContext) handleAccounts() error {
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	text, rm, err := c.getAccountsMessage()
+	if err != nil {
+		return err
+	}
+	return c.Send(text, rm)
+}
+
+func (c *customContext) getAccountsMessage() (string, *tele.ReplyMarkup, error) {
+	tokens, err := c.getAccounts()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	text := "👥 Your Gira accounts:\n"
+	var rows []tele.Row
+	for i, t := range tokens {
+		name := c.getAccountName(ctx, t.ID, i+1)
+		id := strconv.FormatInt(t.ID, 10)
+
+		if t.ID == c.user.tokenID() {
+			text += fmt.Sprintf("• %s ✅\n", name)
+		} else {
+			text += fmt.Sprintf("• %s\n", name)
+			rows = append(rows, tele.Row{{
+				Unique: btnKeyTypeSwitchAccount,
+				Text:   "🔀 Switch to " + name,
+				Data:   id,
+			}})
+		}
+
+		if t.ID != c.user.ID {
+			rows = append(rows, tele.Row{{
+				Unique: btnKeyTypeRemoveAccount,
+				Text:   "🗑 Remove " + name,
+				Data:   id,
+			}})
+		}
+	}
+
+	rows = append(rows,
+		tele.Row{{Unique: btnKeyTypeAddAccount, Text: "➕ Add account"}},
+		tele.Row{{Unique: btnKeyTypeCloseMenuKeepReply, Text: "Close"}},
+	)
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(rows...)
+
+	return text, rm, nil
+}
+
+// tripTokenID returns ID of the token of Gira account the current trip is on.
+// It can differ from the active account, if user switched accounts during the trip.
+func (u *User) tripTokenID() int64 {
+	if u.TripAccount != 0 {
+		return u.TripAccount
+	}
+	return u.ID
+}
+
+// tripLookupTokenID returns ID of the token to look for the active trip with: the account of the watched trip,
+// if it's not the active one, as only one trip is watched at a time.
+func (u *User) tripLookupTokenID() int64 {
+	if u.hasTripOnOtherAccount() {
+		return u.tripTokenID()
+	}
+	return u.tokenID()
+}
+
+// setTripAccount records that the current trip is on account of tokenID.
+func (u *User) setTripAccount(tokenID int64) {
+	if tokenID == u.ID {
+		tokenID = 0
+	}
+	u.TripAccount = tokenID
+}
+
+// hasTripOnOtherAccount returns whether the bot is busy with a trip on account other than the active one.
+func (u *User) hasTripOnOtherAccount() bool {
+	return u.CurrentTripMessageID != "" && u.tripTokenID() != u.tokenID()
+}
+
+// useTripAccount makes the rest of the handler use the account of the current trip,
+// it's used by trip callbacks, which can be pressed after switching accounts.
+func (c *customContext) useTripAccount() {
+	if c.user.tripTokenID() != c.user.tokenID() {
+		c.gira = c.s.newGiraClient(c.user.tripTokenID())
+	}
+}
+
+// checkCanRemoveAccount returns false and tells user about it if trip state is tied to the account.
+func (c *customContext) checkCanRemoveAccount(id int64) (bool, error) {
+	if id != c.user.tripTokenID() || (c.user.CurrentTripCode == "" && !c.user.CurrentTripRateAwaiting) {
+		return true, nil
+	}
+	return false, c.Respond(&tele.CallbackResponse{
+		Text:      "Please finish and rate the current trip on this account before removing it.",
+		ShowAlert: true,
+	})
+}
+
+func (c *customContext) handleSwitchAccount() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	id, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var tok Token
+	if err := c.s.db.Where("id = ? AND user_id = ?", id, c.user.ID).First(&tok).Error; err != nil {
+		return err
+	}
+
+	c.user.ActiveAccount = 0
+	if tok.ID != c.user.ID {
+		c.user.ActiveAccount = tok.ID
+	}
+	c.gira = c.s.newGiraClient(c.user.tokenID())
+	log.Printf("[uid:%d] switched to account %d", c.user.ID, tok.ID)
+
+	return c.updateAccountsMessage("Switched")
+}
+
+func (c *customContext) handleRemoveAccount() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	id, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil {
+		return err
+	}
+	if id == c.user.ID {
+		return fmt.Errorf("can't remove primary account")
+	}
+	if ok, err := c.checkCanRemoveAccount(id); !ok {
+		return err
+	}
+
+	if id == c.user.tokenID() {
+		c.user.ActiveAccount = 0
+		c.gira = c.s.newGiraClient(c.user.tokenID())
+	}
+
+	var tok Token
+	if err := c.s.db.Where("id = ? AND user_id = ?", id, c.user.ID).First(&tok).Error; err != nil {
+		return err
+	}
+	if err := c.s.db.Delete(&tok).Error; err != nil {
+		return err
+	}
+	c.s.forgetTokenSources([]Token{tok})
+	c.s.revokeTokens(c.user.ID, []Token{tok})
+
+	log.Printf("[uid:%d] removed account %d", c.user.ID, id)
+
+	return c.updateAccountsMessage("Removed")
+}
+
+func (c *customContext) updateAccountsMessage(response string) error {
+	text, rm, err := c.getAccountsMessage()
+	if err != nil {
+		return err
+	}
+	if err := c.Respond(&tele.CallbackResponse{Text: response}); err != nil {
+		return err
+	}
+	return c.Edit(text, rm)
+}
+
+func (c *customContext) handleAddAccount() error {
+	c.user.AddingAccount = true
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	return c.sendAddAccountPrompt()
+}
+
+// sendAddAccountPrompt asks for credentials of additional account, with a button to cancel adding it.
+func (c *customContext) sendAddAccountPrompt() error {
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(tele.Row{{Unique: btnKeyTypeAddAccountCancel, Text: "❌ Cancel"}})
+	if err := c.Send("➕ Adding another Gira account.\n"+messageLogin, rm); err != nil {
+		return err
+	}
+
+	c.user.State = UserStateWaitingForEmail
+	return nil
+}
+
+func (c *customContext) handleAddAccountCancel() error {
+	if c.user.AddingAccount {
+		c.user.AddingAccount = false
+		c.user.State = UserStateLoggedIn
+	}
+	return c.Delete()
+}
+
+// handleLoginCommand is /login, which logs in to the primary account. If user is in the middle
+// of adding another account, e.g. to change the email after wrong credentials, that flow is restarted,
+// so that the new account doesn't replace the primary one.
+func (c *customContext) handleLoginCommand() error {
+	if c.user.AddingAccount && (c.user.State == UserStateWaitingForEmail || c.user.State == UserStateWaitingForPassword) {
+		return c.sendAddAccountPrompt()
+	}
+	c.user.AddingAccount = false
+	return c.handleLogin()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// badge is an achievement awarded for trip milestones.
+type badge struct {
+	ID          string
+	Emoji       string
+	Name        string
+	Description string
+
+	// earned checks if the badge is earned after the trip. User stats already include the trip.
+	earned func(u *User, trip gira.Trip) bool
+}
+
+func (b badge) String() string {
+	return fmt.Sprintf("%s %s – %s", b.Emoji, b.Name, b.Description)
+}
+
+// badges are in the order they are shown, new ones should be appended to keep it stable.
+var badges = []badge{
+	{
+		ID: "first_trip", Emoji: "🐣", Name: "First ride", Description: "finish your first trip",
+		earned: func(u *User, _ gira.Trip) bool { return u.FinishedTrips >= 1 },
+	},
+	{
+		ID: "trips_10", Emoji: "🚲", Name: "Regular", Description: "finish 10 trips",
+		earned: func(u *User, _ gira.Trip) bool { return u.FinishedTrips >= 10 },
+	},
+	{
+		ID: "trips_100", Emoji: "💯", Name: "Centurion", Description: "finish 100 trips",
+		earned: func(u *User, _ gira.Trip) bool { return u.FinishedTrips >= 100 },
+	},
+	{
+		ID: "stations_10", Emoji: "🗺", Name: "Explorer", Description: "visit 10 different stations",
+		earned: func(u *User, _ gira.Trip) bool { return len(u.VisitedStations) >= 10 },
+	},
+	{
+		ID: "distance_100km", Emoji: "🛣", Name: "Long hauler", Description: "ride 100km in total",
+		earned: func(u *User, _ gira.Trip) bool { return u.TotalDistance >= 100 },
+	},
+	{
+		ID: "night_rider", Emoji: "🌙", Name: "Night rider", Description: "start a trip between midnight and 5am",
+		earned: func(_ *User, trip gira.Trip) bool {
+			return !trip.StartDate.IsZero() && trip.StartDate.In(lisbonTZ).Hour() < 5
+		},
+	},
+}
+
+// awardBadges records trip stations and checks all badges against the finished trip.
+// It returns a summary line with newly earned badges for the trip message.
+// User trip counter and totals should already be updated with this trip.
+func (c *customContext) awardBadges(trip gira.Trip) (string, error) {
+	var earned []string
+	// called outside of handler (from watchActiveTrip), so the user is reloaded and updated in a transaction,
+	// badges are not overwritten by handlers, see userBackgroundFields
+	err := c.s.db.Transaction(func(tx *gorm.DB) error {
+		var u User
+		if err := tx.First(&u, c.user.ID).Error; err != nil {
+			return err
+		}
+
+		if u.VisitedStations == nil {
+			u.VisitedStations = map[gira.StationCode]int{}
+		}
+		for _, code := range []gira.StationCode{trip.StartLocation, trip.EndLocation} {
+			if code != "" {
+				u.VisitedStations[code]++
+			}
+		}
+
+		if u.Badges == nil {
+			u.Badges = map[string]time.Time{}
+		}
+		for _, b := range badges {
+			if _, ok := u.Badges[b.ID]; ok {
+				continue
+			}
+			if b.earned(&u, trip) {
+				u.Badges[b.ID] = time.Now()
+				earned = append(earned, "🏅 New badge: "+b.String())
+			}
+		}
+
+		if err := tx.Model(&u).Select("VisitedStations", "Badges").Updates(&u).Error; err != nil {
+			return err
+		}
+		c.user.VisitedStations = u.VisitedStations
+		c.user.Badges = u.Badges
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(earned) == 0 {
+		return "", nil
+	}
+	return strings.Join(earned, "\n") + "\n", nil
+}
+
+// getBadgesSummary returns earned badges for /stats.
+func (c *customContext) getBadgesSummary() string {
+	var earned []string
+	for _, b := range badges {
+		if _, ok := c.user.Badges[b.ID]; ok {
+			earned = append(earned, b.Emoji+" "+b.Name)
+		}
+	}
+	if len(earned) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🏅 Badges (%d/%d): %s\n", len(earned), len(badges), strings.Join(earned, ", "))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+func TestAwardBadgesNotOverwritten(t *testing.T) {
+	s := newTestServer(t, 1)
+
+	// handler loaded the user before the trip finished, and saves it after
+	handlerUser := loadTestUser(t, s, 1)
+	handlerOrig := handlerUser
+
+	watcherUser := loadTestUser(t, s, 1)
+	if err := s.db.Model(&watcherUser).UpdateColumn("finished_trips", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	c := &customContext{ctx: context.Background(), s: s, user: &watcherUser}
+	line, err := c.awardBadges(gira.Trip{StartLocation: "sc1", EndLocation: "sc2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line == "" {
+		t.Error("first trip badge was not awarded")
+	}
+
+	if err := s.saveUser(&handlerUser, &handlerOrig); err != nil {
+		t.Fatal(err)
+	}
+
+	u := loadTestUser(t, s, 1)
+	if _, ok := u.Badges["first_trip"]; !ok {
+		t.Errorf("badges after handler save = %v, want first_trip", u.Badges)
+	}
+	if len(u.VisitedStations) != 2 || u.FinishedTrips != 1 {
+		t.Errorf("after handler save VisitedStations = %v, FinishedTrips = %d", u.VisitedStations, u.FinishedTrips)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// Commute report is a scheduled message with bike availability at chosen favorite stations,
+// so that users know before leaving home if there are bikes to ride.
+
+// commuteTimeOptions are report times in minutes after midnight in Lisbon, 0 is off.
+var commuteTimeOptions = []int{0, 7*60 + 30, 8 * 60, 8*60 + 30, 9 * 60}
+
+const (
+	// commuteMaxStations is the maximum number of stations in commute report.
+	commuteMaxStations = 2
+	// commuteReportTTL is how long the report is relevant, if it's held back by quiet hours.
+	commuteReportTTL = 30 * time.Minute
+
+	commuteKeyTime     = "time"
+	commuteKeyWeekends = "weekends"
+	commuteKeyStation  = "station"
+)
+
+func formatCommuteTime(minutes int) string {
+	if minutes == 0 {
+		return "Off"
+	}
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// isCommuteDay returns whether report should be sent on the day of t.
+func (s UserSettings) isCommuteDay(t time.Time) bool {
+	wd := t.In(lisbonTZ).Weekday()
+	return s.CommuteWeekends || (wd != time.Saturday && wd != time.Sunday)
+}
+
+func (c *customContext) handleCommute() error {
+	text, rm, err := c.getCommuteMessage()
+	if err != nil {
+		return err
+	}
+	return c.Send(text, rm)
+}
+
+func (c *customContext) getCommuteMessage() (string, *tele.ReplyMarkup, error) {
+	settings := c.user.Settings
+
+	var timeRow tele.Row
+	for _, o := range commuteTimeOptions {
+		text := formatCommuteTime(o)
+		if o == settings.CommuteTime {
+			text = "• " + text + " •"
+		}
+		timeRow = append(timeRow, tele.Btn{
+			Unique: btnKeyTypeCommute,
+			Text:   text,
+			Data:   fmt.Sprintf("%s|%d", commuteKeyTime, o),
+		})
+	}
+
+	weekends := 1
+	if settings.CommuteWeekends {
+		weekends = 0
+	}
+	rows := []tele.Row{
+		timeRow,
+		{{
+			Unique: btnKeyTypeCommute,
+			Text:   "📅 Weekends too: " + onOff(settings.CommuteWeekends),
+			Data:   fmt.Sprintf("%s|%d", commuteKeyWeekends, weekends),
+		}},
+	}
+
+	// favorites and stations in report, which might be not favorite anymore
+	serials := slices.Collect(maps.Keys(c.user.Favorites))
+	for _, serial := range c.user.CommuteStations {
+		if !slices.Contains(serials, serial) {
+			serials = append(serials, serial)
+		}
+	}
+
+	var stations []gira.Station
+	for _, serial := range serials {
+		s, err := c.gira.GetStationCached(c, serial)
+		if err != nil {
+			return "", nil, err
+		}
+		stations = append(stations, s)
+	}
+	slices.SortFunc(stations, func(a, b gira.Station) int {
+		return strings.Compare(a.Number(), b.Number())
+	})
+
+	for _, s := range stations {
+		text := s.Number()
+		if name := c.user.Favorites[s.Serial]; name != "" {
+			text = fmt.Sprintf("[%s] %s", favButtonLabel(name), text)
+		}
+		if slices.Contains(c.user.CommuteStations, s.Serial) {
+			text = "✅ " + text
+		}
+		rows = append(rows, tele.Row{{
+			Unique: btnKeyTypeCommute,
+			Text:   text,
+			Data:   fmt.Sprintf("%s|%s", commuteKeyStation, s.Serial),
+		}})
+	}
+	rows = append(rows, tele.Row{{Unique: btnKeyTypeCloseMenuKeepReply, Text: "Close"}})
+
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(rows...)
+
+	days := "weekdays only"
+	if settings.CommuteWeekends {
+		days = "every day"
+	}
+	text := fmt.Sprintf(
+		"🕗 Commute report\n\n"+
+			"I can message you bike availability at up to %d stations every morning, "+
+			"so you know whether to walk to the metro instead.\n\n"+
+			"Report time: %s, %s\n",
+		commuteMaxStations,
+		formatCommuteTime(settings.CommuteTime),
+		days,
+	)
+	if len(stations) == 0 {
+		text += "\nAdd some favorite stations first, then pick them here."
+	} else {
+		text += "\nTap favorite stations below to include them in the report."
+	}
+	return text, rm, nil
+}
+
+func (c *customContext) handleCommuteSetting() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	key, value, _ := strings.Cut(cb.Data, "|")
+	switch key {
+	case commuteKeyTime:
+		minutes, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(commuteTimeOptions, minutes) {
+			return fmt.Errorf("invalid commute time: %d", minutes)
+		}
+		c.user.Settings.CommuteTime = minutes
+	case commuteKeyWeekends:
+		c.user.Settings.CommuteWeekends = value == "1"
+	case commuteKeyStation:
+		serial := gira.StationSerial(value)
+		if i := slices.Index(c.user.CommuteStations, serial); i != -1 {
+			c.user.CommuteStations = slices.Delete(c.user.CommuteStations, i, i+1)
+			break
+		}
+		if len(c.user.CommuteStations) >= commuteMaxStations {
+			return c.Respond(&tele.CallbackResponse{
+				Text:      fmt.Sprintf("You can pick up to %d stations, remove one first.", commuteMaxStations),
+				ShowAlert: true,
+			})
+		}
+		c.user.CommuteStations = append(c.user.CommuteStations, serial)
+	default:
+		return fmt.Errorf("unknown commute setting: %q", key)
+	}
+
+	if err := c.Respond(&tele.CallbackResponse{Text: "Saved"}); err != nil {
+		return err
+	}
+
+	text, rm, err := c.getCommuteMessage()
+	if err != nil {
+		return err
+	}
+	err = c.Edit(text, rm)
+	if errors.Is(err, tele.ErrSameMessageContent) {
+		return nil
+	}
+	return err
+}
+
+// commuteReporter sends commute reports to users at their chosen time.
+func (s *server) commuteReporter() {
+	for {
+		// wake up at the start of each minute
+		time.Sleep(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+
+		now := time.Now().In(lisbonTZ)
+		minutes := now.Hour()*60 + now.Minute()
+		if minutes == 0 {
+			// 0 is off, not midnight
+			continue
+		}
+
+		var users []User
+		if err := s.db.Where("setting_commute_time = ?", minutes).Find(&users).Error; err != nil {
+			log.Println("commute reporter: error getting users:", err)
+			continue
+		}
+
+		for _, u := range users {
+			if len(u.CommuteStations) == 0 || !u.Settings.isCommuteDay(now) {
+				continue
+			}
+			go func(u User) {
+				if err := s.sendCommuteReport(&u); err != nil {
+					log.Printf("[uid:%d] commute report error: %v", u.ID, err)
+				}
+			}(u)
+		}
+	}
+}
+
+func (s *server) sendCommuteReport(u *User) error {
+	c, cancel := s.newCustomContext(s.bot.NewContext(tele.Update{}), u)
+	defer cancel()
+
+	var stations []gira.Station
+	for _, serial := range u.CommuteStations {
+		st, err := c.gira.GetStationCached(c, serial)
+		if err != nil {
+			return err
+		}
+		stations = append(stations, st)
+	}
+
+	text, rm, err := c.getStationListMessage(stations, c.getStationsDocks(stations), nil)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[uid:%d] sending commute report for %v", u.ID, u.CommuteStations)
+	return s.sendNotification(u, notification{
+		Text:      "🕗 Good morning! Bikes at your commute stations:\n" + text,
+		ParseMode: tele.ModeMarkdown,
+		Markup:    rm,
+		ExpiresAt: time.Now().Add(commuteReportTTL),
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	// donationPayload is the invoice payload for donations, to tell them apart from other payments.
+	donationPayload = "donation"
+	// currencyStars is the currency code of Telegram Stars, provider token is not needed for it.
+	currencyStars = "XTR"
+)
+
+// donationAmounts are amounts of Telegram Stars offered for donation.
+var donationAmounts = []int{50, 100, 250, 500}
+
+func (c *customContext) handleDonate() error {
+	return c.sendDonateMessage()
+}
+
+// sendDonateMessage sends donation prompt with buttons for each amount.
+func (c *customContext) sendDonateMessage() error {
+	var row tele.Row
+	for _, amount := range donationAmounts {
+		row = append(row, tele.Btn{
+			Unique: btnKeyTypeDonate,
+			Text:   fmt.Sprintf("⭐️ %d", amount),
+			Data:   strconv.Itoa(amount),
+		})
+	}
+
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(row)
+
+	text := messageDonate
+	if c.user.DonationsCount > 0 {
+		text += fmt.Sprintf("\n💛 You've already donated %d ⭐️, thank you!", c.user.DonatedStars)
+	}
+	return c.Send(text, tele.ModeMarkdown, tele.NoPreview, rm)
+}
+
+func (c *customContext) handleDonateAmount() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	amount, err := strconv.Atoi(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+
+	return c.Send(&tele.Invoice{
+		Title:       "Support BetterGiraBot",
+		Description: "Donation to keep the bot running and improving. Thank you!",
+		Payload:     donationPayload,
+		Currency:    currencyStars,
+		Prices:      []tele.Price{{Label: "Donation", Amount: amount}},
+	})
+}
+
+// handleCheckout confirms pre-checkout queries, it's required by Telegram to complete the payment.
+func (c *customContext) handleCheckout() error {
+	q := c.PreCheckoutQuery()
+	if q.Payload != donationPayload || q.Currency != currencyStars {
+		log.Printf("[uid:%d] unexpected checkout: %+v", c.user.ID, q)
+		return c.Accept("Unknown payment, please try again via /donate")
+	}
+	return c.Accept()
+}
+
+func (c *customContext) handlePayment() error {
+	p := c.Message().Payment
+	log.Printf("[uid:%d] received payment: %+v", c.user.ID, p)
+
+	if p.Payload != donationPayload {
+		return nil
+	}
+
+	c.user.DonatedStars += p.Total
+	c.user.DonationsCount++
+	c.user.LastDonationAt = time.Now()
+
+	if _, err := c.Bot().Send(tele.ChatID(*adminID), fmt.Sprintf(
+		"💛 Donation of %d %s from %d (@%s), total %d, charge %s",
+		p.Total, p.Currency, c.user.ID, c.user.TGUsername, c.user.DonatedStars, p.TelegramChargeID,
+	)); err != nil {
+		log.Printf("[uid:%d] ignored admin donation notify error: %v", c.user.ID, err)
+	}
+
+	return c.Send("🥰 Thank you so much for your support! It means a lot.")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/giraauth"
+)
+
+const (
+	exportPageSize = 50
+	// exportMaxTrips limits the number of trips fetched, just in case API never returns a short page.
+	exportMaxTrips = 5000
+)
+
+// exportTrip is a trip as written to the export file.
+type exportTrip struct {
+	Code         gira.TripCode `json:"code"`
+	StartDate    time.Time     `json:"start_date"`
+	EndDate      time.Time     `json:"end_date"`
+	DurationSec  int           `json:"duration_sec"`
+	Bike         string        `json:"bike"`
+	StartStation string        `json:"start_station"`
+	EndStation   string        `json:"end_station"`
+	Cost         float64       `json:"cost"`
+	PointsEarned int           `json:"points_earned"`
+	PointsSpent  int           `json:"points_spent"`
+	Rating       int           `json:"rating"`
+}
+
+func (c *customContext) handleExport() error {
+	format := "csv"
+	var month time.Time
+	for _, arg := range strings.Fields(strings.ToLower(c.Message().Payload)) {
+		switch arg {
+		case "csv", "json":
+			format = arg
+		default:
+			m, err := time.ParseInLocation("2006-01", arg, lisbonTZ)
+			if err != nil {
+				return c.Send("Unknown argument, use e.g. `/export csv`, `/export json 2024-05`", tele.ModeMarkdown)
+			}
+			month = m
+		}
+	}
+
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	trips, err := c.getExportTrips(month)
+	if err != nil {
+		return err
+	}
+
+	if len(trips) == 0 {
+		if !month.IsZero() {
+			return c.Send("You don't have any trips in " + month.Format("January 2006"))
+		}
+		return c.Send("You don't have any trips yet")
+	}
+
+	var data []byte
+	switch format {
+	case "csv":
+		data, err = exportTripsCSV(trips)
+	case "json":
+		data, err = json.MarshalIndent(trips, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	// with several accounts, it's nice to know which one the export is of
+	caption := fmt.Sprintf("Exported %d trips", len(trips))
+	if profile, err := c.getProfile(giraauth.UserName | giraauth.UserEmail); err != nil {
+		log.Printf("[uid:%d] ignored profile error: %v", c.user.ID, err)
+	} else if profile.Email != "" {
+		caption += fmt.Sprintf(" of %s (%s)", cmp.Or(profile.Name, "Gira account"), profile.Email)
+	}
+
+	return c.Send(&tele.Document{
+		File:     tele.FromReader(bytes.NewReader(data)),
+		FileName: fmt.Sprintf("gira-trips-%s.%s", time.Now().In(lisbonTZ).Format("2006-01-02"), format),
+		Caption:  caption,
+	})
+}
+
+// getExportTrips returns user trips started in month, or all of them if month is zero, newest first.
+func (c *customContext) getExportTrips(month time.Time) ([]exportTrip, error) {
+	var trips []gira.Trip
+	if month.IsZero() {
+		for t, err := range gira.IterTripHistory(c, c.gira, exportPageSize) {
+			if err != nil {
+				return nil, err
+			}
+			if len(trips) >= exportMaxTrips {
+				break
+			}
+			trips = append(trips, t)
+		}
+	} else {
+		var err error
+		trips, err = gira.TripsBetween(c, c.gira, month, month.AddDate(0, 1, 0), exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]exportTrip, 0, len(trips))
+	for _, t := range trips {
+		res = append(res, exportTrip{
+			Code:         t.Code,
+			StartDate:    t.StartDate.In(lisbonTZ),
+			EndDate:      t.EndDate.In(lisbonTZ),
+			DurationSec:  int(t.EndDate.Sub(t.StartDate).Seconds()),
+			Bike:         t.BikeName,
+			StartStation: t.StartLocationName,
+			EndStation:   t.EndLocationName,
+			Cost:         t.Cost.Euros(),
+			PointsEarned: t.TotalBonus,
+			PointsSpent:  t.CostBonus,
+			Rating:       t.Rating,
+		})
+	}
+	return res, nil
+}
+
+func exportTripsCSV(trips []exportTrip) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write([]string{
+		"code", "start_date", "end_date", "duration_sec", "bike", "start_station", "end_station",
+		"cost", "points_earned", "points_spent", "rating",
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, t := range trips {
+		if err := w.Write([]string{
+			string(t.Code),
+			t.StartDate.Format(time.RFC3339),
+			t.EndDate.Format(time.RFC3339),
+			strconv.Itoa(t.DurationSec),
+			t.Bike,
+			t.StartStation,
+			t.EndStation,
+			strconv.FormatFloat(t.Cost, 'f', 2, 64),
+			strconv.Itoa(t.PointsEarned),
+			strconv.Itoa(t.PointsSpent),
+			strconv.Itoa(t.Rating),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
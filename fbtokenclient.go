@@ -1,78 +1,52 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"log/slog"
 	"net/http"
-	"slices"
+	"os"
+	"strings"
 
-	"github.com/ilyaluk/girabot/internal/tokenserver"
 	"golang.org/x/oauth2"
-)
-
-// fbTokenTransport is a custom http.RoundTripper
-// that adds a Firebase token to request headers.
-type fbTokenTransport struct {
-	Base http.RoundTripper
-
-	tokenSource oauth2.TokenSource
-}
-
-func (t *fbTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Thanks to golang.org/x/oauth2 lib for Transport implementation
-
-	reqBodyClosed := false
-	if req.Body != nil {
-		defer func() {
-			if !reqBodyClosed {
-				req.Body.Close()
-			}
-		}()
-	}
-
-	tok, err := t.tokenSource.Token()
-	if err != nil {
-		return nil, err
-	}
 
-	token, err := tokenserver.GetEncrypted(req.Context(), tok.AccessToken)
-	if err != nil {
-		return nil, err
-	}
-
-	req2 := cloneRequest(req) // per RoundTripper contract
-	req2.Header.Set("x-firebase-token", token)
+	"github.com/ilyaluk/girabot/internal/tokenserver"
+)
 
-	// req.Body is assumed to be closed by the base RoundTripper.
-	reqBodyClosed = true
+var (
+	useFbToken = flag.Bool("firebase-token", false, "add Firebase token from the token exchange server to Gira API requests")
+	tokenURLs  = flag.String("token-url", "http://localhost:8080", "token exchange server base urls, comma-separated, the ones after first are used for failover")
+	// staticFbToken lets developers run the bot against the proxy without the token exchange server
+	staticFbToken = flag.String("firebase-static-token", os.Getenv("FIREBASE_TOKEN"),
+		"use this Firebase token for all requests instead of the token exchange server, for development, implies -firebase-token")
+)
 
-	resp, err := t.Base.RoundTrip(req2)
-	if err != nil {
-		return resp, err
+// newTokenServerClient returns client of -token-url exchange servers, which persists fetched tokens, see fbtokens.go.
+func (s *server) newTokenServerClient(l *slog.Logger) *tokenserver.Client {
+	urls := strings.Split(*tokenURLs, ",")
+	opts := []tokenserver.Option{
+		tokenserver.WithFailover(urls[1:]...),
+		tokenserver.WithLogger(l),
+		tokenserver.WithOnFetch(s.saveFbToken),
 	}
-
-	if resp.StatusCode == 401 {
-		log.Printf("firebasetoken: got 401: '%s', token was '%s'", resp.Header.Get("www-authenticate"), token)
+	if *staticFbToken != "" {
+		opts = append(opts, tokenserver.WithStaticToken(*staticFbToken))
 	}
-
-	return resp, nil
+	return tokenserver.NewClient(urls[0], opts...)
 }
 
-// cloneRequest returns a clone of the provided *http.Request.
-// The clone is a shallow copy of the struct and its Header map.
-func cloneRequest(r *http.Request) *http.Request {
-	// shallow copy of the struct
-	r2 := new(http.Request)
-	*r2 = *r
-	// deep copy of the Header
-	r2.Header = make(http.Header, len(r.Header))
-	for k, s := range r.Header {
-		r2.Header[k] = slices.Clone(s)
-	}
-	return r2
+// fbTokenEnabled returns whether Firebase token is added to Gira API requests.
+func fbTokenEnabled() bool {
+	return *useFbToken || *staticFbToken != ""
 }
 
-func newFbTokenClient(base http.RoundTripper, tokenSource oauth2.TokenSource) *http.Client {
+// newFbTokenClient returns client for Gira API requests. Firebase token is added only with -firebase-token.
+func (s *server) newFbTokenClient(base http.RoundTripper, tokenSource oauth2.TokenSource) *http.Client {
+	if !fbTokenEnabled() {
+		return &http.Client{
+			Transport: base,
+		}
+	}
 	return &http.Client{
-		Transport: base,
+		Transport: s.tokenServer.Transport(base, tokenSource),
 	}
 }
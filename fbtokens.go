@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira/firebasetoken"
+)
+
+const (
+	// fbTokenPrefetchInterval and fbTokenPrefetchWindow are how often cached Firebase token is checked during
+	// active trip, and how long before expiry it's refreshed. Token server keeps returning the same token until
+	// it has less than a couple of minutes left, so the window is longer than that.
+	fbTokenPrefetchInterval = time.Minute
+	fbTokenPrefetchWindow   = 3 * time.Minute
+)
+
+// saveFbToken persists Firebase token fetched for source for loadFbTokens.
+// Only tokens of accounts, i.e. of getTokenSource sources, are persisted.
+func (s *server) saveFbToken(source oauth2.TokenSource, fbToken string) {
+	ts, ok := source.(*tokenSource)
+	if !ok {
+		return
+	}
+
+	exp, err := firebasetoken.GetExpiration(fbToken)
+	if err != nil {
+		log.Printf("[token:%d] ignored firebase token expiration error: %v", ts.tokenID, err)
+		return
+	}
+	err = s.db.Model(&Token{ID: ts.tokenID}).Updates(Token{FbToken: fbToken, FbTokenExpiresAt: exp}).Error
+	if err != nil {
+		log.Printf("[token:%d] ignored firebase token save error: %v", ts.tokenID, err)
+	}
+}
+
+// loadFbTokens restores persisted Firebase tokens which are still valid into the token server client.
+func (s *server) loadFbTokens() error {
+	if !*useFbToken {
+		return nil
+	}
+
+	var tokens []Token
+	if err := s.db.Where("fb_token_expires_at > ?", time.Now()).Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, tok := range tokens {
+		if tok.Token == nil {
+			continue
+		}
+		if err := s.tokenServer.Restore(tok.Token.AccessToken, tok.FbToken); err != nil {
+			log.Printf("[token:%d] ignored firebase token load error: %v", tok.ID, err)
+		}
+	}
+	log.Printf("loaded %d firebase tokens", len(tokens))
+	return nil
+}
+
+// prefetchFbToken keeps Firebase token of tokenID fresh until ctx is done, so that e.g. unlock during
+// active trip doesn't wait for the token server. It's a no-op without -firebase-token, or with static token.
+func (s *server) prefetchFbToken(ctx context.Context, tokenID int64) {
+	if !*useFbToken || *staticFbToken != "" {
+		return
+	}
+
+	t := s.tokenServer.Transport(nil, s.getTokenSource(tokenID))
+	ticker := time.NewTicker(fbTokenPrefetchInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Prefetch(ctx, fbTokenPrefetchWindow); err != nil && ctx.Err() == nil {
+			log.Printf("[token:%d] ignored firebase token prefetch error: %v", tokenID, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
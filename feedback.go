@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// Feedback is a message from user to the bot author.
+// It's forwarded to admin, and admin's reply to the forwarded message is relayed back to the user.
+type Feedback struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID int64 `gorm:"index"`
+	Text   string
+
+	// AdminMessageID is the ID of the message with feedback in admin chat
+	AdminMessageID int `gorm:"index"`
+
+	Reply     string
+	RepliedAt time.Time
+}
+
+func (c *customContext) handleFeedback() error {
+	c.user.State = UserStateWaitingForFeedback
+
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(tele.Row{{
+		Unique: btnKeyTypeFeedbackCancel,
+		Text:   "❌ Cancel",
+	}})
+	return c.Send(messageFeedback, tele.ModeMarkdown, rm)
+}
+
+func (c *customContext) handleFeedbackCancel() error {
+	if c.user.State == UserStateWaitingForFeedback {
+		c.user.State = UserStateLoggedIn
+	}
+	return c.Delete()
+}
+
+// submitFeedback saves the feedback and forwards it to admin.
+func (c *customContext) submitFeedback(text string) error {
+	c.user.State = UserStateLoggedIn
+
+	fb := Feedback{
+		UserID: c.user.ID,
+		Text:   text,
+	}
+	if err := c.s.db.Create(&fb).Error; err != nil {
+		return err
+	}
+
+	m, err := c.Bot().Send(tele.ChatID(*adminID), fmt.Sprintf(
+		"feedback #%d from %d (@%s, %s)\n\n%s\n\nReply to this message to answer.",
+		fb.ID,
+		c.user.ID,
+		c.user.TGUsername,
+		c.user.TGName,
+		text,
+	))
+	if err != nil {
+		return err
+	}
+
+	fb.AdminMessageID = m.ID
+	if err := c.s.db.Model(&fb).Update("AdminMessageID", m.ID).Error; err != nil {
+		return err
+	}
+
+	return c.Send("Thanks for the feedback! 💌 I'll get back to you here if needed.")
+}
+
+// handleAdminReply relays admin's reply to a forwarded feedback back to the user.
+// Returns false if the message is not a reply to feedback.
+func (c *customContext) handleAdminReply() (bool, error) {
+	replyTo := c.Message().ReplyTo
+	if c.user.ID != *adminID || replyTo == nil {
+		return false, nil
+	}
+
+	var fb Feedback
+	err := c.s.db.Where("admin_message_id = ?", replyTo.ID).First(&fb).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	if _, err := c.Bot().Send(
+		tele.ChatID(fb.UserID),
+		"💬 Reply to your feedback:\n\n"+c.Text(),
+	); err != nil {
+		return true, err
+	}
+	log.Printf("[uid:%d] relayed admin reply to feedback #%d", fb.UserID, fb.ID)
+
+	if err := c.s.db.Model(&fb).Updates(Feedback{Reply: c.Text(), RepliedAt: time.Now()}).Error; err != nil {
+		return true, err
+	}
+
+	return true, c.Reply("✅ Sent")
+}
@@ -0,0 +1,33 @@
+package gira
+
+import "context"
+
+// API is a set of Gira operations used by the bot. It's implemented by Client,
+// and by girafake.Client for tests.
+type API interface {
+	Ping(ctx context.Context) error
+	GetClientInfo(ctx context.Context) (ClientInfo, error)
+	GetBalance(ctx context.Context) (Balance, error)
+	GetServiceStatus(ctx context.Context) (ServiceStatus, error)
+	GetMessages(ctx context.Context) ([]Message, error)
+
+	GetStations(ctx context.Context) ([]Station, error)
+	GetStationCached(ctx context.Context, serial StationSerial) (Station, error)
+	GetStationByCodeCached(ctx context.Context, code StationCode) (Station, error)
+	GetStationDocks(ctx context.Context, id StationSerial, opts ...CallOption) (Docks, error)
+	FindBike(ctx context.Context, id string) (BikeLocation, error)
+
+	ReserveBike(ctx context.Context, id BikeSerial, opts ...CallOption) (bool, error)
+	CancelBikeReserve(ctx context.Context, opts ...CallOption) (bool, error)
+	StartTrip(ctx context.Context, opts ...CallOption) (bool, error)
+
+	GetActiveTrip(ctx context.Context) (Trip, error)
+	GetTrip(ctx context.Context, code TripCode) (Trip, error)
+	GetTripHistory(ctx context.Context, page, pageSize int) ([]Trip, error)
+	GetUnratedTrips(ctx context.Context, page, pageSize int) ([]Trip, error)
+	RateTrip(ctx context.Context, code TripCode, rating TripRating) (bool, error)
+	PayTripWithPoints(ctx context.Context, id TripCode) (int, error)
+	PayTripWithMoney(ctx context.Context, id TripCode) (int, error)
+}
+
+var _ API = (*Client)(nil)
@@ -0,0 +1,88 @@
+package gira
+
+// DockState is availability of a dock for returning a bike.
+type DockState int
+
+const (
+	// DockFree is an empty dock which accepts a bike.
+	DockFree DockState = iota
+	// DockOccupied is a dock with a bike in it, whatever the state of the bike.
+	DockOccupied
+	// DockOutOfService is an empty dock which doesn't accept bikes, see OutOfServiceReason.
+	DockOutOfService
+)
+
+// OutOfServiceReason is why an empty dock doesn't accept bikes.
+type OutOfServiceReason string
+
+const (
+	ReasonInactive OutOfServiceReason = "inactive"
+	ReasonLed      OutOfServiceReason = "led"
+	ReasonLocked   OutOfServiceReason = "locked"
+)
+
+// State returns availability of the dock, and the reason if it's out of service. Empty dock is free only
+// if it's active, its LED is green and the lock is open, otherwise returning a bike there fails.
+func (d Dock) State() (DockState, OutOfServiceReason) {
+	switch {
+	case d.Bike != nil:
+		return DockOccupied, ""
+	case d.Status != AssetStatusActive:
+		return DockOutOfService, ReasonInactive
+	case d.LedStatus != "green":
+		return DockOutOfService, ReasonLed
+	case d.LockStatus != "unlocked":
+		return DockOutOfService, ReasonLocked
+	}
+	return DockFree, ""
+}
+
+// Availability is a summary of dock states of a station.
+type Availability struct {
+	Free         int
+	Occupied     int
+	OutOfService int
+	// Reasons counts out of service docks by reason.
+	Reasons map[OutOfServiceReason]int
+}
+
+// Availability returns summary of dock states, see Dock.State.
+func (ds Docks) Availability() Availability {
+	var a Availability
+	for _, d := range ds {
+		state, reason := d.State()
+		switch state {
+		case DockFree:
+			a.Free++
+		case DockOccupied:
+			a.Occupied++
+		case DockOutOfService:
+			a.OutOfService++
+			if a.Reasons == nil {
+				a.Reasons = make(map[OutOfServiceReason]int)
+			}
+			a.Reasons[reason]++
+		}
+	}
+	return a
+}
+
+// Free returns the number of docks which accept a bike.
+func (ds Docks) Free() int {
+	return ds.Availability().Free
+}
+
+// FreeDocksEstimate returns the number of free docks from station counters. It's an upper bound,
+// as counters don't know about out of service docks, prefer FreeDocks if docks are fetched.
+func (s Station) FreeDocksEstimate() int {
+	return max(0, s.Docks-s.Bikes)
+}
+
+// FreeDocks returns the number of free docks at station s with docks, or the estimate from station
+// counters if docks are not known, e.g. fetching them failed.
+func FreeDocks(s Station, docks Docks) int {
+	if docks == nil {
+		return s.FreeDocksEstimate()
+	}
+	return docks.Free()
+}
@@ -0,0 +1,48 @@
+package gira
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestDocksAvailability(t *testing.T) {
+	free := Dock{Status: AssetStatusActive, LedStatus: "green", LockStatus: "unlocked"}
+	docks := Docks{
+		free,
+		{Status: AssetStatusActive, LedStatus: "green", LockStatus: "locked", Bike: &Bike{}},
+		{Status: "repair", LedStatus: "green", LockStatus: "unlocked"},
+		{Status: AssetStatusActive, LedStatus: "red", LockStatus: "unlocked"},
+		{Status: AssetStatusActive, LedStatus: "green", LockStatus: "locked"},
+		free,
+	}
+
+	got := docks.Availability()
+	want := Availability{
+		Free:         2,
+		Occupied:     1,
+		OutOfService: 3,
+		Reasons:      map[OutOfServiceReason]int{ReasonInactive: 1, ReasonLed: 1, ReasonLocked: 1},
+	}
+	if got.Free != want.Free || got.Occupied != want.Occupied || got.OutOfService != want.OutOfService ||
+		!maps.Equal(got.Reasons, want.Reasons) {
+		t.Errorf("Availability() = %+v, want %+v", got, want)
+	}
+	if docks.Free() != 2 {
+		t.Errorf("Free() = %d, want 2", docks.Free())
+	}
+}
+
+func TestFreeDocks(t *testing.T) {
+	s := Station{Docks: 20, Bikes: 15}
+	if got := FreeDocks(s, nil); got != 5 {
+		t.Errorf("FreeDocks() without docks = %d, want 5", got)
+	}
+	// station counters include out of service docks
+	docks := Docks{{Status: AssetStatusActive, LedStatus: "green", LockStatus: "unlocked"}, {Status: "repair"}}
+	if got := FreeDocks(s, docks); got != 1 {
+		t.Errorf("FreeDocks() = %d, want 1", got)
+	}
+	if got := (Station{Docks: 10, Bikes: 12}).FreeDocksEstimate(); got != 0 {
+		t.Errorf("FreeDocksEstimate() with more bikes than docks = %d, want 0", got)
+	}
+}
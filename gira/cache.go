@@ -0,0 +1,194 @@
+package gira
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StationCache keeps station list, so that single stations can be looked up without
+// querying all of them each time. It's safe for concurrent use and is meant to be shared between clients.
+type StationCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	stations  map[StationSerial]Station
+	updatedAt time.Time
+	// restored is set if stations were loaded by Restore and not fetched yet, they are used regardless of ttl
+	restored bool
+	// onUpdate is called with every freshly fetched list, see OnUpdate
+	onUpdate func(stations []Station, fetchedAt time.Time)
+	// inflight is the station list request in progress, concurrent callers wait for it instead of making own
+	inflight *stationsCall
+}
+
+// stationsCall is a station list request shared by concurrent callers, done is closed when it completes.
+type stationsCall struct {
+	done     chan struct{}
+	stations []Station
+	err      error
+	// waiters is the number of callers waiting for the request besides the one making it
+	waiters int
+}
+
+// NewStationCache returns an empty cache, which keeps stations for ttl after they were fetched.
+func NewStationCache(ttl time.Duration) *StationCache {
+	return &StationCache{ttl: ttl}
+}
+
+// OnUpdate sets fn to be called with every station list fetched from the backend, e.g. to persist it
+// for Restore. It's called synchronously on the request path and should be set before the cache is used.
+func (sc *StationCache) OnUpdate(fn func(stations []Station, fetchedAt time.Time)) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.onUpdate = fn
+}
+
+// Restore fills empty cache with stations fetched at fetchedAt, e.g. persisted before restart.
+// They are used until the first fetch regardless of ttl, so that lookups don't block on the backend.
+func (sc *StationCache) Restore(stations []Station, fetchedAt time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if len(sc.stations) > 0 || len(stations) == 0 {
+		return
+	}
+	sc.stations = stationsBySerial(stations)
+	sc.updatedAt = fetchedAt
+	sc.restored = true
+}
+
+func stationsBySerial(stations []Station) map[StationSerial]Station {
+	m := make(map[StationSerial]Station, len(stations))
+	for _, station := range stations {
+		m[station.Serial] = station
+	}
+	return m
+}
+
+// set replaces cached stations with the fresh list.
+func (sc *StationCache) set(stations []Station) {
+	m := stationsBySerial(stations)
+	now := time.Now()
+
+	sc.mu.Lock()
+	sc.stations = m
+	sc.updatedAt = now
+	sc.restored = false
+	onUpdate := sc.onUpdate
+	sc.mu.Unlock()
+
+	if onUpdate != nil {
+		onUpdate(slices.Clone(stations), now)
+	}
+}
+
+// get returns cached stations, or false if there are none or they are expired.
+// Returned map must not be modified.
+func (sc *StationCache) get() (map[StationSerial]Station, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if len(sc.stations) == 0 || (!sc.restored && time.Since(sc.updatedAt) > sc.ttl) {
+		return nil, false
+	}
+	return sc.stations, true
+}
+
+// stale returns cached stations regardless of expiration, or false if there are none.
+// Returned map must not be modified.
+func (sc *StationCache) stale() (map[StationSerial]Station, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.stations, len(sc.stations) > 0
+}
+
+// fetch calls fetchFn to get fresh station list and updates the cache. If there's already a request
+// in progress, it waits for its result instead, so concurrent callers share one backend request.
+func (sc *StationCache) fetch(ctx context.Context, fetchFn func(context.Context) ([]Station, error)) ([]Station, error) {
+	sc.mu.Lock()
+	call := sc.inflight
+	if call == nil {
+		call = &stationsCall{done: make(chan struct{})}
+		sc.inflight = call
+		sc.mu.Unlock()
+
+		call.stations, call.err = fetchFn(ctx)
+		if call.err == nil {
+			sc.set(call.stations)
+		}
+
+		sc.mu.Lock()
+		sc.inflight = nil
+		sc.mu.Unlock()
+		close(call.done)
+	} else {
+		call.waiters++
+		sc.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// callers might sort or modify returned list
+	return slices.Clone(call.stations), call.err
+}
+
+// Invalidate drops cached stations, so that the next lookup fetches them again.
+func (sc *StationCache) Invalidate() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.stations = nil
+}
+
+// cachedStations returns stations from the cache, fetching them if needed.
+// If fetching fails, expired stations are returned, as the list rarely changes.
+func (c *Client) cachedStations(ctx context.Context) (map[StationSerial]Station, error) {
+	if stations, ok := c.cache.get(); ok {
+		return stations, nil
+	}
+
+	res, err := c.GetStations(ctx)
+	if err != nil {
+		if stations, ok := c.cache.stale(); ok {
+			return stations, nil
+		}
+		return nil, err
+	}
+	return stationsBySerial(res), nil
+}
+
+// GetStationCached returns a station from the cache, fetching all stations if cache is empty or expired.
+// This is useful to avoid calling GetStations multiple times if up-to-date data like free dock count is not required.
+func (c *Client) GetStationCached(ctx context.Context, serial StationSerial) (Station, error) {
+	stations, err := c.cachedStations(ctx)
+	if err != nil {
+		return Station{}, err
+	}
+
+	station, ok := stations[serial]
+	if !ok {
+		return Station{}, fmt.Errorf("gira: station %s not found in cache", serial)
+	}
+	return station, nil
+}
+
+// GetStationByCodeCached returns a station by its code from the cache, see GetStationCached.
+// Trips reference stations by code, not by serial.
+func (c *Client) GetStationByCodeCached(ctx context.Context, code StationCode) (Station, error) {
+	stations, err := c.cachedStations(ctx)
+	if err != nil {
+		return Station{}, err
+	}
+
+	for _, station := range stations {
+		if station.Code == code {
+			return station, nil
+		}
+	}
+	return Station{}, fmt.Errorf("gira: station with code %s not found in cache", code)
+}
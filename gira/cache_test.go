@@ -0,0 +1,126 @@
+package gira
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waiters returns number of callers waiting for the request in progress.
+func (sc *StationCache) waiters() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.inflight == nil {
+		return 0
+	}
+	return sc.inflight.waiters
+}
+
+func TestStationCache(t *testing.T) {
+	sc := NewStationCache(time.Hour)
+	if _, ok := sc.get(); ok {
+		t.Fatal("empty cache returned stations")
+	}
+
+	sc.set([]Station{{Serial: "s1"}, {Serial: "s2"}})
+	stations, ok := sc.get()
+	if !ok || len(stations) != 2 || stations["s2"].Serial != "s2" {
+		t.Fatalf("get() = %v, %v", stations, ok)
+	}
+
+	sc.Invalidate()
+	if _, ok := sc.get(); ok {
+		t.Error("invalidated cache returned stations")
+	}
+
+	sc.set([]Station{{Serial: "s1"}})
+	sc.updatedAt = time.Now().Add(-2 * time.Hour)
+	if _, ok := sc.get(); ok {
+		t.Error("expired cache returned stations")
+	}
+}
+
+func TestStationCacheFetchCoalesced(t *testing.T) {
+	sc := NewStationCache(time.Hour)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetchFn := func(context.Context) ([]Station, error) {
+		calls.Add(1)
+		<-release
+		return []Station{{Serial: "s1"}}, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make(chan []Station, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := sc.fetch(context.Background(), fetchFn)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- res
+		}()
+	}
+
+	// let all callers join the first request
+	for sc.waiters() < callers-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetchFn called %d times, want 1", n)
+	}
+	for res := range results {
+		if len(res) != 1 || res[0].Serial != "s1" {
+			t.Errorf("fetch() = %v", res)
+		}
+	}
+	if _, ok := sc.get(); !ok {
+		t.Error("cache is not filled after fetch")
+	}
+}
+
+func TestStationCacheRestore(t *testing.T) {
+	sc := NewStationCache(time.Hour)
+
+	var persisted []Station
+	sc.OnUpdate(func(stations []Station, _ time.Time) {
+		persisted = stations
+	})
+
+	// restored list is used even if it's older than ttl
+	sc.Restore([]Station{{Serial: "old"}}, time.Now().Add(-24*time.Hour))
+	if stations, ok := sc.get(); !ok || stations["old"].Serial != "old" {
+		t.Fatalf("get() after restore = %v, %v", stations, ok)
+	}
+
+	sc.set([]Station{{Serial: "new"}})
+	if len(persisted) != 1 || persisted[0].Serial != "new" {
+		t.Errorf("persisted = %v", persisted)
+	}
+
+	// restore doesn't override fetched stations
+	sc.Restore([]Station{{Serial: "old"}}, time.Now())
+	stations, ok := sc.get()
+	if _, found := stations["new"]; !ok || !found {
+		t.Errorf("get() after second restore = %v, %v", stations, ok)
+	}
+
+	// fetched stations expire as usual, but stay available as stale
+	sc.updatedAt = time.Now().Add(-2 * time.Hour)
+	if _, ok := sc.get(); ok {
+		t.Error("expired cache returned stations")
+	}
+	if _, ok := sc.stale(); !ok {
+		t.Error("stale() returned no stations")
+	}
+}
@@ -0,0 +1,10 @@
+// Package gira is a client of Gira, Lisbon bike sharing, GraphQL API.
+//
+// Client needs an HTTP client which authenticates requests, e.g. oauth2.Transport with tokens
+// from giraauth. Bot-specific parts, like shared station cache or rate limiters, are optional
+// and configured with Option.
+//
+// The module follows semantic versioning, releases are tagged as gira/vX.Y.Z.
+// Exported API of this package, giraauth, girafake, retryablehttp, emeltls and firebasetoken
+// is kept backwards compatible within a major version.
+package gira
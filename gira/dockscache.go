@@ -0,0 +1,82 @@
+package gira
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DocksCache keeps docks of stations for a short time, so that users opening the same popular station
+// at once share one request. It's safe for concurrent use and is meant to be shared between clients.
+type DocksCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[StationSerial]docksEntry
+	// inflight are docks requests in progress, concurrent callers wait for them instead of making own
+	inflight map[StationSerial]*docksCall
+}
+
+type docksEntry struct {
+	docks     Docks
+	fetchedAt time.Time
+}
+
+// docksCall is a docks request shared by concurrent callers, done is closed when it completes.
+type docksCall struct {
+	done  chan struct{}
+	docks Docks
+	err   error
+	// waiters is the number of callers waiting for the request besides the one making it
+	waiters int
+}
+
+// NewDocksCache returns an empty cache, which keeps docks for ttl after they were fetched.
+func NewDocksCache(ttl time.Duration) *DocksCache {
+	return &DocksCache{
+		ttl:      ttl,
+		entries:  make(map[StationSerial]docksEntry),
+		inflight: make(map[StationSerial]*docksCall),
+	}
+}
+
+// get returns docks of station id from the cache, or calls fetchFn to get them. If fresh is set,
+// cached docks are not used, but a request already in progress is, as it's fresh anyway.
+// Entries are never dropped, there are only a few hundred stations.
+func (dc *DocksCache) get(ctx context.Context, id StationSerial, fresh bool, fetchFn func(context.Context) (Docks, error)) (Docks, error) {
+	dc.mu.Lock()
+	if e, ok := dc.entries[id]; ok && !fresh && time.Since(e.fetchedAt) <= dc.ttl {
+		dc.mu.Unlock()
+		// callers might filter or sort returned docks
+		return slices.Clone(e.docks), nil
+	}
+
+	call := dc.inflight[id]
+	if call == nil {
+		call = &docksCall{done: make(chan struct{})}
+		dc.inflight[id] = call
+		dc.mu.Unlock()
+
+		call.docks, call.err = fetchFn(ctx)
+
+		dc.mu.Lock()
+		delete(dc.inflight, id)
+		if call.err == nil {
+			dc.entries[id] = docksEntry{docks: call.docks, fetchedAt: time.Now()}
+		}
+		dc.mu.Unlock()
+		close(call.done)
+	} else {
+		call.waiters++
+		dc.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return slices.Clone(call.docks), call.err
+}
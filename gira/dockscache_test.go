@@ -0,0 +1,88 @@
+package gira
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waiters returns number of callers waiting for the docks request in progress.
+func (dc *DocksCache) waiters(id StationSerial) int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if call := dc.inflight[id]; call != nil {
+		return call.waiters
+	}
+	return 0
+}
+
+func TestDocksCache(t *testing.T) {
+	dc := NewDocksCache(time.Minute)
+
+	var calls atomic.Int32
+	fetchFn := func(context.Context) (Docks, error) {
+		calls.Add(1)
+		return Docks{{Number: 1}, {Number: 2}}, nil
+	}
+
+	ctx := context.Background()
+	for range 2 {
+		docks, err := dc.get(ctx, "s1", false, fetchFn)
+		if err != nil || len(docks) != 2 {
+			t.Fatalf("get() = %v, %v", docks, err)
+		}
+		// returned docks are a copy
+		docks[0].Number = 42
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetchFn called %d times, want 1", n)
+	}
+
+	docks, _ := dc.get(ctx, "s1", true, fetchFn)
+	if n := calls.Load(); n != 2 || docks[0].Number != 1 {
+		t.Errorf("fresh get() = %v, fetchFn called %d times, want 2", docks, n)
+	}
+
+	dc.entries["s1"] = docksEntry{docks: docks, fetchedAt: time.Now().Add(-time.Hour)}
+	_, _ = dc.get(ctx, "s1", false, fetchFn)
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expired get() called fetchFn %d times, want 3", n)
+	}
+}
+
+func TestDocksCacheCoalesced(t *testing.T) {
+	dc := NewDocksCache(time.Minute)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetchFn := func(context.Context) (Docks, error) {
+		calls.Add(1)
+		<-release
+		return Docks{{Number: 1}}, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := dc.get(context.Background(), "s1", false, fetchFn); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// let all callers join the first request
+	for dc.waiters("s1") < callers-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetchFn called %d times, want 1", n)
+	}
+}
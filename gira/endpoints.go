@@ -0,0 +1,121 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var endpointFailoversCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_endpoint_failovers_total"}, []string{"endpoint"})
+
+// EndpointPool is a list of GraphQL endpoints, the first one is primary. Requests are sent to the first
+// healthy endpoint, and an endpoint is skipped for cooldown after failThreshold consecutive failures
+// (network errors, 5xx or 403 responses). It's safe for concurrent use and is meant to be shared between clients.
+type EndpointPool struct {
+	failThreshold int
+	cooldown      time.Duration
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+}
+
+type endpoint struct {
+	url       *url.URL
+	failures  int
+	downUntil time.Time
+}
+
+// NewEndpointPool returns a pool of endpoints in order of preference.
+func NewEndpointPool(urls []string, failThreshold int, cooldown time.Duration) (*EndpointPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("gira: no endpoints")
+	}
+
+	p := &EndpointPool{failThreshold: failThreshold, cooldown: cooldown}
+	for _, s := range urls {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("gira: invalid endpoint %q: %w", s, err)
+		}
+		p.endpoints = append(p.endpoints, &endpoint{url: u})
+	}
+	return p, nil
+}
+
+// primary returns URL of the primary endpoint.
+func (p *EndpointPool) primary() string {
+	return p.endpoints[0].url.String()
+}
+
+// pick returns the first endpoint which is not cooling down, or the one which recovers first if all are.
+func (p *EndpointPool) pick(now time.Time) *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := p.endpoints[0]
+	for _, e := range p.endpoints {
+		if !now.Before(e.downUntil) {
+			return e
+		}
+		if e.downUntil.Before(res.downUntil) {
+			res = e
+		}
+	}
+	return res
+}
+
+// report records the outcome of request sent to the endpoint.
+func (p *EndpointPool) report(e *endpoint, failed bool, now time.Time, log *slog.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		e.failures = 0
+		return
+	}
+
+	e.failures++
+	if e.failures >= p.failThreshold && len(p.endpoints) > 1 {
+		log.Warn("gira: endpoint failed, skipping it", "endpoint", e.url.Host, "failures", e.failures, "cooldown", p.cooldown)
+		endpointFailoversCnt.WithLabelValues(e.url.Host).Inc()
+		e.failures = 0
+		e.downUntil = now.Add(p.cooldown)
+	}
+}
+
+// failoverTransport sends requests to the endpoint picked from the pool.
+type failoverTransport struct {
+	inner http.RoundTripper
+	pool  *EndpointPool
+	log   *slog.Logger
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := t.pool.pick(time.Now())
+
+	u := *e.url
+	req = req.Clone(req.Context())
+	req.URL = &u
+	req.Host = ""
+
+	resp, err := t.inner.RoundTrip(req)
+
+	var failed bool
+	if err != nil {
+		// canceled by caller, not endpoint's fault
+		failed = !errors.Is(req.Context().Err(), context.Canceled)
+	} else {
+		failed = resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusForbidden
+	}
+	t.pool.report(e, failed, time.Now(), t.log)
+
+	return resp, err
+}
@@ -0,0 +1,93 @@
+package gira
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolPick(t *testing.T) {
+	p, err := NewEndpointPool([]string{"https://a/graphql", "https://b/graphql"}, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a, b := p.endpoints[0], p.endpoints[1]
+
+	if got := p.pick(now); got != a {
+		t.Fatalf("pick = %s, want primary", got.url)
+	}
+
+	// single failure is tolerated, success resets the counter
+	p.report(a, true, now, slog.Default())
+	p.report(a, false, now, slog.Default())
+	p.report(a, true, now, slog.Default())
+	if got := p.pick(now); got != a {
+		t.Fatalf("pick after reset = %s, want primary", got.url)
+	}
+
+	p.report(a, true, now, slog.Default())
+	if got := p.pick(now); got != b {
+		t.Fatalf("pick after failures = %s, want secondary", got.url)
+	}
+
+	// all are down, the one which recovers first is used
+	p.report(b, true, now.Add(time.Second), slog.Default())
+	p.report(b, true, now.Add(time.Second), slog.Default())
+	if got := p.pick(now.Add(2 * time.Second)); got != a {
+		t.Fatalf("pick with all down = %s, want primary", got.url)
+	}
+
+	if got := p.pick(now.Add(time.Minute)); got != a {
+		t.Fatalf("pick after cooldown = %s, want primary", got.url)
+	}
+}
+
+func TestFailoverTransport(t *testing.T) {
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+		if r.URL.Path != "/ws/graphql" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+	}))
+	defer secondary.Close()
+
+	p, err := NewEndpointPool([]string{primary.URL + "/ws/graphql", secondary.URL + "/ws/graphql"}, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	httpc := &http.Client{Transport: &failoverTransport{inner: http.DefaultTransport, pool: p, log: log}}
+
+	var codes []int
+	for range 4 {
+		resp, err := httpc.Post(DefaultEndpoint, "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+	}
+
+	if primaryHits.Load() != 2 || secondaryHits.Load() != 2 {
+		t.Errorf("hits = %d/%d, want 2/2", primaryHits.Load(), secondaryHits.Load())
+	}
+	if codes[3] != http.StatusOK {
+		t.Errorf("codes = %v, want last to be OK", codes)
+	}
+	if !strings.Contains(logs.String(), "endpoint failed") {
+		t.Errorf("failover is not logged to transport logger: %q", logs.String())
+	}
+}
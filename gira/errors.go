@@ -0,0 +1,92 @@
+package gira
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorCode is a stable code of Gira backend error, which doesn't depend on message wording.
+type ErrorCode string
+
+const (
+	CodeAlreadyHasActiveTrip     ErrorCode = "already_has_active_trip"
+	CodeBikeAlreadyReserved      ErrorCode = "bike_already_reserved"
+	CodeBikeInRepair             ErrorCode = "bike_in_repair"
+	CodeNotEnoughBalance         ErrorCode = "not_enough_balance"
+	CodeTripIntervalLimit        ErrorCode = "trip_interval_limit"
+	CodeHasNoActiveSubscriptions ErrorCode = "has_no_active_subscriptions"
+	CodeNoServiceStatusFound     ErrorCode = "no_service_status_found"
+	CodeBikeAlreadyInTrip        ErrorCode = "bike_already_in_trip"
+	CodeTMLCommunication         ErrorCode = "tml_communication"
+	CodeServiceUnavailable       ErrorCode = "service_unavailable"
+	CodeForbidden                ErrorCode = "forbidden"
+)
+
+// GiraError is an error returned by Gira backend. It matches the corresponding
+// sentinel error like ErrBikeInRepair with errors.Is.
+type GiraError struct {
+	Code ErrorCode
+	// Message is a human-readable description of the error.
+	Message string
+	// Raw is the response body the error was parsed from.
+	Raw string
+}
+
+func (e *GiraError) Error() string {
+	return "gira: " + e.Message
+}
+
+// Is makes GiraError match sentinel error of its code.
+func (e *GiraError) Is(target error) bool {
+	for _, k := range knownErrors {
+		if k.code == e.Code {
+			return target == k.sentinel
+		}
+	}
+	return false
+}
+
+// knownErrors maps substrings of backend responses to error codes, first match wins.
+var knownErrors = []struct {
+	code     ErrorCode
+	sentinel error
+	markers  []string
+}{
+	{CodeAlreadyHasActiveTrip, ErrAlreadyHasActiveTrip, []string{"already_has_active_trip"}},
+	{CodeBikeAlreadyReserved, ErrBikeAlreadyReserved, []string{"bike_already_reserved"}},
+	{CodeBikeInRepair, ErrBikeInRepair, []string{"bike_in_repair"}},
+	{CodeNotEnoughBalance, ErrNotEnoughBalance, []string{"not_enough_balance"}},
+	{CodeTripIntervalLimit, ErrTripIntervalLimit, []string{"trip_interval_limit"}},
+	{CodeHasNoActiveSubscriptions, ErrHasNoActiveSubscriptions, []string{"has_no_active_subscriptions"}},
+	{CodeNoServiceStatusFound, ErrNoServiceStatusFound, []string{"no_service_status_found"}},
+	{CodeBikeAlreadyInTrip, ErrBikeAlreadyInTrip, []string{"bike_already_in_trip"}},
+	// yes, it's spelled like this
+	{CodeTMLCommunication, ErrTMLCommunication, []string{"navigator_error_tml_comunication"}},
+	{CodeServiceUnavailable, ErrServiceUnavailable, []string{"Serviço indisponível", `Servi\u00E7o indispon\u00EDvel`}},
+	{CodeForbidden, ErrForbidden, []string{"403 Forbidden", "401 Unauthorized"}},
+}
+
+// parseTripErrorMessage returns GiraError for known backend error responses, or nil.
+func parseTripErrorMessage(msg string) error {
+	for _, k := range knownErrors {
+		for _, m := range k.markers {
+			if strings.Contains(msg, m) {
+				return &GiraError{
+					Code:    k.code,
+					Message: strings.TrimPrefix(k.sentinel.Error(), "gira: "),
+					Raw:     msg,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ErrorCodeOf returns code of Gira backend error in err's chain, or empty string if there's none.
+func ErrorCodeOf(err error) ErrorCode {
+	var giraErr *GiraError
+	if errors.As(err, &giraErr) {
+		return giraErr.Code
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package gira
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseTripErrorMessage(t *testing.T) {
+	tests := []struct {
+		msg      string
+		code     ErrorCode
+		sentinel error
+	}{
+		{`{"errors":[{"message":"bike_in_repair"}]}`, CodeBikeInRepair, ErrBikeInRepair},
+		{`{"errors":[{"message":"navigator_error_tml_comunication"}]}`, CodeTMLCommunication, ErrTMLCommunication},
+		{`{"message":"Servi\u00E7o indispon\u00EDvel"}`, CodeServiceUnavailable, ErrServiceUnavailable},
+		{"Serviço indisponível", CodeServiceUnavailable, ErrServiceUnavailable},
+		{"401 Unauthorized", CodeForbidden, ErrForbidden},
+		{"something else", "", nil},
+	}
+
+	for _, tt := range tests {
+		err := parseTripErrorMessage(tt.msg)
+		if tt.sentinel == nil {
+			if err != nil {
+				t.Errorf("parseTripErrorMessage(%q) = %v, want nil", tt.msg, err)
+			}
+			continue
+		}
+
+		wrapped := fmt.Errorf("handler: %w", err)
+		if got := ErrorCodeOf(wrapped); got != tt.code {
+			t.Errorf("ErrorCodeOf(%q) = %q, want %q", tt.msg, got, tt.code)
+		}
+		if !errors.Is(wrapped, tt.sentinel) {
+			t.Errorf("parseTripErrorMessage(%q) = %v, doesn't match %v", tt.msg, err, tt.sentinel)
+		}
+		if errors.Is(wrapped, ErrNoActiveTrip) {
+			t.Errorf("parseTripErrorMessage(%q) matches unrelated error", tt.msg)
+		}
+		if err.Error() != tt.sentinel.Error() {
+			t.Errorf("parseTripErrorMessage(%q).Error() = %q, want %q", tt.msg, err.Error(), tt.sentinel.Error())
+		}
+		var giraErr *GiraError
+		if errors.As(err, &giraErr) && giraErr.Raw != tt.msg {
+			t.Errorf("Raw = %q, want %q", giraErr.Raw, tt.msg)
+		}
+	}
+}
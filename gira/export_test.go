@@ -0,0 +1,4 @@
+package gira
+
+// FindBikeWith is FindBike of api with indexer ix, for tests with girafake.
+var FindBikeWith = findBike
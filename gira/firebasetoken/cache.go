@@ -0,0 +1,146 @@
+package firebasetoken
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ilyaluk/girabot/gira/giraauth"
+)
+
+// expiryMargin is how long before expiry cached tokens are not used anymore,
+// so that the token doesn't expire while request is in flight.
+const expiryMargin = time.Minute
+
+// GetExpiration returns expiry time of Firebase token. Signature is not verified,
+// the token is only passed to Gira, which verifies it.
+func GetExpiration(token string) (time.Time, error) {
+	tok, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("firebasetoken: parsing token: %w", err)
+	}
+	exp, err := tok.Claims.GetExpirationTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("firebasetoken: parsing token: %w", err)
+	}
+	if exp == nil {
+		return time.Time{}, fmt.Errorf("firebasetoken: token has no expiry")
+	}
+	return exp.Time, nil
+}
+
+// Cache keeps Firebase tokens per user until shortly before they expire, so that a burst of requests
+// of one user consumes one token from the exchange server. Concurrent fetches for the same user are shared.
+// It's safe for concurrent use and is meant to be shared between transports.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// inflight are fetches in progress by user ID, concurrent callers wait for them
+	inflight map[string]*fetchCall
+}
+
+type cacheEntry struct {
+	token     string
+	expiresAt time.Time
+}
+
+// fetchCall is a fetch shared by concurrent callers, done is closed when it completes.
+type fetchCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]*fetchCall),
+	}
+}
+
+// get returns Firebase token of the user accessToken belongs to, from the cache or by calling fetch.
+func (c *Cache) get(ctx context.Context, accessToken string, fetch func(ctx context.Context, accessToken string) (string, error)) (string, error) {
+	return c.getValidFor(ctx, accessToken, expiryMargin, fetch)
+}
+
+// getValidFor is get, which uses cached token only if it's valid for at least d.
+// Tokens which expiry is unknown are not cached, as well as tokens of unparsable access tokens.
+// Entries are never dropped, only replaced, there is one per user.
+func (c *Cache) getValidFor(ctx context.Context, accessToken string, d time.Duration, fetch func(ctx context.Context, accessToken string) (string, error)) (string, error) {
+	claims, err := giraauth.ParseClaims(accessToken)
+	if err != nil {
+		return fetch(ctx, accessToken)
+	}
+	sub := claims.Subject
+
+	c.mu.Lock()
+	if e, ok := c.entries[sub]; ok && time.Until(e.expiresAt) > d {
+		c.mu.Unlock()
+		cacheLookupsCnt.WithLabelValues("hit").Inc()
+		return e.token, nil
+	}
+
+	call := c.inflight[sub]
+	if call == nil {
+		cacheLookupsCnt.WithLabelValues("miss").Inc()
+		call = &fetchCall{done: make(chan struct{})}
+		c.inflight[sub] = call
+		c.mu.Unlock()
+
+		call.token, call.err = fetch(ctx, accessToken)
+
+		c.mu.Lock()
+		delete(c.inflight, sub)
+		if call.err == nil {
+			if exp, err := GetExpiration(call.token); err == nil {
+				c.entries[sub] = cacheEntry{token: call.token, expiresAt: exp}
+			}
+		}
+		c.mu.Unlock()
+		close(call.done)
+		return call.token, call.err
+	}
+	c.mu.Unlock()
+	cacheLookupsCnt.WithLabelValues("shared").Inc()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Set puts Firebase token of the user accessToken belongs to into the cache, e.g. one persisted
+// before restart, see Transport.OnFetch. Expired access token is fine, only its subject is used.
+func (c *Cache) Set(accessToken, token string) error {
+	claims, err := giraauth.ParseClaims(accessToken)
+	if err != nil {
+		return err
+	}
+	exp, err := GetExpiration(token)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[claims.Subject] = cacheEntry{token: token, expiresAt: exp}
+	return nil
+}
+
+// forget drops cached token of the user accessToken belongs to, e.g. if Gira rejected it.
+func (c *Cache) forget(accessToken string) {
+	claims, err := giraauth.ParseClaims(accessToken)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, claims.Subject)
+}
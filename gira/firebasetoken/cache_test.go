@@ -0,0 +1,114 @@
+package firebasetoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signedToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCache(t *testing.T) {
+	accessToken := func(sub string) string {
+		return signedToken(t, jwt.MapClaims{
+			"sub": sub,
+			"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+			"exp": time.Now().Add(2 * time.Minute).Unix(),
+		})
+	}
+	user1 := accessToken("45e33173-2943-47ae-92de-59afbcab4c4c")
+	user2 := accessToken("9a8f7b1c-0d2e-4f3a-8b4c-5d6e7f8a9b0c")
+
+	fbExp := time.Now().Add(time.Hour)
+	var fetches int
+	fetch := func(ctx context.Context, accessToken string) (string, error) {
+		fetches++
+		return signedToken(t, jwt.MapClaims{"exp": fbExp.Unix()}), nil
+	}
+
+	c := NewCache()
+	ctx := context.Background()
+	for _, tt := range []struct {
+		accessToken string
+		wantFetches int
+	}{
+		{user1, 1},
+		{user1, 1},
+		{user2, 2},
+		{user2, 2},
+	} {
+		if _, err := c.get(ctx, tt.accessToken, fetch); err != nil {
+			t.Fatal(err)
+		}
+		if fetches != tt.wantFetches {
+			t.Errorf("fetches = %d, want %d", fetches, tt.wantFetches)
+		}
+	}
+
+	c.forget(user1)
+	if _, err := c.get(ctx, user1, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 3 {
+		t.Errorf("after forget: fetches = %d, want 3", fetches)
+	}
+
+	// tokens close to expiry are not used
+	fbExp = time.Now().Add(expiryMargin / 2)
+	c.forget(user1)
+	for range 2 {
+		if _, err := c.get(ctx, user1, fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 5 {
+		t.Errorf("near expiry: fetches = %d, want 5", fetches)
+	}
+
+	// prefetch refreshes tokens which expire within the window, even if get would use them
+	fbExp = time.Now().Add(time.Hour)
+	if _, err := c.get(ctx, user2, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.getValidFor(ctx, user2, 2*time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 6 {
+		t.Errorf("prefetch: fetches = %d, want 6", fetches)
+	}
+}
+
+func TestCacheSet(t *testing.T) {
+	// persisted access token is likely expired, it's fine
+	accessToken := signedToken(t, jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	fbToken := signedToken(t, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+	c := NewCache()
+	if err := c.Set(accessToken, fbToken); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.Set(accessToken, "garbage"); err == nil {
+		t.Error("Set with invalid Firebase token succeeded, want error")
+	}
+
+	got, err := c.get(context.Background(), accessToken, func(ctx context.Context, accessToken string) (string, error) {
+		t.Error("fetch called for token which was set")
+		return "", nil
+	})
+	if err != nil || got != fbToken {
+		t.Errorf("get = %q, %v, want the token which was set", got, err)
+	}
+}
@@ -0,0 +1,51 @@
+package firebasetoken
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// fetchDurationHist counts fetches from the token source by result, so that empty pool is visible
+	// before users complain.
+	fetchDurationHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firebasetoken_fetch_duration_seconds",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+	// cacheLookupsCnt counts Cache lookups by result: hit, miss, or shared fetch of a concurrent caller.
+	cacheLookupsCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "firebasetoken_cache_lookups_total"}, []string{"result"})
+	// unauthorizedCnt counts 401 responses to requests with Firebase token.
+	unauthorizedCnt = promauto.NewCounter(prometheus.CounterOpts{Name: "firebasetoken_unauthorized_responses_total"})
+)
+
+// ErrNoTokens should be matched by errors of Transport.Fetch when token pool is empty, for metrics.
+var ErrNoTokens = errors.New("firebasetoken: no tokens available")
+
+// fetchResult returns a low-cardinality label for the fetch result.
+func fetchResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNoTokens):
+		return "no_tokens"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
+
+// observedFetch wraps fetch to record its latency and result.
+func observedFetch(fetch func(ctx context.Context, accessToken string) (string, error)) func(ctx context.Context, accessToken string) (string, error) {
+	return func(ctx context.Context, accessToken string) (string, error) {
+		start := time.Now()
+		tok, err := fetch(ctx, accessToken)
+		fetchDurationHist.WithLabelValues(fetchResult(err)).Observe(time.Since(start).Seconds())
+		return tok, err
+	}
+}
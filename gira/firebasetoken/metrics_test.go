@@ -0,0 +1,48 @@
+package firebasetoken
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFetchResult(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{fmt.Errorf("exchange: %w", ErrNoTokens), "no_tokens"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("oops"), "error"},
+	} {
+		if got := fetchResult(tt.err); got != tt.want {
+			t.Errorf("fetchResult(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestObservedFetch(t *testing.T) {
+	fetch := observedFetch(func(ctx context.Context, accessToken string) (string, error) {
+		return "", ErrNoTokens
+	})
+
+	count := func() uint64 {
+		var m dto.Metric
+		if err := fetchDurationHist.WithLabelValues("no_tokens").(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	before := count()
+	if _, err := fetch(context.Background(), "auth"); err != ErrNoTokens {
+		t.Fatalf("fetch error = %v, want ErrNoTokens", err)
+	}
+	if got := count() - before; got != 1 {
+		t.Errorf("observed %d no_tokens fetches, want 1", got)
+	}
+}
@@ -0,0 +1,152 @@
+// Package firebasetoken adds Firebase App Check token, which Gira backend requires
+// besides the access token, to requests.
+package firebasetoken
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Transport is http.RoundTripper that adds a Firebase token to request headers.
+type Transport struct {
+	Base http.RoundTripper
+
+	// Source provides account access token, the Firebase token is bound to it.
+	Source oauth2.TokenSource
+	// Fetch returns Firebase token for the access token, e.g. from a token exchange server.
+	// Its errors should match ErrNoTokens if token pool is empty.
+	Fetch func(ctx context.Context, accessToken string) (string, error)
+	// Encode optionally transforms fetched token before sending it, e.g. encrypts it with the access token.
+	// Cached tokens are raw, so they are encoded for each request.
+	Encode func(token, accessToken string) (string, error)
+	// Cache optionally keeps fetched tokens, so that they are not fetched for each request.
+	Cache *Cache
+	// OnFetch is optionally called with each newly fetched token, e.g. to persist it for Cache.Set.
+	OnFetch func(token string)
+	// Logger is used instead of slog.Default() if set.
+	Logger *slog.Logger
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Thanks to golang.org/x/oauth2 lib for Transport implementation
+
+	reqBodyClosed := false
+	if req.Body != nil {
+		defer func() {
+			if !reqBodyClosed {
+				req.Body.Close()
+			}
+		}()
+	}
+
+	tok, err := t.Source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := t.token(req.Context(), tok.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if t.Encode != nil {
+		token, err = t.Encode(token, tok.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req2 := cloneRequest(req) // per RoundTripper contract
+	req2.Header.Set("x-firebase-token", token)
+
+	// req.Body is assumed to be closed by the base RoundTripper.
+	reqBodyClosed = true
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req2)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		unauthorizedCnt.Inc()
+		t.logger().Warn("firebasetoken: got 401", "www-authenticate", resp.Header.Get("www-authenticate"))
+		if t.Cache != nil {
+			// token might be revoked or reassigned, fetch a new one next time
+			t.Cache.forget(tok.AccessToken)
+		}
+	}
+
+	return resp, nil
+}
+
+// Token returns raw Firebase token for Source's access token, from Cache if it's set, the same as requests use.
+// It's for consumers which pass the token to something else than Gira API.
+func (t *Transport) Token(ctx context.Context) (string, error) {
+	tok, err := t.Source.Token()
+	if err != nil {
+		return "", err
+	}
+	return t.token(ctx, tok.AccessToken)
+}
+
+// token returns Firebase token for accessToken, from Cache if it's set.
+func (t *Transport) token(ctx context.Context, accessToken string) (string, error) {
+	if t.Cache != nil {
+		return t.Cache.get(ctx, accessToken, t.fetch)
+	}
+	return t.fetch(ctx, accessToken)
+}
+
+// fetch calls Fetch, records metrics and notifies OnFetch.
+func (t *Transport) fetch(ctx context.Context, accessToken string) (string, error) {
+	token, err := observedFetch(t.Fetch)(ctx, accessToken)
+	if err == nil && t.OnFetch != nil {
+		t.OnFetch(token)
+	}
+	return token, err
+}
+
+func (t *Transport) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return slog.Default()
+}
+
+// Prefetch fetches a new token into Cache if the cached one expires within window, so that requests
+// don't wait for the fetch. Concurrent requests wait for the prefetch instead of making their own.
+func (t *Transport) Prefetch(ctx context.Context, window time.Duration) error {
+	if t.Cache == nil {
+		return nil
+	}
+
+	tok, err := t.Source.Token()
+	if err != nil {
+		return err
+	}
+
+	_, err = t.Cache.getValidFor(ctx, tok.AccessToken, window, t.fetch)
+	return err
+}
+
+// cloneRequest returns a clone of the provided *http.Request.
+// The clone is a shallow copy of the struct and its Header map.
+func cloneRequest(r *http.Request) *http.Request {
+	// shallow copy of the struct
+	r2 := new(http.Request)
+	*r2 = *r
+	// deep copy of the Header
+	r2.Header = make(http.Header, len(r.Header))
+	for k, s := range r.Header {
+		r2.Header[k] = slices.Clone(s)
+	}
+	return r2
+}
@@ -0,0 +1,41 @@
+package firebasetoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+func TestTransportToken(t *testing.T) {
+	accessToken := signedToken(t, jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": time.Now().Add(2 * time.Minute).Unix(),
+	})
+	fbToken := signedToken(t, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+	var fetches int
+	tr := &Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken}),
+		Fetch: func(ctx context.Context, accessToken string) (string, error) {
+			fetches++
+			return fbToken, nil
+		},
+		Cache: NewCache(),
+	}
+	for range 2 {
+		got, err := tr.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != fbToken {
+			t.Errorf("Token() = %q, want fetched token", got)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetches = %d, want 1, second call should use cache", fetches)
+	}
+}
@@ -0,0 +1,474 @@
+package gira
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+var (
+	ErrNoActiveTrip = fmt.Errorf("gira: no active trip")
+	ErrBikeNotFound = fmt.Errorf("gira: bike not found")
+
+	ErrAlreadyHasActiveTrip     = fmt.Errorf("gira: already has active trip")
+	ErrBikeAlreadyReserved      = fmt.Errorf("gira: bike already reserved")
+	ErrBikeInRepair             = fmt.Errorf("gira: bike in repair")
+	ErrNotEnoughBalance         = fmt.Errorf("gira: not enough balance")
+	ErrTripIntervalLimit        = fmt.Errorf("gira: trip interval limit")
+	ErrHasNoActiveSubscriptions = fmt.Errorf("gira: has no active subscriptions")
+	ErrNoServiceStatusFound     = fmt.Errorf("gira: no service status found")
+	ErrBikeAlreadyInTrip        = fmt.Errorf("gira: bike already in trip")
+	ErrTMLCommunication         = fmt.Errorf("gira: TML communication error")
+	ErrServiceUnavailable       = fmt.Errorf("gira: service unavailable")
+	ErrForbidden                = fmt.Errorf("gira: forbidden")
+)
+
+type Client struct {
+	c         *graphql.Client
+	endpoint  string
+	endpoints *EndpointPool
+	cache     *StationCache
+	docks     *DocksCache
+	indexer   *Indexer
+	limiters  []*RateLimiter
+	retryOpts []retryablehttp.Option
+	log       *slog.Logger
+}
+
+// New returns a client which uses httpc for requests. By default it uses DefaultEndpoint
+// and own station cache, see Option for alternatives.
+func New(httpc *http.Client, opts ...Option) *Client {
+	c := &Client{endpoint: DefaultEndpoint}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cache == nil {
+		c.cache = NewStationCache(defaultStationCacheTTL)
+	}
+	if c.docks == nil {
+		c.docks = NewDocksCache(defaultDocksCacheTTL)
+	}
+
+	inner := httpc.Transport
+	if c.endpoints != nil {
+		if inner == nil {
+			inner = http.DefaultTransport
+		}
+		// failover is below retries, so that retried requests go to the next endpoint
+		inner = &failoverTransport{inner: inner, pool: c.endpoints, log: c.logger()}
+		c.endpoint = c.endpoints.primary()
+	}
+	retryOpts := append([]retryablehttp.Option{retryablehttp.WithLogger(c.logger())}, c.retryOpts...)
+	httpc.Transport = retryablehttp.NewTransport(inner, retryOpts...)
+
+	c.c = graphql.NewClient(c.endpoint, httpc)
+	return c
+}
+
+// GetBalance returns only balance and bonus points of the user. It's cheaper than GetClientInfo,
+// which also fetches subscriptions.
+func (c *Client) GetBalance(ctx context.Context) (Balance, error) {
+	var query struct {
+		Client []struct {
+			Balance float64
+			Bonus   int32
+		} `graphql:"client"`
+	}
+
+	if err := c.query(ctx, "client", &query, nil); err != nil {
+		return Balance{}, err
+	}
+
+	if len(query.Client) != 1 {
+		return Balance{}, fmt.Errorf("gira: expected 1 client info, got %d", len(query.Client))
+	}
+
+	return Balance{
+		Balance: MoneyFromEuros(query.Client[0].Balance),
+		Bonus:   int(query.Client[0].Bonus),
+	}, nil
+}
+
+func (c *Client) GetClientInfo(ctx context.Context) (ClientInfo, error) {
+	var query struct {
+		Client              []innerClientInfo         `graphql:"client"`
+		ActiveSubscriptions []innerClientSubscription `graphql:"activeSubscriptions"`
+	}
+
+	if err := c.query(ctx, "client", &query, nil); err != nil {
+		return ClientInfo{}, err
+	}
+
+	if len(query.Client) != 1 {
+		return ClientInfo{}, fmt.Errorf("gira: expected 1 client info, got %d", len(query.Client))
+	}
+
+	res := query.Client[0].export()
+	for _, s := range query.ActiveSubscriptions {
+		res.ActiveSubscriptions = append(res.ActiveSubscriptions, s.export())
+	}
+
+	return res, nil
+}
+
+// GetStations returns fresh list of all stations and updates station cache.
+// Concurrent calls are coalesced into one request, see StationCache.fetch.
+func (c *Client) GetStations(ctx context.Context) ([]Station, error) {
+	return c.cache.fetch(ctx, c.getStationsNoCache)
+}
+
+func (c *Client) getStationsNoCache(ctx context.Context) ([]Station, error) {
+	var query struct {
+		GetStations []innerStation
+	}
+	if err := c.query(ctx, "getStations", &query, nil); err != nil {
+		return nil, err
+	}
+
+	res := make([]Station, len(query.GetStations))
+	for i, station := range query.GetStations {
+		res[i] = station.export()
+	}
+	return res, nil
+}
+
+// GetStationDocks returns docks of the station with bikes in them. Docks fetched in the last few seconds
+// are reused and concurrent calls are coalesced, see DocksCache, unless WithNoCache is given.
+func (c *Client) GetStationDocks(ctx context.Context, id StationSerial, opts ...CallOption) (Docks, error) {
+	return c.docks.get(ctx, id, newCallOptions(opts).noCache, func(ctx context.Context) (Docks, error) {
+		return c.getStationDocksNoCache(ctx, id, opts...)
+	})
+}
+
+func (c *Client) getStationDocksNoCache(ctx context.Context, id StationSerial, opts ...CallOption) (Docks, error) {
+	var query struct {
+		GetDocks []innerDock `graphql:"getDocks(input: $input)"`
+		GetBikes []innerBike `graphql:"getBikes(input: $input)"`
+	}
+
+	err := c.query(ctx, "getDocks", &query, map[string]any{
+		"input": string(id),
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(Docks, 0, len(query.GetDocks))
+	for _, dock := range query.GetDocks {
+		res = append(res, dock.export())
+	}
+
+	for _, bike := range query.GetBikes {
+		b := bike.export()
+		found := false
+		for i, dock := range res {
+			if b.Parent == dock.Code {
+				found = true
+				b.DockNumber = dock.Number
+				res[i].Bike = &b
+				break
+			}
+		}
+
+		if !found {
+			// generally should be unreachable
+			c.logger().Warn("gira: bike without dock in station", "station", id, "bike", b.Serial, "parent", b.Parent)
+			res = append(res, Dock{
+				Code: b.Parent,
+				Bike: &b,
+			})
+		}
+	}
+
+	slices.SortFunc(res, func(i, j Dock) int {
+		return cmp.Compare(i.Number, j.Number)
+	})
+
+	return res, nil
+}
+
+// ReserveBike reserves the bike for the user, it has to be unlocked with StartTrip then.
+func (c *Client) ReserveBike(ctx context.Context, id BikeSerial, opts ...CallOption) (bool, error) {
+	var mutation struct {
+		ReserveBike bool `graphql:"reserveBike(input: $input)"`
+	}
+
+	if err := c.mutate(ctx, "reserveBike", &mutation, map[string]any{
+		"input": string(id),
+	}, opts...); err != nil {
+		return false, err
+	}
+
+	return mutation.ReserveBike, nil
+}
+
+func (c *Client) CancelBikeReserve(ctx context.Context, opts ...CallOption) (bool, error) {
+	var mutation struct {
+		CancelBikeReserve bool
+	}
+
+	if err := c.mutate(ctx, "cancelBikeReserve", &mutation, nil, opts...); err != nil {
+		return false, err
+	}
+
+	return mutation.CancelBikeReserve, nil
+}
+
+// StartTrip unlocks the reserved bike.
+func (c *Client) StartTrip(ctx context.Context, opts ...CallOption) (bool, error) {
+	var mutation struct {
+		StartTrip bool
+	}
+
+	if err := c.mutate(ctx, "startTrip", &mutation, nil, opts...); err != nil {
+		return false, err
+	}
+
+	return mutation.StartTrip, nil
+}
+
+func (c *Client) GetActiveTrip(ctx context.Context) (Trip, error) {
+	var query struct {
+		ActiveTrip *innerTrip
+	}
+
+	if err := c.query(ctx, "activeTrip", &query, nil); err != nil {
+		return Trip{}, err
+	}
+
+	if query.ActiveTrip == nil {
+		return Trip{}, ErrNoActiveTrip
+	}
+	return query.ActiveTrip.export(), nil
+}
+
+func (c *Client) GetTrip(ctx context.Context, code TripCode) (Trip, error) {
+	var query struct {
+		Trip []innerTrip `graphql:"getTrip(input: $input)"`
+	}
+
+	if err := c.query(ctx, "getTrip", &query, map[string]any{
+		"input": string(code),
+	}); err != nil {
+		return Trip{}, err
+	}
+
+	if len(query.Trip) == 0 {
+		return Trip{}, fmt.Errorf("gira: trip %s not found", code)
+	}
+	if len(query.Trip) > 1 {
+		return Trip{}, fmt.Errorf("gira: expected 1 trip, got %d", len(query.Trip))
+	}
+	return query.Trip[0].export(), nil
+}
+
+type pageInput struct {
+	PageNum  int32 `json:"_pageNum"`
+	PageSize int32 `json:"_pageSize"`
+}
+
+func (pageInput) GetGraphQLType() string {
+	return "PageInput"
+}
+
+func (c *Client) GetTripHistory(ctx context.Context, page, pageSize int) ([]Trip, error) {
+	var query struct {
+		TripHistory []innerTripDetail `graphql:"tripHistory(pageInput: $pageInput)"`
+	}
+
+	if err := c.query(ctx, "tripHistory", &query, map[string]any{
+		"pageInput": pageInput{
+			PageNum:  int32(page),
+			PageSize: int32(pageSize),
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	res := make([]Trip, len(query.TripHistory))
+	for i, trip := range query.TripHistory {
+		res[i] = trip.export()
+	}
+
+	if len(res) > 0 {
+		// station codes are nice to have, history is still useful without them
+		if stations, err := c.cachedStations(ctx); err != nil {
+			c.logger().Warn("gira: ignored trip history stations error", "error", err)
+		} else {
+			for i := range res {
+				resolveTripStations(stations, &res[i])
+			}
+		}
+	}
+	return res, nil
+}
+
+// resolveTripStations sets station codes of trip from history, which has only station names.
+// Names are matched to station names, falling back to station numbers, as formats might differ.
+func resolveTripStations(stations map[StationSerial]Station, t *Trip) {
+	if t.StartLocation == "" {
+		t.StartLocation = stationCodeByName(stations, t.StartLocationName)
+	}
+	if t.EndLocation == "" {
+		t.EndLocation = stationCodeByName(stations, t.EndLocationName)
+	}
+}
+
+func stationCodeByName(stations map[StationSerial]Station, name string) StationCode {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+
+	num := Station{Name: name}.Number()
+	var byNumber StationCode
+	for _, s := range stations {
+		if strings.EqualFold(s.Name, name) {
+			return s.Code
+		}
+		if num != "" && s.Number() == num {
+			byNumber = s.Code
+		}
+	}
+	return byNumber
+}
+
+func (c *Client) GetUnratedTrips(ctx context.Context, page, pageSize int) ([]Trip, error) {
+	var query struct {
+		UnratedTrips []innerTrip `graphql:"unratedTrips(pageInput: $pageInput)"`
+	}
+
+	if err := c.query(ctx, "unratedTrips", &query, map[string]any{
+		"pageInput": pageInput{
+			PageNum:  int32(page),
+			PageSize: int32(pageSize),
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	res := make([]Trip, len(query.UnratedTrips))
+	for i, trip := range query.UnratedTrips {
+		res[i] = trip.export()
+	}
+
+	return res, nil
+}
+
+type TripRating struct {
+	Rating  int
+	Comment string
+	// Attachment is an optional photo, e.g. of bike damage. It's not serialized, as it might be large.
+	Attachment *Attachment `json:"-"`
+}
+
+// Attachment is a file attached to trip rating.
+type Attachment struct {
+	FileName string
+	MimeType string
+	Data     []byte
+}
+
+func (c *Client) RateTrip(ctx context.Context, code TripCode, rating TripRating) (bool, error) {
+	//goland:noinspection ALL
+	type Attachment_In struct {
+		// Bytes is base64-encoded file contents
+		Bytes    string `graphql:"bytes" json:"bytes"`
+		FileName string `graphql:"fileName" json:"fileName"`
+		MimeType string `graphql:"mimeType" json:"mimeType"`
+	}
+
+	//goland:noinspection ALL
+	type RateTrip_In struct {
+		Code        string         `graphql:"code" json:"code"`
+		Rating      int            `graphql:"rating" json:"rating"`
+		Description string         `graphql:"description" json:"description"`
+		Attachment  *Attachment_In `graphql:"attachment" json:"attachment,omitempty"`
+	}
+
+	var mutation struct {
+		RateTrip bool `graphql:"rateTrip(in: $in)"`
+	}
+
+	in := RateTrip_In{
+		Code:        string(code),
+		Rating:      rating.Rating,
+		Description: rating.Comment,
+	}
+	if a := rating.Attachment; a != nil {
+		in.Attachment = &Attachment_In{
+			Bytes:    base64.StdEncoding.EncodeToString(a.Data),
+			FileName: a.FileName,
+			MimeType: a.MimeType,
+		}
+	}
+
+	if err := c.mutate(ctx, "rateTrip", &mutation, map[string]any{
+		"in": in,
+	}); err != nil {
+		return false, err
+	}
+
+	return mutation.RateTrip, nil
+}
+
+func (c *Client) PayTripWithPoints(ctx context.Context, id TripCode) (int, error) {
+	var mutation struct {
+		TripPay int `graphql:"tripPayWithPoints(input: $input)"`
+	}
+
+	if err := c.mutate(ctx, "tripPayWithPoints", &mutation, map[string]any{
+		"input": string(id),
+	}); err != nil {
+		return 0, err
+	}
+
+	return mutation.TripPay, nil
+}
+
+func (c *Client) PayTripWithMoney(ctx context.Context, id TripCode) (int, error) {
+	var mutation struct {
+		TripPay int `graphql:"tripPayWithNoPoints(input: $input)"`
+	}
+
+	if err := c.mutate(ctx, "tripPayWithNoPoints", &mutation, map[string]any{
+		"input": string(id),
+	}); err != nil {
+		return 0, err
+	}
+
+	return mutation.TripPay, nil
+}
+
+// unwrapError returns GiraError for known backend errors in err, or err itself. Backend errors are counted
+// by code, so that it's visible which ones users hit most.
+func unwrapError(err error) error {
+	var errs graphql.Errors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	for _, err := range errs {
+		// graphql library wraps http bad request errors into that type,
+		// and body is accessible only on concrete type and not in .Error()
+		var nerErr graphql.NetworkError
+		if errors.As(err.Unwrap(), &nerErr) {
+			// if there is a gira backend error, ignore all others added by graphql lib
+			if giraErr := parseTripErrorMessage(nerErr.Body()); giraErr != nil {
+				backendErrorsCnt.WithLabelValues(string(ErrorCodeOf(giraErr))).Inc()
+				return giraErr
+			}
+		}
+	}
+	backendErrorsCnt.WithLabelValues(backendErrorUnrecognized).Inc()
+	return err
+}
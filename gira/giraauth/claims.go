@@ -0,0 +1,66 @@
+package giraauth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("giraauth: invalid access token")
+
+// Claims are the claims of Gira access token which clients rely on.
+type Claims struct {
+	// Subject is ID of the user token belongs to, a UUID.
+	Subject string
+	// ID is unique ID of the token, the "jti" claim.
+	ID        string
+	ExpiresAt time.Time
+}
+
+// ParseClaims parses claims of Gira access token and checks that sub, jti and exp are present and
+// well-formed. Signature is not verified, as the key is not public, so claims must not be trusted
+// for authorization, verify the token with Client.UserID for that. Expiry is not checked either,
+// it's up to the caller.
+func ParseClaims(token string) (Claims, error) {
+	var rc jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &rc); err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	switch {
+	case !isUUID(rc.Subject):
+		return Claims{}, fmt.Errorf("%w: sub claim %q is not a UUID", ErrInvalidToken, rc.Subject)
+	case len(rc.ID) < 16:
+		return Claims{}, fmt.Errorf("%w: jti claim is too short", ErrInvalidToken)
+	case rc.ExpiresAt == nil:
+		return Claims{}, fmt.Errorf("%w: exp claim is missing", ErrInvalidToken)
+	}
+
+	return Claims{
+		Subject:   rc.Subject,
+		ID:        rc.ID,
+		ExpiresAt: rc.ExpiresAt.Time,
+	}, nil
+}
+
+// isUUID returns whether s is a UUID in canonical form, like 45e33173-2943-47ae-92de-59afbcab4c4c.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
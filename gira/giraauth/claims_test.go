@@ -0,0 +1,45 @@
+package giraauth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseClaims(t *testing.T) {
+	const (
+		sub = "45e33173-2943-47ae-92de-59afbcab4c4c"
+		jti = "3ebb9117-7150-4547-8cca-f51fd6e55f46"
+	)
+	exp := time.Unix(1700000000, 0)
+
+	sign := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	got, err := ParseClaims(sign(jwt.MapClaims{"sub": sub, "jti": jti, "exp": exp.Unix()}))
+	if err != nil {
+		t.Fatalf("ParseClaims: %v", err)
+	}
+	if got.Subject != sub || got.ID != jti || !got.ExpiresAt.Equal(exp) {
+		t.Errorf("ParseClaims = %+v, want sub %s, jti %s, exp %v", got, sub, jti, exp)
+	}
+
+	for name, token := range map[string]string{
+		"not a jwt":   "garbage",
+		"no sub":      sign(jwt.MapClaims{"jti": jti, "exp": exp.Unix()}),
+		"bad sub":     sign(jwt.MapClaims{"sub": "45e33173", "jti": jti, "exp": exp.Unix()}),
+		"short jti":   sign(jwt.MapClaims{"sub": sub, "jti": "abc", "exp": exp.Unix()}),
+		"missing exp": sign(jwt.MapClaims{"sub": sub, "jti": jti}),
+	} {
+		if _, err := ParseClaims(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: ParseClaims error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
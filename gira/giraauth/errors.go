@@ -0,0 +1,126 @@
+package giraauth
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrInternalServer      = fmt.Errorf("giraauth: internal server error")
+	ErrInvalidEmail        = fmt.Errorf("giraauth: invalid email")
+	ErrInvalidCredentials  = fmt.Errorf("giraauth: invalid credentials")
+	ErrInvalidRefreshToken = fmt.Errorf("giraauth: invalid refresh token")
+	ErrUnauthorized        = fmt.Errorf("giraauth: unauthorized")
+)
+
+// ErrorCode is a stable code of auth API error.
+type ErrorCode string
+
+const (
+	CodeInternalServer      ErrorCode = "internal_server"
+	CodeInvalidEmail        ErrorCode = "invalid_email"
+	CodeInvalidCredentials  ErrorCode = "invalid_credentials"
+	CodeInvalidRefreshToken ErrorCode = "invalid_refresh_token"
+	CodeExpiredRefreshToken ErrorCode = "expired_refresh_token"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	// CodeUnknown is any other error, see AuthError.Message for details.
+	CodeUnknown ErrorCode = "unknown"
+)
+
+// AuthError is an error returned by auth API. It matches the corresponding sentinel error
+// like ErrInvalidCredentials with errors.Is, expired refresh token matches ErrInvalidRefreshToken.
+type AuthError struct {
+	Code    ErrorCode
+	Message string
+	// Status is HTTP status code of the response.
+	Status int
+	// APICode is the code from error envelope of the response, if there was one.
+	APICode int
+}
+
+func (e *AuthError) Error() string {
+	if e.APICode != 0 {
+		return fmt.Sprintf("giraauth: %s (%d)", e.Message, e.APICode)
+	}
+	return "giraauth: " + e.Message
+}
+
+// Is makes AuthError match sentinel error of its code.
+func (e *AuthError) Is(target error) bool {
+	switch e.Code {
+	case CodeInternalServer:
+		return target == ErrInternalServer
+	case CodeInvalidEmail:
+		return target == ErrInvalidEmail
+	case CodeInvalidCredentials:
+		return target == ErrInvalidCredentials
+	case CodeInvalidRefreshToken, CodeExpiredRefreshToken:
+		return target == ErrInvalidRefreshToken
+	case CodeUnauthorized:
+		return target == ErrUnauthorized
+	}
+	return false
+}
+
+// errorEnvelope is the error part of auth API responses.
+type errorEnvelope struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	// Message is set instead of Error by some endpoints
+	Message string `json:"message"`
+	// Errors are validation errors of request fields, e.g. {"Email": ["The field Email must be..."]}
+	Errors map[string][]string `json:"errors"`
+}
+
+// parseError returns AuthError if the response is an error, or nil. Response might be not JSON,
+// then it's an error only if status is not OK.
+func parseError(status int, body []byte) *AuthError {
+	var env errorEnvelope
+	isJSON := json.Unmarshal(body, &env) == nil
+
+	e := &AuthError{
+		Status:  status,
+		APICode: env.Error.Code,
+		Message: cmp.Or(env.Error.Message, env.Message, strings.TrimSpace(string(body))),
+	}
+
+	switch {
+	case status == http.StatusInternalServerError:
+		e.Code = CodeInternalServer
+		e.Message = "internal server error"
+	case status == http.StatusUnauthorized:
+		e.Code = CodeUnauthorized
+	case len(env.Errors["Email"]) > 0:
+		e.Code = CodeInvalidEmail
+		e.Message = env.Errors["Email"][0]
+	case strings.HasPrefix(e.Message, "Invalid refresh token"):
+		e.Code = CodeInvalidRefreshToken
+	case strings.HasPrefix(e.Message, "Expired refresh token"):
+		e.Code = CodeExpiredRefreshToken
+	case env.Error.Code == 100 && env.Error.Message == "Invalid credentials.":
+		e.Code = CodeInvalidCredentials
+	case status != http.StatusOK:
+		e.Code = CodeUnknown
+		e.Message = fmt.Sprintf("http %d '%s'", status, e.Message)
+	case isJSON && env.Error.Code != 0:
+		e.Code = CodeUnknown
+	default:
+		return nil
+	}
+	return e
+}
+
+// CodeOf returns code of auth API error in err's chain, or empty string if there's none.
+func CodeOf(err error) ErrorCode {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr.Code
+	}
+	return ""
+}
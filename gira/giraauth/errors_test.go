@@ -0,0 +1,40 @@
+package giraauth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		body   string
+		want   ErrorCode
+		is     error
+	}{
+		{200, `{"data": {"accessToken": "a"}}`, "", nil},
+		{200, `{"error": {"code": 100, "message": "Invalid credentials."}}`, CodeInvalidCredentials, ErrInvalidCredentials},
+		{200, `{"error": {"code": 42, "message": "Something else"}}`, CodeUnknown, nil},
+		{400, `{"error": {"code": 0, "message": "Invalid refresh token"}}`, CodeInvalidRefreshToken, ErrInvalidRefreshToken},
+		{400, `Expired refresh token`, CodeExpiredRefreshToken, ErrInvalidRefreshToken},
+		{400, `{"errors": {"Email": ["The field Email must be a valid email"]}}`, CodeInvalidEmail, ErrInvalidEmail},
+		{401, ``, CodeUnauthorized, ErrUnauthorized},
+		{500, `oops`, CodeInternalServer, ErrInternalServer},
+		{502, `<html>bad gateway</html>`, CodeUnknown, nil},
+	} {
+		err := parseError(tt.status, []byte(tt.body))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("parseError(%d, %s) = %v, want nil", tt.status, tt.body, err)
+			}
+			continue
+		}
+		if err == nil || err.Code != tt.want {
+			t.Errorf("parseError(%d, %s) = %v, want code %s", tt.status, tt.body, err, tt.want)
+			continue
+		}
+		if tt.is != nil && !errors.Is(err, tt.is) {
+			t.Errorf("parseError(%d, %s) = %v, want it to match %v", tt.status, tt.body, err, tt.is)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package giraauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+type Client struct {
+	httpc *http.Client
+	// userIDs is optional cache of UserID results, see WithUserIDCache
+	userIDs *UserIDCache
+}
+
+// Policy is retry policy of idempotent calls like Refresh and User. Token refresh should survive a short
+// backend blip, as failed refresh logs user out, but users wait for these calls, so it's shorter than
+// retryablehttp.DefaultPolicy. Other calls are never retried, see apiCall.
+var Policy = retryablehttp.Policy{
+	Attempts:       4,
+	AttemptTimeout: 10 * time.Second,
+	BaseDelay:      500 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// New returns a client which uses httpc for requests, opts configure its retrying transport.
+func New(httpc *http.Client, opts ...retryablehttp.Option) *Client {
+	client := *httpc
+	opts = append([]retryablehttp.Option{retryablehttp.WithPolicy(Policy)}, opts...)
+	client.Transport = retryablehttp.NewTransport(httpc.Transport, opts...)
+
+	return &Client{httpc: &client}
+}
+
+type tokens struct {
+	Access  string `json:"accessToken"`
+	Refresh string `json:"refreshToken"`
+}
+
+func (c Client) Login(ctx context.Context, email, password string) (*oauth2.Token, error) {
+	reqData := map[string]any{
+		"Provider": "EmailPassword",
+		"CredentialsEmailPassword": map[string]string{
+			"Email":    email,
+			"Password": password,
+		},
+	}
+
+	var respData struct {
+		Data tokens `json:"data"`
+	}
+
+	if err := c.apiCall(ctx, opLogin, false, http.MethodPost, "/auth", nil, reqData, &respData); err != nil {
+		return nil, err
+	}
+
+	return convertTokens(respData.Data)
+}
+
+func (c Client) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	reqData := map[string]any{
+		"Token": refreshToken,
+	}
+
+	var respData struct {
+		Data tokens `json:"data"`
+	}
+
+	// retried even though a lost response might have rotated the token, failed refresh logs user out anyway
+	if err := c.apiCall(ctx, opRefresh, true, http.MethodPost, "/token/refresh", nil, reqData, &respData); err != nil {
+		return nil, err
+	}
+
+	return convertTokens(respData.Data)
+}
+
+// Logout revokes refreshToken on the server, so that it can't be used to get new access tokens.
+// Already issued access tokens stay valid until they expire in a few minutes. Token which is already
+// invalid is not an error, as the result is the same.
+func (c Client) Logout(ctx context.Context, refreshToken string) error {
+	reqData := map[string]any{
+		"Token": refreshToken,
+	}
+
+	err := c.apiCall(ctx, opLogout, false, http.MethodPost, "/token/revoke", nil, reqData, nil)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil
+	}
+	return err
+}
+
+// RequestPasswordReset asks the server to send a password reset link to email,
+// the same as "forgot password" in the official app.
+func (c Client) RequestPasswordReset(ctx context.Context, email string) error {
+	reqData := map[string]any{
+		"Email": email,
+	}
+
+	return c.apiCall(ctx, opPasswordReset, false, http.MethodPost, "/password/reset", nil, reqData, nil)
+}
+
+// UserField selects optional fields of user profile returned by Client.User.
+type UserField uint
+
+const (
+	UserName UserField = 1 << iota
+	UserEmail
+	UserPhone
+	UserNavegante
+	UserFiscalNumber
+
+	UserAllFields = UserName | UserEmail | UserPhone | UserNavegante | UserFiscalNumber
+)
+
+// User is a profile of Gira user. Only ID is always set, other fields are personal data,
+// so they are set only if requested, to keep them from spreading around by accident.
+type User struct {
+	ID              string
+	Name            string
+	Email           string
+	Phone           string
+	NaveganteNumber string
+	FiscalNumber    string
+}
+
+// User returns profile of the user token belongs to, with the ID and requested fields.
+func (c Client) User(ctx context.Context, token string, fields UserField) (User, error) {
+	var respData struct {
+		Data struct {
+			ID              string `json:"id"`
+			Name            string `json:"name"`
+			Email           string `json:"email"`
+			Phone           string `json:"phone"`
+			NumberNavegante string `json:"numberNavegante"`
+			FiscalNumber    string `json:"fiscalNumber"`
+		} `json:"data"`
+	}
+
+	hdr := http.Header{
+		"Authorization": []string{"Bearer " + token},
+	}
+	if err := c.apiCall(ctx, opUser, true, http.MethodGet, "/user", hdr, nil, &respData); err != nil {
+		return User{}, err
+	}
+
+	d := respData.Data
+	u := User{ID: d.ID}
+	for _, f := range []struct {
+		field UserField
+		dst   *string
+		val   string
+	}{
+		{UserName, &u.Name, d.Name},
+		{UserEmail, &u.Email, d.Email},
+		{UserPhone, &u.Phone, d.Phone},
+		{UserNavegante, &u.NaveganteNumber, d.NumberNavegante},
+		{UserFiscalNumber, &u.FiscalNumber, d.FiscalNumber},
+	} {
+		if fields&f.field != 0 {
+			*f.dst = f.val
+		}
+	}
+	return u, nil
+}
+
+// UserID returns ID of the user token belongs to. Results are cached if the client has UserIDCache.
+func (c Client) UserID(ctx context.Context, token string) (string, error) {
+	if c.userIDs != nil {
+		if id, ok := c.userIDs.get(token); ok {
+			return id, nil
+		}
+	}
+
+	u, err := c.User(ctx, token, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if c.userIDs != nil {
+		c.userIDs.put(token, u.ID)
+	}
+	return u.ID, nil
+}
+
+func convertTokens(ts tokens) (*oauth2.Token, error) {
+	claims, err := ParseClaims(ts.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{
+		AccessToken:  ts.Access,
+		RefreshToken: ts.Refresh,
+		Expiry:       claims.ExpiresAt,
+	}, nil
+}
+
+// tracer uses global tracer provider, so spans are no-op unless the app sets one up.
+var tracer = otel.Tracer("github.com/ilyaluk/girabot/gira/giraauth")
+
+// apiCall sends request to auth API and decodes response into respVal. Idempotent calls are retried
+// according to Policy, on 5xx responses and network errors. Others are sent once, as e.g. repeated
+// password reset sends several emails. Metrics are recorded under op name.
+func (c Client) apiCall(ctx context.Context, op string, idempotent bool, method, api string, headers http.Header, reqVal, respVal any) (err error) {
+	if idempotent {
+		ctx = retryablehttp.WithIdempotent(ctx)
+	} else {
+		ctx = retryablehttp.WithoutRetries(ctx)
+	}
+
+	ctx, span := tracer.Start(ctx, "giraauth"+strings.ReplaceAll(api, "/", "."), trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	defer func() {
+		observeOperation(op, start, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var reqData []byte
+	if reqVal != nil {
+		reqData, err = json.Marshal(reqVal)
+		if err != nil {
+			return fmt.Errorf("giraauth: marshaling request: %w", err)
+		}
+	}
+
+	path := fmt.Sprintf("https://c2g091p01.emel.pt/auth%s", api)
+	req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewBuffer(reqData))
+	if err != nil {
+		return fmt.Errorf("giraauth: creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gira/3.4.3 (Android 34)")
+
+	for k, v := range headers {
+		req.Header.Set(k, v[0])
+	}
+
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return fmt.Errorf("giraauth: performing request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("giraauth: reading body: %w", err)
+	}
+
+	if authErr := parseError(resp.StatusCode, body); authErr != nil {
+		return authErr
+	}
+
+	if respVal != nil {
+		return json.NewDecoder(bytes.NewBuffer(body)).Decode(respVal)
+	}
+
+	return nil
+}
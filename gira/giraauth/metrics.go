@@ -0,0 +1,52 @@
+package giraauth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	opDurationHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "giraauth_operation_duration_seconds",
+		// includes retries of idempotent calls
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation", "outcome"})
+	opCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "giraauth_operations_total"}, []string{"operation", "outcome"})
+)
+
+// Operation names used as metric labels.
+const (
+	opLogin         = "login"
+	opRefresh       = "refresh"
+	opLogout        = "logout"
+	opPasswordReset = "password_reset"
+	opUser          = "user"
+)
+
+// outcome returns a low-cardinality label for the result: "ok", auth error code, or kind of other error.
+func outcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if code := CodeOf(err); code != "" {
+		return string(code)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "other"
+}
+
+// observeOperation records latency and outcome of the operation started at start.
+func observeOperation(op string, start time.Time, err error) {
+	o := outcome(err)
+	opCnt.WithLabelValues(op, o).Inc()
+	opDurationHist.WithLabelValues(op, o).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,25 @@
+package giraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOutcome(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{&AuthError{Code: CodeExpiredRefreshToken}, "expired_refresh_token"},
+		{fmt.Errorf("giraauth: performing request: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.New("connection reset"), "other"},
+	} {
+		if got := outcome(tt.err); got != tt.want {
+			t.Errorf("outcome(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package giraauth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// UserIDCache keeps user IDs of verified access tokens, so that repeated verification of the same token
+// with Client.UserID doesn't call the API. It's safe for concurrent use.
+type UserIDCache struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	// entries are keyed by token hash, so that tokens aren't kept in memory
+	entries   map[[sha256.Size]byte]userIDEntry
+	lastSweep time.Time
+}
+
+type userIDEntry struct {
+	id        string
+	expiresAt time.Time
+}
+
+// NewUserIDCache returns an empty cache, which keeps user ID for ttl after verification,
+// but not after the token expires.
+func NewUserIDCache(ttl time.Duration) *UserIDCache {
+	return &UserIDCache{
+		ttl:     ttl,
+		entries: make(map[[sha256.Size]byte]userIDEntry),
+	}
+}
+
+// WithUserIDCache returns a copy of the client which uses cache in UserID.
+func (c Client) WithUserIDCache(cache *UserIDCache) *Client {
+	c.userIDs = cache
+	return &c
+}
+
+func (uc *UserIDCache) get(token string) (string, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	e, ok := uc.entries[sha256.Sum256([]byte(token))]
+	if !ok || time.Now().After(e.expiresAt) {
+		return "", false
+	}
+	return e.id, true
+}
+
+func (uc *UserIDCache) put(token, id string) {
+	now := time.Now()
+	expiresAt := now.Add(uc.ttl)
+	if claims, err := ParseClaims(token); err == nil && claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	// access tokens are short-lived and never seen again after expiry, drop them once in a while
+	if now.Sub(uc.lastSweep) > uc.ttl {
+		for k, e := range uc.entries {
+			if now.After(e.expiresAt) {
+				delete(uc.entries, k)
+			}
+		}
+		uc.lastSweep = now
+	}
+
+	uc.entries[sha256.Sum256([]byte(token))] = userIDEntry{id: id, expiresAt: expiresAt}
+}
@@ -0,0 +1,64 @@
+package giraauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestUserIDCache(t *testing.T) {
+	var calls int
+	httpc := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"data": {"id": "user-1"}}`)),
+		}, nil
+	})}
+	c := New(httpc).WithUserIDCache(NewUserIDCache(time.Minute))
+
+	sign := func(exp time.Time) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+			"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+			"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+			"exp": exp.Unix(),
+		}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := sign(time.Now().Add(2 * time.Minute))
+	expired := sign(time.Now().Add(-time.Second))
+
+	for _, tt := range []struct {
+		token     string
+		wantCalls int
+	}{
+		{valid, 1},
+		{valid, 1},
+		// cache is bound by token expiry
+		{expired, 2},
+		{expired, 3},
+	} {
+		id, err := c.UserID(context.Background(), tt.token)
+		if err != nil {
+			t.Fatalf("UserID: %v", err)
+		}
+		if id != "user-1" {
+			t.Errorf("UserID = %q, want user-1", id)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+		}
+	}
+}
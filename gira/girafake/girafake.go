@@ -0,0 +1,383 @@
+// Package girafake is an in-memory implementation of gira.API for tests.
+// It keeps just enough state to walk through reserve, trip, rate and pay flows.
+package girafake
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// pointsPerEuro is how many points are charged per euro when paying with points.
+const pointsPerEuro = 500
+
+// Client is a fake Gira client. Exported fields can be set up before use,
+// and inspected afterwards, methods are safe for concurrent use.
+type Client struct {
+	mu sync.Mutex
+
+	ClientInfo gira.ClientInfo
+	Stations   []gira.Station
+	Docks      map[gira.StationSerial]gira.Docks
+	// Trips is trip history, newest first.
+	Trips []gira.Trip
+	// ActiveTrip is the current trip, if any.
+	ActiveTrip *gira.Trip
+	// Reserved is the serial of reserved bike, if any.
+	Reserved gira.BikeSerial
+	// ServiceStatus is returned by GetServiceStatus, zero value is operational.
+	ServiceStatus gira.ServiceStatus
+	// Messages are announcements, only active ones are returned by GetMessages.
+	Messages []gira.Message
+	// PingErr is returned by Ping.
+	PingErr error
+
+	tripNum int
+}
+
+var _ gira.API = (*Client)(nil)
+
+// New returns an empty fake client.
+func New() *Client {
+	return &Client{Docks: map[gira.StationSerial]gira.Docks{}}
+}
+
+// AddStation adds station with docks, bikes in docks get dock numbers and parents set.
+func (c *Client) AddStation(s gira.Station, docks gira.Docks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	docks = slices.Clone(docks)
+	s.Docks = len(docks)
+	s.Bikes = 0
+	for i, d := range docks {
+		docks[i].Parent = s.Code
+		if d.Bike != nil {
+			b := *d.Bike
+			b.Parent = d.Code
+			b.DockNumber = d.Number
+			docks[i].Bike = &b
+			s.Bikes++
+		}
+	}
+
+	c.Stations = append(c.Stations, s)
+	c.Docks[s.Serial] = docks
+}
+
+// FinishTrip ends the active trip at station with the given cost, and moves it to history.
+func (c *Client) FinishTrip(end gira.StationCode, cost gira.Money) (gira.Trip, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ActiveTrip == nil {
+		return gira.Trip{}, gira.ErrNoActiveTrip
+	}
+
+	t := *c.ActiveTrip
+	t.EndLocation = end
+	t.EndDate = time.Now()
+	t.Cost = cost
+	t.TripStatus = "finished"
+	c.Trips = append([]gira.Trip{t}, c.Trips...)
+	c.ActiveTrip = nil
+	return t, nil
+}
+
+func (c *Client) GetClientInfo(context.Context) (gira.ClientInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ClientInfo, nil
+}
+
+func (c *Client) GetBalance(context.Context) (gira.Balance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return gira.Balance{Balance: c.ClientInfo.Balance, Bonus: c.ClientInfo.Bonus}, nil
+}
+
+func (c *Client) GetServiceStatus(context.Context) (gira.ServiceStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ServiceStatus, nil
+}
+
+func (c *Client) Ping(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.PingErr
+}
+
+func (c *Client) GetMessages(context.Context) ([]gira.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var res []gira.Message
+	for _, m := range c.Messages {
+		if m.ActiveAt(now) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (c *Client) GetStations(context.Context) ([]gira.Station, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.Stations), nil
+}
+
+func (c *Client) GetStationCached(_ context.Context, serial gira.StationSerial) (gira.Station, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.Stations {
+		if s.Serial == serial {
+			return s, nil
+		}
+	}
+	return gira.Station{}, fmt.Errorf("girafake: station %s not found", serial)
+}
+
+func (c *Client) GetStationByCodeCached(_ context.Context, code gira.StationCode) (gira.Station, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.Stations {
+		if s.Code == code {
+			return s, nil
+		}
+	}
+	return gira.Station{}, fmt.Errorf("girafake: station with code %s not found", code)
+}
+
+func (c *Client) GetStationDocks(_ context.Context, id gira.StationSerial, _ ...gira.CallOption) (gira.Docks, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	docks, ok := c.Docks[id]
+	if !ok {
+		return nil, fmt.Errorf("girafake: station %s not found", id)
+	}
+	res := slices.Clone(docks)
+	for i, d := range res {
+		if d.Bike != nil {
+			b := *d.Bike
+			res[i].Bike = &b
+		}
+	}
+	return res, nil
+}
+
+// findBike returns station and dock index of the bike, it assumes the caller has locked mu.
+func (c *Client) findBike(id gira.BikeSerial) (gira.Station, int, bool) {
+	for _, s := range c.Stations {
+		for i, d := range c.Docks[s.Serial] {
+			if d.Bike != nil && d.Bike.Serial == id {
+				return s, i, true
+			}
+		}
+	}
+	return gira.Station{}, 0, false
+}
+
+func (c *Client) FindBike(_ context.Context, id string) (gira.BikeLocation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.Stations {
+		for _, d := range c.Docks[s.Serial] {
+			if d.Bike != nil && (string(d.Bike.Serial) == id || strings.EqualFold(d.Bike.Name, id)) {
+				now := time.Now()
+				return gira.BikeLocation{Bike: *d.Bike, Station: s, Dock: d.Serial, SeenAt: now, ChangedAt: now}, nil
+			}
+		}
+	}
+	return gira.BikeLocation{}, gira.ErrBikeNotFound
+}
+
+func (c *Client) ReserveBike(_ context.Context, id gira.BikeSerial, _ ...gira.CallOption) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ActiveTrip != nil {
+		return false, gira.ErrAlreadyHasActiveTrip
+	}
+	if c.Reserved != "" {
+		return false, gira.ErrBikeAlreadyReserved
+	}
+	if _, _, ok := c.findBike(id); !ok {
+		return false, nil
+	}
+
+	c.Reserved = id
+	return true, nil
+}
+
+func (c *Client) CancelBikeReserve(context.Context, ...gira.CallOption) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Reserved == "" {
+		return false, nil
+	}
+	c.Reserved = ""
+	return true, nil
+}
+
+func (c *Client) StartTrip(context.Context, ...gira.CallOption) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Reserved == "" {
+		return false, nil
+	}
+	s, i, ok := c.findBike(c.Reserved)
+	if !ok {
+		return false, nil
+	}
+
+	docks := c.Docks[s.Serial]
+	bike := docks[i].Bike
+	docks[i].Bike = nil
+	for j := range c.Stations {
+		if c.Stations[j].Serial == s.Serial {
+			c.Stations[j].Bikes--
+		}
+	}
+
+	c.tripNum++
+	c.ActiveTrip = &gira.Trip{
+		Code:          gira.TripCode(fmt.Sprintf("trip-%d", c.tripNum)),
+		TripStatus:    "active",
+		User:          c.ClientInfo.Code,
+		Client:        c.ClientInfo.Code,
+		BikeCode:      bike.Code,
+		BikeName:      bike.Name,
+		StartLocation: s.Code,
+		StartDate:     time.Now(),
+	}
+	c.Reserved = ""
+	return true, nil
+}
+
+func (c *Client) GetActiveTrip(context.Context) (gira.Trip, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ActiveTrip == nil {
+		return gira.Trip{}, gira.ErrNoActiveTrip
+	}
+	return *c.ActiveTrip, nil
+}
+
+// findTrip returns index of the trip in history, it assumes the caller has locked mu.
+func (c *Client) findTrip(code gira.TripCode) (int, error) {
+	i := slices.IndexFunc(c.Trips, func(t gira.Trip) bool { return t.Code == code })
+	if i == -1 {
+		return 0, fmt.Errorf("girafake: trip %s not found", code)
+	}
+	return i, nil
+}
+
+func (c *Client) GetTrip(_ context.Context, code gira.TripCode) (gira.Trip, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ActiveTrip != nil && c.ActiveTrip.Code == code {
+		return *c.ActiveTrip, nil
+	}
+	i, err := c.findTrip(code)
+	if err != nil {
+		return gira.Trip{}, err
+	}
+	return c.Trips[i], nil
+}
+
+// page returns 1-based page of trips.
+func page(trips []gira.Trip, page, pageSize int) []gira.Trip {
+	start := (page - 1) * pageSize
+	if page < 1 || pageSize < 1 || start >= len(trips) {
+		return []gira.Trip{}
+	}
+	return slices.Clone(trips[start:min(start+pageSize, len(trips))])
+}
+
+func (c *Client) GetTripHistory(_ context.Context, p, pageSize int) ([]gira.Trip, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return page(c.Trips, p, pageSize), nil
+}
+
+func (c *Client) GetUnratedTrips(_ context.Context, p, pageSize int) ([]gira.Trip, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unrated []gira.Trip
+	for _, t := range c.Trips {
+		if t.Rating == 0 {
+			unrated = append(unrated, t)
+		}
+	}
+	return page(unrated, p, pageSize), nil
+}
+
+func (c *Client) RateTrip(_ context.Context, code gira.TripCode, rating gira.TripRating) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.findTrip(code)
+	if err != nil {
+		return false, nil
+	}
+	c.Trips[i].Rating = rating.Rating
+	c.Trips[i].Comment = rating.Comment
+	if rating.Attachment != nil {
+		c.Trips[i].Photo = rating.Attachment.FileName
+	}
+	return true, nil
+}
+
+func (c *Client) PayTripWithPoints(_ context.Context, id gira.TripCode) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.findTrip(id)
+	if err != nil {
+		return 0, err
+	}
+	points := int(math.Ceil(c.Trips[i].Cost.Euros())) * pointsPerEuro
+	if c.ClientInfo.Bonus < points {
+		return 0, gira.ErrNotEnoughBalance
+	}
+
+	c.ClientInfo.Bonus -= points
+	c.Trips[i].CostBonus += points
+	c.Trips[i].Cost = 0
+	return points, nil
+}
+
+func (c *Client) PayTripWithMoney(_ context.Context, id gira.TripCode) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.findTrip(id)
+	if err != nil {
+		return 0, err
+	}
+	cost := c.Trips[i].Cost
+	if c.ClientInfo.Balance < cost {
+		return 0, gira.ErrNotEnoughBalance
+	}
+
+	c.ClientInfo.Balance -= cost
+	c.Trips[i].Cost = 0
+	return int(math.Ceil(cost.Euros())), nil
+}
@@ -0,0 +1,72 @@
+package gira
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// ErrInvalidPageSize is yielded by IterTripHistory if page size is not positive.
+var ErrInvalidPageSize = fmt.Errorf("gira: page size must be positive")
+
+// tripsBetweenPageSize is history page size used by GetTripsBetween.
+const tripsBetweenPageSize = 50
+
+// IterTripHistory returns an iterator over all trips in history of api's user, newest first.
+// Pages of pageSize trips are fetched lazily, until a short page is returned. On error it's
+// yielded with zero Trip, and iteration stops. ErrInvalidPageSize is yielded if pageSize <= 0.
+func IterTripHistory(ctx context.Context, api API, pageSize int) iter.Seq2[Trip, error] {
+	return func(yield func(Trip, error) bool) {
+		if pageSize <= 0 {
+			yield(Trip{}, ErrInvalidPageSize)
+			return
+		}
+
+		for page := 1; ; page++ {
+			trips, err := api.GetTripHistory(ctx, page, pageSize)
+			if err != nil {
+				yield(Trip{}, err)
+				return
+			}
+
+			for _, t := range trips {
+				if !yield(t, nil) {
+					return
+				}
+			}
+
+			if len(trips) < pageSize {
+				return
+			}
+		}
+	}
+}
+
+// TripHistoryIter is IterTripHistory for the client.
+func (c *Client) TripHistoryIter(ctx context.Context, pageSize int) iter.Seq2[Trip, error] {
+	return IterTripHistory(ctx, c, pageSize)
+}
+
+// TripsBetween returns trips started in [from, to), newest first. History has no server-side
+// date filter, so it's paged through until trips older than from.
+func TripsBetween(ctx context.Context, api API, from, to time.Time, pageSize int) ([]Trip, error) {
+	var res []Trip
+	for t, err := range IterTripHistory(ctx, api, pageSize) {
+		if err != nil {
+			return nil, err
+		}
+		if t.StartDate.Before(from) {
+			break
+		}
+		if t.StartDate.Before(to) {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+// GetTripsBetween is TripsBetween for the client.
+func (c *Client) GetTripsBetween(ctx context.Context, from, to time.Time) ([]Trip, error) {
+	return TripsBetween(ctx, c, from, to, tripsBetweenPageSize)
+}
@@ -0,0 +1,97 @@
+package gira_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/girafake"
+)
+
+func TestIterTripHistory(t *testing.T) {
+	ctx := context.Background()
+
+	for _, n := range []int{0, 3, 4, 7} {
+		g := girafake.New()
+		for i := range n {
+			g.Trips = append(g.Trips, gira.Trip{Code: gira.TripCode(fmt.Sprint(i))})
+		}
+
+		var got int
+		for trip, err := range gira.IterTripHistory(ctx, g, 2) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := gira.TripCode(fmt.Sprint(got)); trip.Code != want {
+				t.Errorf("n=%d: trip %d code = %s, want %s", n, got, trip.Code, want)
+			}
+			got++
+		}
+		if got != n {
+			t.Errorf("n=%d: iterated %d trips", n, got)
+		}
+	}
+}
+
+func TestIterTripHistoryBreak(t *testing.T) {
+	g := girafake.New()
+	for i := range 10 {
+		g.Trips = append(g.Trips, gira.Trip{Code: gira.TripCode(fmt.Sprint(i))})
+	}
+
+	var got int
+	for range gira.IterTripHistory(context.Background(), g, 3) {
+		got++
+		if got == 4 {
+			break
+		}
+	}
+	if got != 4 {
+		t.Errorf("iterated %d trips, want 4", got)
+	}
+}
+
+func TestIterTripHistoryInvalidPageSize(t *testing.T) {
+	g := girafake.New()
+	g.Trips = []gira.Trip{{Code: "1"}}
+
+	for _, size := range []int{0, -1} {
+		var errs []error
+		for _, err := range gira.IterTripHistory(context.Background(), g, size) {
+			errs = append(errs, err)
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], gira.ErrInvalidPageSize) {
+			t.Errorf("pageSize=%d: got %v, want single ErrInvalidPageSize", size, errs)
+		}
+	}
+}
+
+func TestTripsBetween(t *testing.T) {
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	g := girafake.New()
+	// newest first, one trip a day from May 10 back to May 1
+	for i := range 10 {
+		g.Trips = append(g.Trips, gira.Trip{
+			Code:      gira.TripCode(fmt.Sprint(10 - i)),
+			StartDate: day.AddDate(0, 0, -i).Add(12 * time.Hour),
+		})
+	}
+
+	trips, err := gira.TripsBetween(context.Background(), g, day.AddDate(0, 0, -4), day.AddDate(0, 0, -1), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codes []gira.TripCode
+	for _, trip := range trips {
+		codes = append(codes, trip.Code)
+	}
+	if want := []gira.TripCode{"8", "7", "6"}; !slices.Equal(codes, want) {
+		t.Errorf("codes = %v, want %v", codes, want)
+	}
+}
@@ -0,0 +1,257 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BikeLocation is where Indexer has last seen the bike.
+type BikeLocation struct {
+	Bike    Bike
+	Station Station
+	Dock    DockSerial
+
+	// SeenAt is the time of the last crawl which found the bike,
+	// ChangedAt is the time its station, dock or battery last changed.
+	SeenAt    time.Time
+	ChangedAt time.Time
+}
+
+// Indexer periodically crawls docks of all stations and keeps an index of docked bikes,
+// so that bikes can be looked up without querying every station on demand.
+// Bikes which are not docked, e.g. being ridden, are not in the index.
+type Indexer struct {
+	// client returns a client to crawl with, it's called on each crawl, so that it can pick a valid token
+	client   func() (API, error)
+	interval time.Duration
+	// stationDelay is a pause between station requests, so that crawl doesn't hammer the API
+	stationDelay time.Duration
+
+	mu        sync.RWMutex
+	bikes     map[BikeSerial]BikeLocation
+	crawledAt time.Time
+}
+
+// NewIndexer returns an indexer which crawls all stations every interval with client returned by client func.
+func NewIndexer(interval time.Duration, client func() (API, error)) *Indexer {
+	return &Indexer{
+		client:       client,
+		interval:     interval,
+		stationDelay: 200 * time.Millisecond,
+		bikes:        map[BikeSerial]BikeLocation{},
+	}
+}
+
+// Run crawls stations every interval until ctx is done.
+func (ix *Indexer) Run(ctx context.Context) {
+	for {
+		ix.crawlOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ix.interval):
+		}
+	}
+}
+
+// crawlOnce crawls with a client from ix.client, logging errors with the client's logger.
+func (ix *Indexer) crawlOnce(ctx context.Context) {
+	api, err := ix.client()
+	if err != nil {
+		slog.Default().Error("gira: indexer client error", "error", err)
+		return
+	}
+	if err := ix.Crawl(ctx, api); err != nil {
+		loggerOf(api).Error("gira: indexer crawl error", "error", err)
+	}
+}
+
+// Crawl walks docks of all active stations and replaces the index with the bikes found.
+// Stations which failed to load keep their bikes from the previous crawl.
+func (ix *Indexer) Crawl(ctx context.Context, api API) error {
+	stations, err := api.GetStations(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	found := map[BikeSerial]BikeLocation{}
+	failed := map[StationSerial]bool{}
+	var failures int
+	for i, s := range stations {
+		if s.Status != AssetStatusActive {
+			continue
+		}
+		if i > 0 && ix.stationDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(ix.stationDelay):
+			}
+		}
+
+		docks, err := api.GetStationDocks(ctx, s.Serial)
+		if err != nil {
+			failed[s.Serial] = true
+			failures++
+			continue
+		}
+		for _, d := range docks {
+			if d.Bike == nil {
+				continue
+			}
+			found[d.Bike.Serial] = BikeLocation{
+				Bike:      *d.Bike,
+				Station:   s,
+				Dock:      d.Serial,
+				SeenAt:    now,
+				ChangedAt: now,
+			}
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for serial, loc := range found {
+		old, ok := ix.bikes[serial]
+		if ok && old.Station.Serial == loc.Station.Serial && old.Dock == loc.Dock && old.Bike.Battery == loc.Bike.Battery {
+			loc.ChangedAt = old.ChangedAt
+			found[serial] = loc
+		}
+	}
+	for serial, old := range ix.bikes {
+		if _, ok := found[serial]; !ok && failed[old.Station.Serial] {
+			found[serial] = old
+		}
+	}
+	ix.bikes = found
+	ix.crawledAt = now
+
+	if failures > 0 {
+		return fmt.Errorf("gira: indexer failed to get docks of %d stations", failures)
+	}
+	return nil
+}
+
+// Bike returns the last known location of the bike by its serial.
+func (ix *Indexer) Bike(serial BikeSerial) (BikeLocation, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	loc, ok := ix.bikes[serial]
+	return loc, ok
+}
+
+// BikeByName returns the last known location of the bike by its name, e.g. E1234, case-insensitive.
+func (ix *Indexer) BikeByName(name string) (BikeLocation, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	for _, loc := range ix.bikes {
+		if strings.EqualFold(loc.Bike.Name, name) {
+			return loc, true
+		}
+	}
+	return BikeLocation{}, false
+}
+
+// find returns the last known location of the bike by its name or serial.
+func (ix *Indexer) find(id string) (BikeLocation, bool) {
+	if loc, ok := ix.Bike(BikeSerial(id)); ok {
+		return loc, true
+	}
+	return ix.BikeByName(id)
+}
+
+// isBike returns whether bike has given name or serial.
+func (b Bike) isBike(id string) bool {
+	return string(b.Serial) == id || strings.EqualFold(b.Name, id)
+}
+
+// FindBike returns where the bike with given name (e.g. E1234) or serial is docked.
+// With indexer, the bike is looked up in the index and its station is re-checked with one query.
+// If the bike isn't there anymore, or there's no indexer, docks of all stations are walked, which is slow.
+// ErrBikeNotFound is returned if the bike is not docked, e.g. it's being ridden.
+func (c *Client) FindBike(ctx context.Context, id string) (BikeLocation, error) {
+	return findBike(ctx, c, c.indexer, id)
+}
+
+func findBike(ctx context.Context, api API, ix *Indexer, id string) (BikeLocation, error) {
+	var checked StationSerial
+	if ix != nil {
+		loc, ok := ix.find(id)
+		if !ok {
+			return BikeLocation{}, ErrBikeNotFound
+		}
+		fresh, err := findBikeAt(ctx, api, loc.Station, id)
+		if err == nil {
+			if fresh.Dock == loc.Dock && fresh.Bike.Battery == loc.Bike.Battery {
+				fresh.ChangedAt = loc.ChangedAt
+			}
+			return fresh, nil
+		}
+		if !errors.Is(err, ErrBikeNotFound) {
+			return BikeLocation{}, err
+		}
+		// index is stale, the bike was ridden to another station since the last crawl
+		checked = loc.Station.Serial
+	}
+
+	stations, err := api.GetStations(ctx)
+	if err != nil {
+		return BikeLocation{}, err
+	}
+	for _, s := range stations {
+		if s.Status != AssetStatusActive || s.Serial == checked {
+			continue
+		}
+		loc, err := findBikeAt(ctx, api, s, id)
+		if errors.Is(err, ErrBikeNotFound) {
+			continue
+		}
+		return loc, err
+	}
+	return BikeLocation{}, ErrBikeNotFound
+}
+
+// findBikeAt returns the bike location if it's docked at the station, or ErrBikeNotFound.
+func findBikeAt(ctx context.Context, api API, s Station, id string) (BikeLocation, error) {
+	docks, err := api.GetStationDocks(ctx, s.Serial)
+	if err != nil {
+		return BikeLocation{}, err
+	}
+	for _, d := range docks {
+		if d.Bike != nil && d.Bike.isBike(id) {
+			now := time.Now()
+			return BikeLocation{
+				Bike:      *d.Bike,
+				Station:   s,
+				Dock:      d.Serial,
+				SeenAt:    now,
+				ChangedAt: now,
+			}, nil
+		}
+	}
+	return BikeLocation{}, ErrBikeNotFound
+}
+
+// CrawledAt returns the time of the last crawl, zero if there was none.
+func (ix *Indexer) CrawledAt() time.Time {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.crawledAt
+}
+
+// Len returns the number of bikes in the index.
+func (ix *Indexer) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.bikes)
+}
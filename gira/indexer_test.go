@@ -0,0 +1,88 @@
+package gira_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/girafake"
+)
+
+func TestIndexerCrawl(t *testing.T) {
+	ctx := context.Background()
+
+	g := girafake.New()
+	g.AddStation(gira.Station{Code: "sc1", Serial: "ss1", Name: "101 - A", Status: gira.AssetStatusActive}, gira.Docks{
+		{Code: "dc1", Serial: "ds1", Number: 1, Bike: &gira.Bike{Serial: "bs1", Name: "E0001", Battery: 80}},
+		{Code: "dc2", Serial: "ds2", Number: 2, Bike: &gira.Bike{Serial: "bs2", Name: "C0002"}},
+	})
+	g.AddStation(gira.Station{Code: "sc2", Serial: "ss2", Name: "202 - B", Status: "inactive"}, gira.Docks{
+		{Code: "dc3", Serial: "ds3", Number: 1, Bike: &gira.Bike{Serial: "bs3", Name: "E0003"}},
+	})
+
+	ix := gira.NewIndexer(0, func() (gira.API, error) { return g, nil })
+	if err := ix.Crawl(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if ix.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", ix.Len())
+	}
+	loc, ok := ix.BikeByName("e0001")
+	if !ok || loc.Station.Serial != "ss1" || loc.Dock != "ds1" || loc.Bike.Battery != 80 {
+		t.Errorf("BikeByName(e0001) = %+v, %v", loc, ok)
+	}
+	if _, ok := ix.Bike("bs3"); ok {
+		t.Error("bike at inactive station is indexed")
+	}
+	firstChange := loc.ChangedAt
+
+	// ride away with one bike
+	if _, err := g.ReserveBike(ctx, "bs2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.StartTrip(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Crawl(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ix.Bike("bs2"); ok {
+		t.Error("bike on trip is still indexed")
+	}
+	loc, ok = ix.Bike("bs1")
+	if !ok || !loc.ChangedAt.Equal(firstChange) || !loc.SeenAt.After(firstChange) {
+		t.Errorf("unchanged bike location = %+v, %v", loc, ok)
+	}
+}
+
+func TestFindBikeStaleIndex(t *testing.T) {
+	ctx := context.Background()
+
+	g := girafake.New()
+	g.AddStation(gira.Station{Code: "sc1", Serial: "ss1", Name: "101 - A", Status: gira.AssetStatusActive}, gira.Docks{
+		{Code: "dc1", Serial: "ds1", Number: 1, Bike: &gira.Bike{Serial: "bs1", Name: "E0001"}},
+	})
+	g.AddStation(gira.Station{Code: "sc2", Serial: "ss2", Name: "202 - B", Status: gira.AssetStatusActive}, gira.Docks{
+		{Code: "dc2", Serial: "ds2", Number: 1},
+	})
+
+	ix := gira.NewIndexer(0, func() (gira.API, error) { return g, nil })
+	if err := ix.Crawl(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+
+	loc, err := gira.FindBikeWith(ctx, g, ix, "E0001")
+	if err != nil || loc.Station.Serial != "ss1" {
+		t.Fatalf("FindBike() = %+v, %v, want at ss1", loc, err)
+	}
+
+	// the bike was ridden to another station, index still has the old one
+	g.Docks["ss2"][0].Bike, g.Docks["ss1"][0].Bike = g.Docks["ss1"][0].Bike, nil
+
+	loc, err = gira.FindBikeWith(ctx, g, ix, "E0001")
+	if err != nil || loc.Station.Serial != "ss2" || loc.Dock != "ds2" {
+		t.Errorf("FindBike() with stale index = %+v, %v, want at ss2 ds2", loc, err)
+	}
+}
@@ -0,0 +1,19 @@
+package gira
+
+import "log/slog"
+
+// logger returns the logger of the client, see WithLogger.
+func (c *Client) logger() *slog.Logger {
+	if c.log != nil {
+		return c.log
+	}
+	return slog.Default()
+}
+
+// loggerOf returns the logger of api if it's a Client, slog.Default() otherwise.
+func loggerOf(api API) *slog.Logger {
+	if c, ok := api.(*Client); ok && c != nil {
+		return c.logger()
+	}
+	return slog.Default()
+}
@@ -0,0 +1,82 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	opDurationHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gira_operation_duration_seconds",
+		// includes retries, so the tail is long
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation", "result"})
+	opErrorsCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_operation_errors_total"}, []string{"operation", "category"})
+	// backendErrorsCnt counts GraphQL errors returned by backend by error code, or "unrecognized"
+	// if message didn't match any known error, see knownErrors.
+	backendErrorsCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_backend_errors_total"}, []string{"code"})
+)
+
+// backendErrorUnrecognized is backendErrorsCnt label of errors without a known code.
+const backendErrorUnrecognized = "unrecognized"
+
+// errorCategory returns a low-cardinality label for the error, stable error code for Gira errors.
+func errorCategory(err error) string {
+	if code := ErrorCodeOf(err); code != "" {
+		return string(code)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "other"
+}
+
+// observeOperation records latency and outcome of the operation started at start.
+func observeOperation(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+		opErrorsCnt.WithLabelValues(op, errorCategory(err)).Inc()
+	}
+	opDurationHist.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
+
+// run calls fn with opts applied, unwraps Gira errors and records metrics and trace span under op name.
+func (c *Client) run(ctx context.Context, op string, fn func(ctx context.Context) error, opts ...CallOption) error {
+	ctx, cancel := applyCallOptions(ctx, opts)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, op)
+	start := time.Now()
+	err := c.waitLimiters(ctx, op)
+	if err == nil {
+		err = fn(ctx)
+	}
+	if err != nil {
+		err = unwrapError(err)
+	}
+	observeOperation(op, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// query runs GraphQL query under op name, see run.
+func (c *Client) query(ctx context.Context, op string, q any, vars map[string]any, opts ...CallOption) error {
+	return c.run(ctx, op, func(ctx context.Context) error {
+		return c.c.Query(ctx, q, vars)
+	}, opts...)
+}
+
+// mutate is the same as query, but for mutations.
+func (c *Client) mutate(ctx context.Context, op string, m any, vars map[string]any, opts ...CallOption) error {
+	return c.run(ctx, op, func(ctx context.Context) error {
+		return c.c.Mutate(ctx, m, vars)
+	}, opts...)
+}
@@ -0,0 +1,25 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCategory(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{&GiraError{Code: CodeBikeInRepair}, "bike_in_repair"},
+		{fmt.Errorf("wrapped: %w", &GiraError{Code: CodeForbidden}), "forbidden"},
+		{context.Canceled, "canceled"},
+		{fmt.Errorf("post: %w", context.DeadlineExceeded), "timeout"},
+		{errors.New("boom"), "other"},
+	} {
+		if got := errorCategory(tt.err); got != tt.want {
+			t.Errorf("errorCategory(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package gira
+
+import (
+	"fmt"
+	"math"
+)
+
+// Money is an amount in euro cents. Gira API uses float euros, which are converted
+// with MoneyFromEuros to keep cent precision.
+type Money int64
+
+// MoneyFromEuros returns amount eur rounded to cents.
+func MoneyFromEuros(eur float64) Money {
+	return Money(math.Round(eur * 100))
+}
+
+// Euros returns the amount in euros.
+func (m Money) Euros() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount in euros, with cents only if there are any, e.g. "1€" or "1.35€".
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	if m%100 == 0 {
+		return fmt.Sprintf("%s%d€", sign, m/100)
+	}
+	return fmt.Sprintf("%s%d.%02d€", sign, m/100, m%100)
+}
@@ -0,0 +1,22 @@
+package gira
+
+import "testing"
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		eur  float64
+		want string
+	}{
+		{0, "0€"},
+		{1, "1€"},
+		{1.35, "1.35€"},
+		{0.1 + 0.2, "0.30€"},
+		{2.05, "2.05€"},
+		{-1.5, "-1.50€"},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromEuros(tt.eur).String(); got != tt.want {
+			t.Errorf("MoneyFromEuros(%v) = %s, want %s", tt.eur, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package gira
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+// DefaultEndpoint is Gira GraphQL API endpoint used unless WithEndpoint is given.
+const DefaultEndpoint = "https://c2g091p01.emel.pt/ws/graphql"
+
+// defaultStationCacheTTL is TTL of client's own station cache, if WithStationCache is not given.
+const defaultStationCacheTTL = time.Hour
+
+// defaultDocksCacheTTL is TTL of client's own docks cache, if WithDocksCache is not given.
+const defaultDocksCacheTTL = 10 * time.Second
+
+// Option configures Client, see New.
+type Option func(*Client)
+
+// WithEndpoint makes client send GraphQL requests to url, e.g. to a proxy.
+func WithEndpoint(url string) Option {
+	return func(c *Client) {
+		c.endpoint = url
+	}
+}
+
+// WithEndpoints makes client send GraphQL requests to endpoints from the pool, with failover.
+// It overrides WithEndpoint.
+func WithEndpoints(pool *EndpointPool) Option {
+	return func(c *Client) {
+		c.endpoints = pool
+	}
+}
+
+// WithStationCache makes client use the cache for station lookups, it's meant to be shared between clients.
+func WithStationCache(cache *StationCache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// WithDocksCache makes client use the cache for station docks, it's meant to be shared between clients.
+func WithDocksCache(cache *DocksCache) Option {
+	return func(c *Client) {
+		c.docks = cache
+	}
+}
+
+// WithIndexer makes FindBike use the index instead of walking docks of all stations.
+func WithIndexer(ix *Indexer) Option {
+	return func(c *Client) {
+		c.indexer = ix
+	}
+}
+
+// WithRetryPolicy makes client retry requests according to p instead of retryablehttp.DefaultPolicy.
+func WithRetryPolicy(p retryablehttp.Policy) Option {
+	return func(c *Client) {
+		c.retryOpts = append(c.retryOpts, retryablehttp.WithPolicy(p))
+	}
+}
+
+// WithResultObserver makes client notify f about request outcomes after all retries, see retryablehttp.WithResultObserver.
+func WithResultObserver(f func(op string, failed bool)) Option {
+	return func(c *Client) {
+		c.retryOpts = append(c.retryOpts, retryablehttp.WithResultObserver(f))
+	}
+}
+
+// WithRateLimiter makes client wait for the limiter before each GraphQL request.
+// It can be given several times, then all limiters apply.
+func WithRateLimiter(rl *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiters = append(c.limiters, rl)
+	}
+}
+
+// WithLogger makes client log to l instead of slog.Default(), including its requests, subscriptions
+// and the indexer crawls made with it. Request bodies and subscription messages are logged at debug level.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.log = l
+	}
+}
+
+// CallOption configures a single call of client method which accepts it.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout time.Duration
+	noRetry bool
+	noCache bool
+}
+
+// WithTimeout limits the call, including retries, to d.
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// WithNoRetry makes the call send the request once. Use it for actions which must not be repeated,
+// as a timed out or failed request might have still succeeded on the server.
+func WithNoRetry() CallOption {
+	return func(o *callOptions) {
+		o.noRetry = true
+	}
+}
+
+// WithNoCache makes the call fetch fresh data instead of using the client's cache,
+// e.g. when user explicitly asks to refresh.
+func WithNoCache() CallOption {
+	return func(o *callOptions) {
+		o.noCache = true
+	}
+}
+
+// newCallOptions returns opts applied to zero callOptions.
+func newCallOptions(opts []CallOption) callOptions {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// applyCallOptions returns ctx for the call with opts applied, cancel must be called after the call.
+func applyCallOptions(ctx context.Context, opts []CallOption) (context.Context, context.CancelFunc) {
+	o := newCallOptions(opts)
+	if o.noRetry {
+		ctx = retryablehttp.WithoutRetries(ctx)
+	}
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return ctx, func() {}
+}
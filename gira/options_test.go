@@ -0,0 +1,21 @@
+package gira
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApplyCallOptions(t *testing.T) {
+	ctx, cancel := applyCallOptions(context.Background(), nil)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("deadline is set without WithTimeout")
+	}
+
+	ctx, cancel = applyCallOptions(context.Background(), []CallOption{WithTimeout(time.Minute), WithNoRetry()})
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("deadline = %v, %v, want within a minute", deadline, ok)
+	}
+}
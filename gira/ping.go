@@ -0,0 +1,73 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrBackendUnavailable is returned by Ping if the backend didn't answer, while credentials might be fine.
+var ErrBackendUnavailable = errors.New("gira: backend unavailable")
+
+// AuthError is an error of obtaining or using account credentials, e.g. expired refresh token
+// or access token rejected by the backend. It means user has to log in again.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return "gira: auth: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// IsAuthError returns whether err is caused by account credentials, see AuthError.
+// Errors of token sources are recognized only if they are wrapped with AuthTokenSource.
+func IsAuthError(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr) || errors.Is(err, ErrForbidden)
+}
+
+type authTokenSource struct {
+	ts oauth2.TokenSource
+}
+
+// AuthTokenSource returns token source which wraps errors of ts in AuthError, so that failures
+// of client requests to get the token can be told from backend ones.
+func AuthTokenSource(ts oauth2.TokenSource) oauth2.TokenSource {
+	return authTokenSource{ts: ts}
+}
+
+func (a authTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := a.ts.Token()
+	if err != nil {
+		return nil, &AuthError{Err: err}
+	}
+	return tok, nil
+}
+
+// Ping checks that client can make requests with a trivial query. It returns AuthError if
+// the token can't be obtained or is rejected, and ErrBackendUnavailable for other failures.
+func (c *Client) Ping(ctx context.Context) error {
+	var query struct {
+		Typename string `graphql:"__typename"`
+	}
+	err := c.query(ctx, "ping", &query, nil)
+	switch {
+	case err == nil:
+		return nil
+	case IsAuthError(err):
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			return authErr
+		}
+		return &AuthError{Err: err}
+	case errors.Is(err, context.Canceled):
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
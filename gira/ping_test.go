@@ -0,0 +1,59 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+type errTokenSource struct{}
+
+func (errTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("refresh token expired")
+}
+
+func TestPing(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"data": {"__typename": "Query"}}`))
+		} else {
+			// backend replies with status line in body
+			_, _ = fmt.Fprintf(w, "%d %s", status, http.StatusText(status))
+		}
+	}))
+	defer srv.Close()
+
+	noRetry := WithRetryPolicy(retryablehttp.Policy{Attempts: 1, AttemptTimeout: time.Second})
+	c := New(srv.Client(), WithEndpoint(srv.URL), noRetry)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping() = %v", err)
+	}
+
+	status = http.StatusUnauthorized
+	if err := c.Ping(ctx); !IsAuthError(err) {
+		t.Errorf("Ping() with 401 = %v, want auth error", err)
+	}
+
+	status = http.StatusBadGateway
+	if err := c.Ping(ctx); !errors.Is(err, ErrBackendUnavailable) || IsAuthError(err) {
+		t.Errorf("Ping() with 502 = %v, want %v", err, ErrBackendUnavailable)
+	}
+
+	httpc := &http.Client{Transport: &oauth2.Transport{Source: AuthTokenSource(errTokenSource{}), Base: srv.Client().Transport}}
+	c = New(httpc, WithEndpoint(srv.URL), noRetry)
+	if err := c.Ping(ctx); !IsAuthError(err) {
+		t.Errorf("Ping() with broken token source = %v, want auth error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package gira
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+var throttledCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_throttled_requests_total"}, []string{"limiter", "operation"})
+
+// RateLimiter is a named token-bucket limiter of Gira requests. It's meant to be shared between
+// clients, e.g. one global limiter for all clients and a stricter one for background jobs.
+type RateLimiter struct {
+	name string
+	l    *rate.Limiter
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second on average with bursts of burst requests.
+// Name is used in metrics.
+func NewRateLimiter(name string, rps float64, burst int) *RateLimiter {
+	return &RateLimiter{name: name, l: rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+// wait blocks until request op is allowed or ctx is done.
+func (rl *RateLimiter) wait(ctx context.Context, op string) error {
+	if rl.l.Allow() {
+		return nil
+	}
+	throttledCnt.WithLabelValues(rl.name, op).Inc()
+	return rl.l.Wait(ctx)
+}
+
+// waitLimiters waits for all client's limiters before request op.
+func (c *Client) waitLimiters(ctx context.Context, op string) error {
+	for _, rl := range c.limiters {
+		if err := rl.wait(ctx, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package gira
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	rl := NewRateLimiter("test", 1, 1)
+	ctx := context.Background()
+
+	if err := rl.wait(ctx, "op"); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+
+	// bucket is empty, next token is in a second, which is after the deadline
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := rl.wait(ctx, "op"); err == nil {
+		t.Fatal("second wait succeeded, want throttled")
+	}
+}
@@ -0,0 +1,35 @@
+package gira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// rawOperation is the metrics and tracing name of all Do calls, queries are arbitrary
+// and can't be used as label values.
+const rawOperation = "raw"
+
+// Do runs arbitrary GraphQL query or mutation with variables vars and decodes the "data"
+// field of response into out, unless it's nil. It goes through the same transport as typed
+// methods, so requests are authenticated and retried.
+//
+// It's an escape hatch for debugging and experiments with the schema, bot features should
+// use typed methods.
+func (c *Client) Do(ctx context.Context, query string, vars map[string]any, out any) error {
+	var data []byte
+	err := c.run(ctx, rawOperation, func(ctx context.Context) (err error) {
+		data, err = c.c.ExecRaw(ctx, query, vars)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("gira: decoding raw response: %w", err)
+	}
+	return nil
+}
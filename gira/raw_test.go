@@ -0,0 +1,81 @@
+package gira
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables map[string]any
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Query != "query($id: String){ bike(id: $id) { name } }" || req.Variables["id"] != "123" {
+			t.Errorf("request = %+v", req)
+		}
+		_, _ = w.Write([]byte(`{"data": {"bike": {"name": "E1234"}}}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.Client(), WithEndpoint(srv.URL))
+
+	var out struct {
+		Bike struct{ Name string }
+	}
+	err := c.Do(context.Background(), "query($id: String){ bike(id: $id) { name } }", map[string]any{"id": "123"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bike.Name != "E1234" {
+		t.Errorf("name = %q", out.Bike.Name)
+	}
+}
+
+func TestDoGiraError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors": [{"message": "trip_interval_limit"}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.Client(), WithEndpoint(srv.URL))
+	err := c.Do(context.Background(), "mutation { startTrip }", nil, nil)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if !errors.Is(err, ErrTripIntervalLimit) {
+		t.Errorf("err = %v, want %v", err, ErrTripIntervalLimit)
+	}
+}
+
+func TestBackendErrorsMetric(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors": [{"message": "something new"}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.Client(), WithEndpoint(srv.URL), WithRetryPolicy(retryablehttp.Policy{Attempts: 1, AttemptTimeout: time.Second}))
+
+	before := testutil.ToFloat64(backendErrorsCnt.WithLabelValues(backendErrorUnrecognized))
+	var out struct{}
+	if err := c.Do(context.Background(), "{ bike { name } }", nil, &out); err == nil {
+		t.Fatal("Do() succeeded, want error")
+	}
+	if got := testutil.ToFloat64(backendErrorsCnt.WithLabelValues(backendErrorUnrecognized)) - before; got != 1 {
+		t.Errorf("unrecognized errors counted %v times, want 1", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Package replay records HTTP interactions of the client to golden files and replays them in tests,
+// so that query shapes and response parsing are tested deterministically without credentials.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+// RecordEnv is the environment variable which switches New to recording mode.
+const RecordEnv = "GIRA_RECORD"
+
+// Interaction is a recorded request body and the response to it. Bodies are stored as JSON
+// if they are valid JSON, and as plain text in ResponseText otherwise.
+type Interaction struct {
+	Request      json.RawMessage `json:"request"`
+	Status       int             `json:"status"`
+	Response     json.RawMessage `json:"response,omitempty"`
+	ResponseText string          `json:"responseText,omitempty"`
+}
+
+// New returns transport for test t, which replays interactions from golden file path in order.
+// If RecordEnv is set, requests are sent with transport returned by live instead, and recorded
+// to path when the test ends. Secrets and personal data are redacted, see retryablehttp.Redact.
+func New(t testing.TB, path string, live func() http.RoundTripper) http.RoundTripper {
+	t.Helper()
+
+	if os.Getenv(RecordEnv) != "" {
+		r := &recorder{inner: live()}
+		t.Cleanup(func() {
+			if err := r.save(path); err != nil {
+				t.Errorf("replay: saving %s: %v", path, err)
+			}
+		})
+		return r
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("replay: %v, record it with %s=1", err, RecordEnv)
+	}
+	var interactions []Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		t.Fatalf("replay: parsing %s: %v", path, err)
+	}
+	p := &player{t: t, path: path, interactions: interactions}
+	t.Cleanup(p.checkUsed)
+	return p
+}
+
+// readBody reads and restores request body.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// normalize returns compacted JSON, or b as JSON string if it's not JSON.
+func normalize(b []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err == nil {
+		return buf.Bytes()
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+type recorder struct {
+	inner http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{
+		Request: normalize([]byte(retryablehttp.Redact(reqBody))),
+		Status:  resp.StatusCode,
+	}
+	redacted := []byte(retryablehttp.Redact(respBody))
+	if json.Valid(redacted) {
+		in.Response = normalize(redacted)
+	} else {
+		in.ResponseText = string(redacted)
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *recorder) save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type player struct {
+	t    testing.TB
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	next         int
+}
+
+func (p *player) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next >= len(p.interactions) {
+		return nil, fmt.Errorf("replay: unexpected request %d to %s: %s", p.next, p.path, reqBody)
+	}
+	in := p.interactions[p.next]
+	p.next++
+
+	got := normalize([]byte(retryablehttp.Redact(reqBody)))
+	if !bytes.Equal(got, normalize(in.Request)) {
+		return nil, fmt.Errorf("replay: request %d doesn't match %s:\n got: %s\nwant: %s", p.next-1, p.path, got, in.Request)
+	}
+
+	body := []byte(in.ResponseText)
+	if in.Response != nil {
+		body = in.Response
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode: in.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// checkUsed fails the test if not all interactions were replayed, e.g. if client stopped making a request.
+func (p *player) checkUsed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next != len(p.interactions) {
+		p.t.Errorf("replay: %d of %d interactions in %s were not replayed", len(p.interactions)-p.next, len(p.interactions), p.path)
+	}
+}
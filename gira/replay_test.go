@@ -0,0 +1,119 @@
+package gira_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/emeltls"
+	"github.com/ilyaluk/girabot/gira/replay"
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+)
+
+// replayClient returns client which replays testdata/name.json. Committed fixtures are synthetic,
+// to record it against the real backend, run tests with GIRA_RECORD=1 and GIRA_ACCESS_TOKEN set.
+func replayClient(t *testing.T, name string) *gira.Client {
+	t.Helper()
+
+	rt := replay.New(t, filepath.Join("testdata", name+".json"), func() http.RoundTripper {
+		tok := os.Getenv("GIRA_ACCESS_TOKEN")
+		if tok == "" {
+			t.Fatal("GIRA_ACCESS_TOKEN is required for recording")
+		}
+		return &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: tok}),
+			Base:   emeltls.Transport(),
+		}
+	})
+	// retries would make replayed requests depend on backend luck during recording
+	return gira.New(
+		&http.Client{Transport: rt},
+		gira.WithRetryPolicy(retryablehttp.Policy{Attempts: 1, AttemptTimeout: 30 * time.Second}),
+	)
+}
+
+func TestReplayGetClientInfo(t *testing.T) {
+	info, err := replayClient(t, "client").GetClientInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name == "" || len(info.ActiveSubscriptions) != 1 || !info.ActiveSubscriptions[0].Active {
+		t.Errorf("GetClientInfo() = %+v", info)
+	}
+	if got := info.Balance.String(); got != "1.35€" {
+		t.Errorf("balance = %s, want 1.35€", got)
+	}
+}
+
+func TestReplayGetBalance(t *testing.T) {
+	balance, err := replayClient(t, "balance").GetBalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Balance.String() != "1.35€" || balance.Bonus != 120 {
+		t.Errorf("GetBalance() = %+v", balance)
+	}
+}
+
+func TestReplayGetStations(t *testing.T) {
+	stations, err := replayClient(t, "stations").GetStations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stations) != 2 {
+		t.Fatalf("GetStations() = %+v", stations)
+	}
+	s := stations[0]
+	if s.Number() != "101" || s.Status != gira.AssetStatusActive || s.Docks != 20 || s.Latitude == 0 {
+		t.Errorf("station = %+v", s)
+	}
+}
+
+func TestReplayGetStationDocks(t *testing.T) {
+	docks, err := replayClient(t, "docks").GetStationDocks(context.Background(), "ss101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docks) != 3 {
+		t.Fatalf("GetStationDocks() = %+v", docks)
+	}
+	if docks.ElectricBikesAvailable() != 1 || docks.ConventionalBikesAvailable() != 1 {
+		t.Errorf("bikes = %d electric, %d conventional", docks.ElectricBikesAvailable(), docks.ConventionalBikesAvailable())
+	}
+	best := docks.BestElectricBike()
+	if best == nil || best.Name != "E1234" || best.Battery != 80 || best.DockNumber != 2 {
+		t.Errorf("best electric bike = %+v", best)
+	}
+}
+
+func TestReplayGetActiveTrip(t *testing.T) {
+	_, err := replayClient(t, "no_active_trip").GetActiveTrip(context.Background())
+	if !errors.Is(err, gira.ErrNoActiveTrip) {
+		t.Errorf("GetActiveTrip() = %v, want %v", err, gira.ErrNoActiveTrip)
+	}
+}
+
+func TestReplayGetTripHistory(t *testing.T) {
+	trips, err := replayClient(t, "trip_history").GetTripHistory(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trips) != 1 {
+		t.Fatalf("GetTripHistory() = %+v", trips)
+	}
+	trip := trips[0]
+	if trip.Cost.String() != "0.50€" || trip.PrettyDuration() != "50:00" {
+		t.Errorf("trip = %+v, duration %s", trip, trip.PrettyDuration())
+	}
+	// station names are resolved with the station list
+	if trip.StartLocation != "sc101" || trip.EndLocation != "sc202" {
+		t.Errorf("stations = %q → %q", trip.StartLocation, trip.EndLocation)
+	}
+}
@@ -0,0 +1,23 @@
+package retryablehttp
+
+import "regexp"
+
+var (
+	// sensitiveFieldRe matches JSON string fields with secrets or personal data, e.g. "refreshToken": "...".
+	sensitiveFieldRe = regexp.MustCompile(`(?i)("[a-z_]*(?:password|token|secret|email|phone|fiscalnumber|nif|address|iban)[a-z_]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// jwtRe matches JWTs outside of known fields, e.g. in GraphQL arguments.
+	jwtRe = regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]*`)
+)
+
+// Redact returns body as a string with values of sensitive JSON fields and JWTs replaced,
+// so that it can be logged.
+func Redact(body []byte) string {
+	res := sensitiveFieldRe.ReplaceAll(body, []byte(`$1"[redacted]"`))
+	res = jwtRe.ReplaceAll(res, []byte("[redacted]"))
+	return string(res)
+}
+
+// truncate returns s cut to at most n bytes.
+func truncate(s string, n int) string {
+	return s[:min(len(s), n)]
+}
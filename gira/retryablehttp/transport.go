@@ -0,0 +1,352 @@
+package retryablehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/hasura/go-graphql-client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type Transport struct {
+	inner  http.RoundTripper
+	policy Policy
+	// observer is called with the final outcome of each request, after all retries.
+	observer func(op string, failed bool)
+	log      *slog.Logger
+}
+
+// Option configures Transport, see NewTransport.
+type Option func(*Transport)
+
+// WithPolicy makes transport use retry policy p instead of DefaultPolicy.
+func WithPolicy(p Policy) Option {
+	return func(t *Transport) {
+		t.policy = p
+	}
+}
+
+// WithResultObserver makes transport notify f about request outcomes, e.g. to track backend health.
+// Request is considered failed if it errored, or the last attempt still was retryable (5xx or invalid operation).
+func WithResultObserver(f func(op string, failed bool)) Option {
+	return func(t *Transport) {
+		t.observer = f
+	}
+}
+
+// WithLogger makes transport log to l instead of slog.Default(). Request and response bodies are
+// logged at debug level, with secrets and personal data redacted, see Redact.
+func WithLogger(l *slog.Logger) Option {
+	return func(t *Transport) {
+		t.log = l
+	}
+}
+
+func NewTransport(inner http.RoundTripper, opts ...Option) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	t := &Transport{inner: inner, policy: DefaultPolicy, log: slog.Default()}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+var (
+	requestsCnt     = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_requests_total"}, []string{"operation"})
+	sentRequestsCnt = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_sent_requests_total"}, []string{"operation"})
+	timeoutsCnt     = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_timeout_retries_total"}, []string{"operation"})
+	retriesCnt      = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gira_retries_total"}, []string{"operation"})
+)
+
+// Policy is retry budget of Transport.
+type Policy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// AttemptTimeout limits time of each attempt, timed out attempts are retried.
+	AttemptTimeout time.Duration
+	// BaseDelay is the delay before the first retry, each next one is Multiplier times longer.
+	BaseDelay  time.Duration
+	Multiplier float64
+	// Jitter is a fraction by which delays are randomly changed, so that clients don't retry in sync.
+	Jitter float64
+}
+
+// DefaultPolicy is generous, as Gira backend fails a lot: 10 attempts take up to ~1.5 minutes.
+var DefaultPolicy = Policy{
+	Attempts:       10,
+	AttemptTimeout: 5 * time.Second,
+	BaseDelay:      500 * time.Millisecond,
+	Multiplier:     1.5,
+	Jitter:         0.2,
+}
+
+// backoff returns delay before retry after attempt number retries (0-based), without jitter.
+func (p Policy) backoff(retries int) time.Duration {
+	return time.Duration(float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(retries)))
+}
+
+// delay returns jittered backoff, or the delay requested by server with Retry-After if it's longer.
+// Response might be nil if request timed out.
+func (p Policy) delay(retries int, resp *http.Response) time.Duration {
+	d := p.backoff(retries)
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	if resp != nil {
+		d = max(d, retryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	}
+	return d
+}
+
+// retryAfter parses Retry-After header value, which is either delay in seconds or HTTP date.
+// It returns 0 if header is absent or invalid.
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(0, time.Duration(secs)*time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, t.Sub(now))
+	}
+	return 0
+}
+
+type noRetryKey struct{}
+
+// WithoutRetries returns context which makes transport send the request once, limited only by ctx
+// deadline. It's for non-idempotent requests, a timed out attempt might have succeeded on the server.
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent returns context which marks the request as safe to repeat, so that transport also
+// retries it on network errors, e.g. reset connection. Other requests are retried only if the server
+// responded with a retryable error, as a request which failed mid-way might have been processed.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// isNetworkError returns true for errors of connection to the server, which are worth retrying.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", "Gira/3.4.3 (Android 34)")
+
+	// Clone the request body
+	var reqBytes []byte
+	var err error
+	if req.Body != nil {
+		reqBytes, err = io.ReadAll(req.Body)
+		if err != nil {
+			t.log.Error("retry: error reading body", "error", err)
+			return nil, err
+		}
+	}
+
+	op := operationName(req, reqBytes)
+	requestsCnt.WithLabelValues(op).Inc()
+
+	log := t.log.With("op", op)
+	log.Debug("retry: request", "method", req.Method, "url", req.URL.Redacted(), "body", truncate(Redact(reqBytes), 500))
+
+	var (
+		resp      *http.Response
+		retryable bool
+	)
+
+	p := t.policy
+	parent := req.Context()
+	noRetry, _ := parent.Value(noRetryKey{}).(bool)
+	idempotent, _ := parent.Value(idempotentKey{}).(bool)
+	if noRetry {
+		p.Attempts = 1
+	}
+	for i := 0; i < p.Attempts; i++ {
+		if req.Body != nil {
+			req.Body = io.NopCloser(bytes.NewBuffer(reqBytes))
+		}
+
+		// limit the request time, then retry if it times out
+		ctx := parent
+		if !noRetry {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(parent, p.AttemptTimeout)
+			defer cancel()
+		}
+		req := req.WithContext(ctx)
+
+		sentRequestsCnt.WithLabelValues(op).Inc()
+		resp, err = t.inner.RoundTrip(req)
+		if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+			log.Warn("retry: request timed out", "num", i, "timeout", p.AttemptTimeout, "error", err)
+			timeoutsCnt.WithLabelValues(op).Inc()
+			continue
+		}
+		if err != nil && idempotent && parent.Err() == nil && isNetworkError(err) && i < p.Attempts-1 {
+			log.Warn("retry: network error", "num", i, "error", err)
+			retriesCnt.WithLabelValues(op).Inc()
+			if err = sleep(parent, p.delay(i, nil)); err != nil {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		var respBytes []byte
+		respBytes, err = io.ReadAll(resp.Body)
+		if err != nil {
+			break
+		}
+
+		log.Debug("retry: response", "num", i, "status", resp.StatusCode, "body", truncate(Redact(respBytes), 200))
+
+		resp.Body = io.NopCloser(bytes.NewBuffer(respBytes))
+
+		retryable = doRetry(resp, respBytes)
+		if !retryable {
+			break
+		}
+
+		if i == p.Attempts-1 {
+			break
+		}
+
+		delay := p.delay(i, resp)
+		if deadline, ok := parent.Deadline(); ok && time.Until(deadline) < delay {
+			// caller won't wait for the result anyway, return the last response
+			log.Warn("retry: backoff exceeds deadline, giving up", "num", i, "backoff", delay)
+			break
+		}
+
+		retriesCnt.WithLabelValues(op).Inc()
+		if err = sleep(parent, delay); err != nil {
+			resp = nil
+			break
+		}
+	}
+
+	if t.observer != nil && !errors.Is(parent.Err(), context.Canceled) {
+		t.observer(op, err != nil || retryable)
+	}
+
+	return resp, err
+}
+
+// operationName returns a short name of the request for logs and metrics.
+// For GraphQL requests it's the operation name if set, otherwise the first queried field,
+// e.g. "getStations" or "reserveBike". For other requests it's the URL path.
+func operationName(req *http.Request, reqBytes []byte) string {
+	var body struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+	if err := json.Unmarshal(reqBytes, &body); err != nil || body.Query == "" {
+		return req.URL.Path
+	}
+	if body.OperationName != "" {
+		return body.OperationName
+	}
+
+	// skip operation type and variables definition, e.g. "query ($input:String!){getDocks(input: $input){...}}"
+	_, sel, ok := strings.Cut(body.Query, "{")
+	if !ok {
+		return "unknown"
+	}
+	sel = strings.TrimSpace(sel)
+	end := strings.IndexFunc(sel, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if end == -1 {
+		end = len(sel)
+	}
+	if end == 0 {
+		return "unknown"
+	}
+	return sel[:end]
+}
+
+func doRetry(resp *http.Response, respBytes []byte) bool {
+	// if we got 5xx, retry
+	if resp.StatusCode/100 == 5 {
+		return true
+	}
+
+	// sometimes backend just returns shitty INVALID_OPERATION error, retry it
+	if IsInvalidOperationError(respBytes) {
+		return true
+	}
+
+	// otherwise, don't retry
+	return false
+}
+
+func IsInvalidOperationError(respBytes []byte) bool {
+	var rv struct {
+		Errors graphql.Errors
+	}
+
+	// if we can't decode response as expected error, don't retry
+	if err := json.NewDecoder(bytes.NewBuffer(respBytes)).Decode(&rv); err != nil {
+		return false
+	}
+
+	if len(rv.Errors) == 1 {
+		if ext := rv.Errors[0].Extensions; ext != nil {
+			code, ok := ext["code"].(string)
+			if ok && code == "INVALID_OPERATION" {
+				//log.Println("retry: invalid operation error")
+				return true
+			}
+
+			// Jesus, sometimes it's an array
+			codes, ok := ext["codes"].([]any)
+			if ok && len(codes) > 0 && codes[0] == "INVALID_OPERATION" {
+				//log.Println("retry: invalid operation error")
+				return true
+			}
+		}
+	}
+
+	return false
+}
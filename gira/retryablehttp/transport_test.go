@@ -0,0 +1,236 @@
+package retryablehttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOperationName(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://c2g091p01.emel.pt/auth/token/refresh", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"query":"{getStations{code,name}}"}`, "getStations"},
+		{`{"query":"query ($input:String!){getDocks(input: $input){code},getBikes(input: $input){code}}","variables":{"input":"1"}}`, "getDocks"},
+		{`{"query":"mutation ($input:String!){reserveBike(input: $input)}"}`, "reserveBike"},
+		{`{"query":"{ client { code } }","operationName":"ClientInfo"}`, "ClientInfo"},
+		{`{"query":"{}"}`, "unknown"},
+		{`{"Token":"abc"}`, "/auth/token/refresh"},
+		{``, "/auth/token/refresh"},
+	}
+
+	for _, tt := range tests {
+		if got := operationName(req, []byte(tt.body)); got != tt.want {
+			t.Errorf("operationName(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, Multiplier: 2}
+	for i, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if got := p.backoff(i); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestTransportPolicyAttempts(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	var failed bool
+	httpc := &http.Client{Transport: NewTransport(nil,
+		WithPolicy(Policy{Attempts: 3, AttemptTimeout: time.Second, BaseDelay: time.Millisecond, Multiplier: 1}),
+		WithResultObserver(func(_ string, f bool) { failed = f }),
+	)}
+
+	resp, err := httpc.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d, want 3", hits.Load())
+	}
+	if !failed {
+		t.Error("observer got success, want failure")
+	}
+}
+
+func TestTransportWithoutRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// longer than attempt timeout, but the only attempt isn't limited by it
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	httpc := &http.Client{Transport: NewTransport(nil,
+		WithPolicy(Policy{Attempts: 3, AttemptTimeout: 10 * time.Millisecond, BaseDelay: time.Millisecond, Multiplier: 1}),
+	)}
+
+	req, err := http.NewRequestWithContext(WithoutRetries(context.Background()), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+}
+
+func TestTransportIdempotentNetworkErrors(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			// drop the connection without response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	inner := &http.Transport{DisableKeepAlives: true}
+	httpc := &http.Client{Transport: NewTransport(inner,
+		WithPolicy(Policy{Attempts: 3, AttemptTimeout: time.Second, BaseDelay: time.Millisecond, Multiplier: 1}),
+	)}
+
+	// not idempotent request fails on the first network error
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := httpc.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("request succeeded, want network error")
+	}
+
+	hits.Store(0)
+	req, err = http.NewRequestWithContext(WithIdempotent(context.Background()), http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 2 {
+		t.Errorf("hits = %d, want 2", hits.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"Wed, 01 May 2024 12:00:10 GMT", 10 * time.Second},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.v, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, Multiplier: 1, Jitter: 0.2}
+	for range 100 {
+		if d := p.delay(0, nil); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("delay = %v, want within 20%% of 1s", d)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"5"}}}
+	if d := p.delay(0, resp); d != 5*time.Second {
+		t.Errorf("delay with Retry-After = %v, want 5s", d)
+	}
+}
+
+func TestTransportDeadlineCapsRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	httpc := &http.Client{Transport: NewTransport(nil,
+		WithPolicy(Policy{Attempts: 10, AttemptTimeout: time.Second, BaseDelay: time.Hour, Multiplier: 1}),
+	)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := httpc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if hits.Load() != 1 || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("hits = %d, status = %d, want single attempt with its response", hits.Load(), resp.StatusCode)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("took %v, want no backoff sleep", time.Since(start))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"email":"a@b.c","password":"p\"w"}`, `{"email":"[redacted]","password":"[redacted]"}`},
+		{`{"data":{"refreshToken": "abc", "expiration": "2024"}}`, `{"data":{"refreshToken": "[redacted]", "expiration": "2024"}}`},
+		{`{"query":"subscription { serverDate(_access_token: \"eyJhbGci.eyJzdWIi.c2ln\") }"}`, `{"query":"subscription { serverDate(_access_token: \"[redacted]\") }"}`},
+		{`{"data":{"getStations":[{"name":"101 - Alameda"}]}}`, `{"data":{"getStations":[{"name":"101 - Alameda"}]}}`},
+	}
+	for _, tt := range tests {
+		if got := Redact([]byte(tt.body)); got != tt.want {
+			t.Errorf("Redact(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
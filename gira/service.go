@@ -0,0 +1,106 @@
+package gira
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ServiceStatus is the operational status of Gira service, as shown in the official app.
+type ServiceStatus struct {
+	Code        string
+	Status      string
+	Name        string
+	Description string
+}
+
+// Operational returns whether the service works normally.
+func (s ServiceStatus) Operational() bool {
+	return s.Status == "" || strings.EqualFold(s.Status, string(AssetStatusActive))
+}
+
+// Message is an announcement shown in the official app, e.g. about planned maintenance.
+type Message struct {
+	Code        string
+	Title       string
+	Description string
+	StartDate   time.Time
+	EndDate     time.Time
+}
+
+// ActiveAt returns whether the message should be shown at t. Zero dates are open bounds.
+func (m Message) ActiveAt(t time.Time) bool {
+	return (m.StartDate.IsZero() || !t.Before(m.StartDate)) && (m.EndDate.IsZero() || t.Before(m.EndDate))
+}
+
+type innerServiceStatus struct {
+	Code        string
+	Status      string
+	Name        string
+	Description string
+}
+
+func (i innerServiceStatus) export() ServiceStatus {
+	return ServiceStatus{
+		Code:        i.Code,
+		Status:      i.Status,
+		Name:        i.Name,
+		Description: i.Description,
+	}
+}
+
+type innerMessage struct {
+	Code        string
+	Name        string
+	Description string
+	StartDate   string
+	EndDate     string
+}
+
+func (i innerMessage) export() Message {
+	startDate, _ := time.Parse(time.RFC3339, i.StartDate)
+	endDate, _ := time.Parse(time.RFC3339, i.EndDate)
+
+	return Message{
+		Code:        i.Code,
+		Title:       i.Name,
+		Description: i.Description,
+		StartDate:   startDate,
+		EndDate:     endDate,
+	}
+}
+
+// GetServiceStatus returns current status of Gira service. It returns ErrNoServiceStatusFound
+// if backend has no status, which is also what it replies on unlock in that case.
+func (c *Client) GetServiceStatus(ctx context.Context) (ServiceStatus, error) {
+	var query struct {
+		ServiceStatus []innerServiceStatus `graphql:"getServiceStatus"`
+	}
+	if err := c.query(ctx, "getServiceStatus", &query, nil); err != nil {
+		return ServiceStatus{}, err
+	}
+
+	if len(query.ServiceStatus) == 0 {
+		return ServiceStatus{}, ErrNoServiceStatusFound
+	}
+	return query.ServiceStatus[0].export(), nil
+}
+
+// GetMessages returns announcements currently published in the official app.
+func (c *Client) GetMessages(ctx context.Context) ([]Message, error) {
+	var query struct {
+		Messages []innerMessage `graphql:"getMessages"`
+	}
+	if err := c.query(ctx, "getMessages", &query, nil); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var res []Message
+	for _, m := range query.Messages {
+		if msg := m.export(); msg.ActiveAt(now) {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
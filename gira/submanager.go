@@ -0,0 +1,231 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira/emeltls"
+)
+
+const (
+	subscriptionURL = "wss://c2g091p01.emel.pt/ws/graphql"
+	// subscriptionIdleTimeout is how long connection can stay silent before it's considered dead and reopened.
+	subscriptionIdleTimeout = 2 * time.Minute
+)
+
+// errSubscriptionIdle is returned by runOnce if connection stopped delivering messages.
+var errSubscriptionIdle = errors.New("gira: subscription connection is idle")
+
+var (
+	subManagersMu sync.Mutex
+	// subManagers are per token source, so all subscriptions of one account share a websocket.
+	subManagers = map[oauth2.TokenSource]*subscriptionManager{}
+)
+
+// subscriptionManagerFor returns the manager of subscriptions authenticated with ts.
+// Manager logs to log of the subscription which created it.
+func subscriptionManagerFor(ts oauth2.TokenSource, log *slog.Logger) *subscriptionManager {
+	subManagersMu.Lock()
+	defer subManagersMu.Unlock()
+
+	m, ok := subManagers[ts]
+	if !ok {
+		m = &subscriptionManager{ts: ts, log: log, subs: map[int]*managedSubscription{}}
+		subManagers[ts] = m
+	}
+	return m
+}
+
+// subscriptionManager multiplexes subscriptions over one websocket connection. Connection is opened
+// with the first subscription and closed after the last one ends. On reconnect, e.g. when token
+// expires, all subscriptions are resubscribed on the new connection.
+type subscriptionManager struct {
+	ts  oauth2.TokenSource
+	log *slog.Logger
+
+	mu      sync.Mutex
+	subs    map[int]*managedSubscription
+	nextKey int
+	running bool
+	// sc is the current connection, nil between reconnects
+	sc *graphql.SubscriptionClient
+}
+
+type managedSubscription struct {
+	query       any
+	handler     func([]byte, error) error
+	onReconnect func()
+	// id is the subscription ID on the current connection
+	id string
+}
+
+// add subscribes to query until ctx is done. Handler returning graphql.ErrSubscriptionStopped
+// makes the whole connection reconnect, other errors stop just this subscription.
+// If onReconnect is not nil, it's called after each reconnect, so that subscription can catch up.
+func (m *subscriptionManager) add(ctx context.Context, query any, handler func([]byte, error) error, onReconnect func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.nextKey
+	m.nextKey++
+
+	sub := &managedSubscription{query: query, onReconnect: onReconnect}
+	sub.handler = func(msg []byte, err error) error {
+		err = handler(msg, err)
+		if err != nil && !errors.Is(err, graphql.ErrSubscriptionStopped) {
+			// don't hold the library, remove takes the lock
+			go m.remove(key)
+			return nil
+		}
+		return err
+	}
+	m.subs[key] = sub
+	subActiveGauge.Inc()
+
+	if m.sc != nil {
+		if err := m.subscribe(m.sc, sub); err != nil {
+			m.log.Error("gira: subscription create error", "error", err)
+		}
+	}
+	if !m.running {
+		m.running = true
+		go m.run()
+	}
+
+	go func() {
+		<-ctx.Done()
+		m.remove(key)
+	}()
+}
+
+// subscribe adds sub to connection sc, m.mu must be held.
+func (m *subscriptionManager) subscribe(sc *graphql.SubscriptionClient, sub *managedSubscription) error {
+	tok, err := m.ts.Token()
+	if err != nil {
+		return err
+	}
+	sub.id, err = sc.Subscribe(sub.query, map[string]any{"token": tok.AccessToken}, sub.handler)
+	return err
+}
+
+// remove ends subscription key, closing the connection if it was the last one.
+func (m *subscriptionManager) remove(key int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, ok := m.subs[key]
+	if !ok {
+		return
+	}
+	delete(m.subs, key)
+	subActiveGauge.Dec()
+
+	if m.sc == nil {
+		return
+	}
+	if len(m.subs) == 0 {
+		if err := m.sc.Close(); err != nil {
+			m.log.Warn("gira: subscription close error", "error", err)
+		}
+		return
+	}
+	if err := m.sc.Unsubscribe(sub.id); err != nil {
+		m.log.Warn("gira: subscription unsubscribe error", "error", err)
+	}
+}
+
+// run keeps the connection while there are subscriptions.
+func (m *subscriptionManager) run() {
+	for reconnect := false; ; reconnect = true {
+		m.mu.Lock()
+		if len(m.subs) == 0 {
+			m.running = false
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+
+		err := m.runOnce(reconnect)
+		if errors.Is(err, errSubscriptionIdle) {
+			m.log.Info("gira: subscription connection idle, reconnecting")
+			subIdleCnt.Inc()
+			continue
+		}
+		if err != nil {
+			// connection can't be established, e.g. token is revoked
+			m.log.Error("gira: subscription connection error", "error", err)
+			m.mu.Lock()
+			subActiveGauge.Sub(float64(len(m.subs)))
+			clear(m.subs)
+			m.running = false
+			m.mu.Unlock()
+			return
+		}
+
+		// do not overload server with retries
+		time.Sleep(time.Second + time.Duration(rand.Intn(1000))*time.Millisecond)
+	}
+}
+
+// runOnce opens a connection with all current subscriptions and runs it until it's stopped or closed.
+// On reconnect, subscriptions are notified once they are re-established.
+func (m *subscriptionManager) runOnce(reconnect bool) (err error) {
+	subConnectsCnt.Inc()
+
+	// span covers the whole connection lifetime
+	_, span := startSpan(context.Background(), "subscription")
+	defer func() { endSpan(span, err) }()
+
+	sc := graphql.NewSubscriptionClient(subscriptionURL).
+		WithWebSocketOptions(graphql.WebsocketOptions{
+			HTTPClient: &http.Client{Transport: emeltls.Transport()},
+			HTTPHeader: http.Header{
+				"User-Agent": []string{"Gira/3.4.3 (Android 34)"},
+			},
+		}).
+		WithWebsocketConnectionIdleTimeout(subscriptionIdleTimeout).
+		OnError(func(sc *graphql.SubscriptionClient, err error) error {
+			if sc.IsWebsocketConnectionIdleTimeout(err) {
+				// stop to reconnect with fresh token, instead of library's reconnect with the same one
+				return errSubscriptionIdle
+			}
+			// let library reconnect
+			return nil
+		})
+
+	m.mu.Lock()
+	var onReconnect []func()
+	for _, sub := range m.subs {
+		if err := m.subscribe(sc, sub); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		if reconnect && sub.onReconnect != nil {
+			onReconnect = append(onReconnect, sub.onReconnect)
+		}
+	}
+	m.sc = sc
+	m.mu.Unlock()
+
+	for _, f := range onReconnect {
+		go f()
+	}
+
+	subConnsGauge.Inc()
+	defer func() {
+		subConnsGauge.Dec()
+		m.mu.Lock()
+		m.sc = nil
+		m.mu.Unlock()
+	}()
+
+	return sc.Run()
+}
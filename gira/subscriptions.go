@@ -0,0 +1,283 @@
+package gira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"github.com/hasura/go-graphql-client/pkg/jsonutil"
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/oauth2"
+)
+
+func SubscribeServerDate(ctx context.Context, ts oauth2.TokenSource) (<-chan time.Time, error) {
+	type qType struct {
+		ServerDate struct {
+			Date string
+		} `graphql:"serverDate(_access_token: $token)"`
+	}
+
+	ch := newUpdateChan[time.Time](ctx, 16)
+
+	log := slog.Default()
+	startSubscription(ctx, log, qType{}, ts, func(msg qType) bool {
+		log.Debug("gira: server date", "date", msg.ServerDate.Date)
+		t, _ := time.Parse(time.RFC3339, msg.ServerDate.Date)
+		ch.send(t)
+		return true
+	}, nil)
+
+	return ch.ch, nil
+}
+
+// updateChan is a channel which is closed when ctx is done, and which is safe to send to after that.
+type updateChan[T any] struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	closed bool
+	ch     chan T
+}
+
+func newUpdateChan[T any](ctx context.Context, size int) *updateChan[T] {
+	u := &updateChan[T]{ctx: ctx, ch: make(chan T, size)}
+	go func() {
+		<-ctx.Done()
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.closed = true
+		close(u.ch)
+	}()
+	return u
+}
+
+// send sends v unless ctx is done.
+func (u *updateChan[T]) send(v T) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return
+	}
+	select {
+	case u.ch <- v:
+	case <-u.ctx.Done():
+	}
+}
+
+type TripUpdate struct {
+	Code            TripCode
+	Bike            string
+	StartDate       time.Time
+	EndDate         time.Time
+	Cost            Money
+	Finished        bool
+	Canceled        bool
+	CanPayWithMoney bool
+	CanUsePoints    bool
+	ClientPoints    int
+	TripPoints      int
+	Period          string
+	PeriodTime      string
+	Error           int
+}
+
+// PrettyDuration returns the duration of the trip in a human-readable format.
+// If the trip is still ongoing, the current time is used as the end time.
+func (t TripUpdate) PrettyDuration() string {
+	return prettyDuration(t.StartDate, t.EndDate)
+}
+
+func prettyDuration(startTs, endTs time.Time) string {
+	if endTs.IsZero() {
+		endTs = time.Now()
+	}
+
+	duration := int(endTs.Sub(startTs).Seconds())
+	h, m, s := duration/3600, (duration/60)%60, duration%60
+
+	durStr := fmt.Sprintf("%02d:%02d", m, s)
+	if h > 0 {
+		durStr = fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return durStr
+}
+
+// SubscribeActiveTrips returns a channel with updates of user's active trips. If api is not nil,
+// the last seen trip is re-checked with it after each reconnect, so that updates sent while
+// disconnected, most importantly the final one, are not missed. Subscription logs to the logger
+// of api if it's a Client, see WithLogger.
+func SubscribeActiveTrips(ctx context.Context, ts oauth2.TokenSource, api API) (<-chan TripUpdate, error) {
+	type tripUpdate struct {
+		Code            string
+		Bike            string
+		StartDate       string
+		EndDate         string
+		Cost            float64
+		Finished        bool
+		Canceled        bool
+		CanPayWithMoney bool
+		CanUsePoints    bool
+		ClientPoints    int
+		TripPoints      int
+		Period          string
+		PeriodTime      string
+		Error           int
+	}
+
+	type qType struct {
+		TripDetail tripUpdate `graphql:"activeTripSubscription(_access_token: $token)"`
+	}
+
+	ch := newUpdateChan[TripUpdate](ctx, 16)
+	log := loggerOf(api)
+
+	var (
+		lastMu sync.Mutex
+		last   TripUpdate
+	)
+
+	cb := func(msg qType) bool {
+		log.Debug("gira: active trip update", "update", msg.TripDetail)
+
+		td := msg.TripDetail
+
+		if td.Error == 401 {
+			return false
+		}
+
+		// sometimes backend sends this dummy update, ignore it
+		if td.Code == "no_trip" {
+			return true
+		}
+
+		startT, _ := time.Parse(time.RFC3339, td.StartDate)
+		endT, _ := time.Parse(time.RFC3339, td.EndDate)
+		upd := TripUpdate{
+			Code:            TripCode(td.Code),
+			Bike:            td.Bike,
+			StartDate:       startT,
+			EndDate:         endT,
+			Cost:            MoneyFromEuros(td.Cost),
+			Finished:        td.Finished,
+			Canceled:        td.Canceled,
+			CanPayWithMoney: td.CanPayWithMoney,
+			CanUsePoints:    td.CanUsePoints,
+			ClientPoints:    td.ClientPoints,
+			TripPoints:      td.TripPoints,
+			Period:          td.Period,
+			PeriodTime:      td.PeriodTime,
+			Error:           td.Error,
+		}
+		lastMu.Lock()
+		last = upd
+		lastMu.Unlock()
+		ch.send(upd)
+		return true
+	}
+
+	var onReconnect func()
+	if api != nil {
+		onReconnect = func() {
+			lastMu.Lock()
+			prev := last
+			lastMu.Unlock()
+			if prev.Code == "" || prev.Finished || prev.Canceled {
+				return
+			}
+
+			rctx, cancel := context.WithTimeout(ctx, resyncTimeout)
+			defer cancel()
+			upd, err := resyncActiveTrip(rctx, api, prev)
+			if err != nil {
+				log.Warn("gira: active trip resync error", "trip", prev.Code, "error", err)
+				return
+			}
+			log.Info("gira: active trip resynced", "trip", upd.Code, "finished", upd.Finished)
+			ch.send(upd)
+		}
+	}
+
+	startSubscription(ctx, log, qType{}, ts, cb, onReconnect)
+	return ch.ch, nil
+}
+
+// resyncTimeout limits queries of active trip resync after reconnect.
+const resyncTimeout = 30 * time.Second
+
+// resyncActiveTrip returns the current state of trip last seen in subscription, fetched with queries.
+// If the trip is not active anymore, it's reported as finished. Payment options are not returned
+// by queries, so they are derived from the cost.
+func resyncActiveTrip(ctx context.Context, api API, last TripUpdate) (TripUpdate, error) {
+	active, err := api.GetActiveTrip(ctx)
+	if err != nil && !errors.Is(err, ErrNoActiveTrip) {
+		return TripUpdate{}, err
+	}
+	if err == nil && active.Code == last.Code {
+		upd := last
+		upd.Cost = active.Cost
+		return upd, nil
+	}
+
+	// trip ended while subscription was disconnected
+	trip, err := api.GetTrip(ctx, last.Code)
+	if err != nil {
+		return TripUpdate{}, err
+	}
+
+	upd := last
+	upd.Finished = true
+	upd.EndDate = trip.EndDate
+	upd.Cost = trip.Cost
+	upd.CanPayWithMoney = trip.Cost > 0
+	upd.CanUsePoints = trip.Cost > 0
+	upd.TripPoints = trip.TotalBonus
+	return upd, nil
+}
+
+var (
+	subCnt             = promauto.NewCounter(prometheus.CounterOpts{Name: "gira_subscriptions_total"})
+	subConnectsCnt     = promauto.NewCounter(prometheus.CounterOpts{Name: "gira_subscriptions_connects_total"})
+	subReceivedMsgsCnt = promauto.NewCounter(prometheus.CounterOpts{Name: "gira_subscriptions_received_msgs_total"})
+	subInvalidErrsCnt  = promauto.NewCounter(prometheus.CounterOpts{Name: "gira_subscriptions_invalid_errors_total"})
+	subActiveGauge     = promauto.NewGauge(prometheus.GaugeOpts{Name: "gira_subscriptions_active"})
+	subConnsGauge      = promauto.NewGauge(prometheus.GaugeOpts{Name: "gira_subscriptions_connections"})
+	subIdleCnt         = promauto.NewCounter(prometheus.CounterOpts{Name: "gira_subscriptions_idle_reconnects_total"})
+)
+
+// startSubscription subscribes to query until ctx is done, calling cb with each message and logging to log.
+// If onReconnect is not nil, it's called after subscription is re-established on a new connection.
+func startSubscription[T any](ctx context.Context, log *slog.Logger, query any, ts oauth2.TokenSource, cb func(T) bool, onReconnect func()) {
+	subCnt.Inc()
+
+	handler := func(msg []byte, err error) error {
+		var val T
+		if err != nil {
+			if retryablehttp.IsInvalidOperationError([]byte(err.Error())) {
+				subInvalidErrsCnt.Inc()
+				// backend regularly returns this error, retry it
+				log.Debug("gira: subscription error was INVALID_OPERATION")
+				return graphql.ErrSubscriptionStopped
+			}
+			// other errors are fatal, don't retry
+			log.Error("gira: subscription error", "error", err)
+			return err
+		}
+		if err := jsonutil.UnmarshalGraphQL(msg, &val); err != nil {
+			log.Error("gira: subscription unmarshal error", "error", err, "msg", retryablehttp.Redact(msg))
+			return err
+		}
+		subReceivedMsgsCnt.Inc()
+		if !cb(val) {
+			log.Info("gira: subscription callback returned false, reconnecting")
+			return graphql.ErrSubscriptionStopped
+		}
+		return nil
+	}
+
+	subscriptionManagerFor(ts, log).add(ctx, query, handler, onReconnect)
+}
@@ -0,0 +1,69 @@
+package gira
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// tripAPI is API with just active trip and trip queries.
+type tripAPI struct {
+	API
+	active *Trip
+	trips  map[TripCode]Trip
+}
+
+func (a tripAPI) GetActiveTrip(context.Context) (Trip, error) {
+	if a.active == nil {
+		return Trip{}, ErrNoActiveTrip
+	}
+	return *a.active, nil
+}
+
+func (a tripAPI) GetTrip(_ context.Context, code TripCode) (Trip, error) {
+	return a.trips[code], nil
+}
+
+func TestResyncActiveTrip(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	last := TripUpdate{Code: "t1", Bike: "E0001", StartDate: start, Cost: 0}
+
+	upd, err := resyncActiveTrip(context.Background(), tripAPI{active: &Trip{Code: "t1", Cost: 50}}, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd.Finished || upd.Cost != 50 || upd.Bike != "E0001" {
+		t.Errorf("ongoing trip update = %+v", upd)
+	}
+
+	end := start.Add(50 * time.Minute)
+	api := tripAPI{trips: map[TripCode]Trip{"t1": {Code: "t1", EndDate: end, Cost: 200, TotalBonus: 10}}}
+	upd, err = resyncActiveTrip(context.Background(), api, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upd.Finished || !upd.EndDate.Equal(end) || upd.Cost != 200 || !upd.CanPayWithMoney || upd.TripPoints != 10 {
+		t.Errorf("finished trip update = %+v", upd)
+	}
+
+	// another trip is active already, so the last one is finished too
+	api.active = &Trip{Code: "t2"}
+	upd, err = resyncActiveTrip(context.Background(), api, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upd.Finished || upd.Code != "t1" {
+		t.Errorf("update with newer trip active = %+v", upd)
+	}
+}
+
+func TestUpdateChanSendAfterDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	u := newUpdateChan[int](ctx, 1)
+	u.send(1)
+	cancel()
+
+	// must not panic or block, even with full buffer
+	u.send(2)
+	u.send(3)
+}
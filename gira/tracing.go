@@ -0,0 +1,26 @@
+package gira
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses global tracer provider, so spans are no-op unless the app sets one up.
+var tracer = otel.Tracer("github.com/ilyaluk/girabot/gira")
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startSpan starts a span for Gira operation op.
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "gira."+op, trace.WithSpanKind(trace.SpanKindClient))
+}
@@ -2,6 +2,7 @@ package gira
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -36,12 +37,18 @@ var (
 type ClientInfo struct {
 	Code    UserCode
 	Name    string
-	Balance float64
+	Balance Money
 	Bonus   int
 
 	ActiveSubscriptions []ClientSubscription
 }
 
+// Balance is user's account balance and bonus points, see Client.GetBalance.
+type Balance struct {
+	Balance Money
+	Bonus   int
+}
+
 type ClientSubscription struct {
 	Code   SubscriptionCode
 	User   UserCode
@@ -53,7 +60,7 @@ type ClientSubscription struct {
 	ExpirationDate     time.Time
 
 	Subscription            string
-	Cost                    float64
+	Cost                    Money
 	SubscriptionCode        string
 	SubscriptionName        string
 	SubscriptionDescription string
@@ -124,12 +131,40 @@ type Bike struct {
 
 	Name    string
 	Type    BikeType
-	Battery string
+	Battery BatteryPercent
 
 	// set only if returned from GetStationDocks
 	DockNumber int
 }
 
+// BatteryPercent is e-bike battery charge level in percent, or BatteryUnknown.
+type BatteryPercent int
+
+// BatteryUnknown is battery level of conventional bikes, and of electric ones without reported level.
+const BatteryUnknown BatteryPercent = -1
+
+// parseBattery parses battery level as reported by Gira, e.g. "80".
+func parseBattery(s string) BatteryPercent {
+	pct, err := strconv.Atoi(s)
+	if err != nil || pct < 0 || pct > 100 {
+		return BatteryUnknown
+	}
+	return BatteryPercent(pct)
+}
+
+// Known returns whether battery level is reported.
+func (b BatteryPercent) Known() bool {
+	return b != BatteryUnknown
+}
+
+// String returns battery level like "80%", or "?" if it's unknown.
+func (b BatteryPercent) String() string {
+	if !b.Known() {
+		return "?"
+	}
+	return fmt.Sprintf("%d%%", int(b))
+}
+
 func (b Bike) PrettyString() string {
 	switch b.Type {
 	case BikeTypeConventional:
@@ -141,17 +176,15 @@ func (b Bike) PrettyString() string {
 }
 
 func (b Bike) PrettyBattery() string {
-	switch b.Battery {
-	case "100":
+	if b.Battery == 100 {
 		return "💯"
-	case "":
-		return ""
-	default:
-		return b.Battery + "%"
 	}
+	return b.Battery.String()
 }
 
-func (b Bike) TextString() string {
+// TextString describes the bike, with range estimate of electric bike for range fullRangeKm with full battery,
+// see RangeKm. Range is not shown if fullRangeKm is 0.
+func (b Bike) TextString(fullRangeKm float64) string {
 	res := fmt.Sprintf("Dock %d; ", b.DockNumber)
 
 	switch b.Type {
@@ -159,6 +192,9 @@ func (b Bike) TextString() string {
 		res += fmt.Sprintf("Bike️ %s", b.Name)
 	case BikeTypeElectric:
 		res += fmt.Sprintf("Electric bike %s, battery %s", b.Name, b.TextBattery())
+		if km := b.RangeKm(fullRangeKm); km > 0 {
+			res += fmt.Sprintf(" (~%d km)", km)
+		}
 	default:
 		res += fmt.Sprintf("Unknown bike type %s", b.Name)
 	}
@@ -169,10 +205,14 @@ func (b Bike) TextString() string {
 // CallbackData returns the callback data for the bike.
 // It contains enough data to show info about bike.
 func (b Bike) CallbackData() string {
+	battery := ""
+	if b.Battery.Known() {
+		battery = strconv.Itoa(int(b.Battery))
+	}
 	return strings.Join([]string{
 		string(b.Serial),
 		b.Name,
-		b.Battery,
+		battery,
 		fmt.Sprint(b.DockNumber),
 	}, "|")
 }
@@ -187,7 +227,7 @@ func BikeFromCallbackData(data string) (b Bike, err error) {
 	b = Bike{
 		Serial:  BikeSerial(parts[0]),
 		Name:    parts[1],
-		Battery: parts[2],
+		Battery: parseBattery(parts[2]),
 	}
 	b.DockNumber, _ = strconv.Atoi(parts[3])
 
@@ -202,12 +242,19 @@ func BikeFromCallbackData(data string) (b Bike, err error) {
 }
 
 func (b Bike) TextBattery() string {
-	switch b.Battery {
-	case "":
-		return ""
-	default:
-		return b.Battery + "%"
+	return b.Battery.String()
+}
+
+// DefaultEBikeFullRangeKm is approximate range of electric bike with full battery, for RangeKm.
+const DefaultEBikeFullRangeKm = 50.0
+
+// RangeKm returns approximate remaining range of electric bike in kilometers, given its range with
+// full battery, or 0 if it's unknown.
+func (b Bike) RangeKm(fullRangeKm float64) int {
+	if b.Type != BikeTypeElectric || !b.Battery.Known() {
+		return 0
 	}
+	return int(math.Round(float64(b.Battery) / 100 * fullRangeKm))
 }
 
 func (b Bike) Number() int {
@@ -240,14 +287,22 @@ func (ds Docks) ConventionalBikesAvailable() int {
 	return res
 }
 
-func (ds Docks) Free() int {
-	var res int
+// BestElectricBike returns the active electric bike with the highest battery level,
+// or nil if there are no such bikes. Bikes with unknown battery are considered the worst.
+func (ds Docks) BestElectricBike() *Bike {
+	var best *Bike
+	bestBattery := BatteryUnknown
 	for _, d := range ds {
-		if d.Bike == nil && d.Status == AssetStatusActive && d.LedStatus == "green" && d.LockStatus == "unlocked" {
-			res++
+		if d.Bike == nil || d.Bike.Type != BikeTypeElectric || d.Bike.Status != AssetStatusActive {
+			continue
+		}
+		// BatteryUnknown is less than any known level
+		if best == nil || d.Bike.Battery > bestBattery {
+			best = d.Bike
+			bestBattery = d.Bike.Battery
 		}
 	}
-	return res
+	return best
 }
 
 type StationContent struct {
@@ -274,7 +329,7 @@ type Trip struct {
 	EndTripDock       DockCode
 
 	Distance   float64
-	Cost       float64
+	Cost       Money
 	TotalBonus int
 	CostBonus  int
 
@@ -283,6 +338,11 @@ type Trip struct {
 	Comment string
 }
 
+// PrettyDuration returns the duration of the trip in a human-readable format.
+func (t Trip) PrettyDuration() string {
+	return prettyDuration(t.StartDate, t.EndDate)
+}
+
 type innerClientInfo struct {
 	Code    string
 	Name    string
@@ -314,7 +374,7 @@ func (i innerClientInfo) export() ClientInfo {
 	return ClientInfo{
 		Code:    UserCode(i.Code),
 		Name:    i.Name,
-		Balance: i.Balance,
+		Balance: MoneyFromEuros(i.Balance),
 		Bonus:   int(i.Bonus),
 	}
 }
@@ -371,7 +431,7 @@ func (i innerClientSubscription) export() ClientSubscription {
 		ExpirationDate:     expirationDate,
 
 		Subscription:            i.Subscription,
-		Cost:                    i.Cost,
+		Cost:                    MoneyFromEuros(i.Cost),
 		SubscriptionCode:        i.Type.Code,
 		SubscriptionName:        i.Type.Name,
 		SubscriptionDescription: i.Type.Description,
@@ -497,7 +557,7 @@ func (i innerBike) export() Bike {
 
 		Name:    i.Name,
 		Type:    BikeType(i.Type),
-		Battery: i.Battery,
+		Battery: parseBattery(i.Battery),
 	}
 
 	if b.Type == "" {
@@ -510,11 +570,6 @@ func (i innerBike) export() Bike {
 		}
 	}
 
-	if b.Type == BikeTypeElectric && b.Battery == "" {
-		// sometimes the battery is not set
-		b.Battery = "?"
-	}
-
 	return b
 }
 
@@ -564,7 +619,7 @@ func (i innerTrip) export() Trip {
 		Distance:        i.Distance,
 		Rating:          int(i.Rating),
 		Photo:           i.Photo,
-		Cost:            i.Cost,
+		Cost:            MoneyFromEuros(i.Cost),
 		StartOccupation: i.StartOccupation,
 		EndOccupation:   i.EndOccupation,
 		TotalBonus:      int(i.TotalBonus),
@@ -601,13 +656,13 @@ func (i innerTripDetail) export() Trip {
 		EndDate:   endTime,
 		Rating:    int(i.Rating),
 
-		// TODO: convert to asset IDs
+		// backend returns only names, stations are resolved with resolveTripStations
 		BikeName:          i.BikeName,
 		StartLocationName: i.StartLocation,
 		EndLocationName:   i.EndLocation,
 
 		TotalBonus: int(i.Bonus),
 		CostBonus:  int(i.UsedPoints),
-		Cost:       i.Cost,
+		Cost:       MoneyFromEuros(i.Cost),
 	}
 }
@@ -0,0 +1,62 @@
+package gira
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBikeBattery(t *testing.T) {
+	tests := []struct {
+		raw    string
+		pretty string
+		rangeK int
+	}{
+		{"80", "80%", 40},
+		{"100", "💯", 50},
+		{"", "?", 0},
+		{"?", "?", 0},
+	}
+	for _, tt := range tests {
+		b := innerBike{Name: "E0001", Battery: tt.raw}.export()
+		if got := b.PrettyBattery(); got != tt.pretty {
+			t.Errorf("PrettyBattery(%q) = %q, want %q", tt.raw, got, tt.pretty)
+		}
+		if got := b.RangeKm(DefaultEBikeFullRangeKm); got != tt.rangeK {
+			t.Errorf("RangeKm(%q) = %d, want %d", tt.raw, got, tt.rangeK)
+		}
+
+		parsed, err := BikeFromCallbackData(b.CallbackData())
+		if err != nil || parsed.Battery != b.Battery {
+			t.Errorf("BikeFromCallbackData(%q) = %v, %v, want battery %v", b.CallbackData(), parsed, err, b.Battery)
+		}
+	}
+}
+
+func TestBikeTextStringRange(t *testing.T) {
+	b := innerBike{Name: "E0001", Battery: "80"}.export()
+	if got := b.TextString(30); !strings.Contains(got, "(~24 km)") {
+		t.Errorf("TextString(30) = %q, want range 24 km", got)
+	}
+	if got := b.TextString(0); strings.Contains(got, "km") {
+		t.Errorf("TextString(0) = %q, want no range", got)
+	}
+}
+
+func TestResolveTripStations(t *testing.T) {
+	stations := map[StationSerial]Station{
+		"s1": {Code: "c1", Serial: "s1", Name: "101 - Alameda"},
+		"s2": {Code: "c2", Serial: "s2", Name: "202 - Rossio"},
+	}
+
+	trip := Trip{StartLocationName: "101 - alameda", EndLocationName: "202 - Praça D. Pedro IV"}
+	resolveTripStations(stations, &trip)
+	if trip.StartLocation != "c1" || trip.EndLocation != "c2" {
+		t.Errorf("resolved = %q → %q, want c1 → c2", trip.StartLocation, trip.EndLocation)
+	}
+
+	trip = Trip{StartLocationName: "999 - Unknown"}
+	resolveTripStations(stations, &trip)
+	if trip.StartLocation != "" || trip.EndLocation != "" {
+		t.Errorf("resolved unknown = %q → %q", trip.StartLocation, trip.EndLocation)
+	}
+}
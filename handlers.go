@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/mail"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
@@ -20,32 +22,58 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	tele "gopkg.in/telebot.v3"
 	"gopkg.in/telebot.v3/middleware"
-	"gorm.io/gorm/clause"
+	"gorm.io/gorm"
 
-	"github.com/ilyaluk/girabot/internal/gira"
-	"github.com/ilyaluk/girabot/internal/giraauth"
-	"github.com/ilyaluk/girabot/internal/tokenserver"
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/giraauth"
 )
 
 func setupHandlers(s *server) {
 	s.bot.Use(middleware.Recover())
 	s.bot.Use(s.checkUpdateIDMiddleware)
+	s.bot.Use(s.updateLagMiddleware)
 	s.bot.Use(s.addCustomContext)
 
 	s.bot.Handle("/start", wrapHandler((*customContext).handleStart))
-	s.bot.Handle("/login", wrapHandler((*customContext).handleLogin))
+	s.bot.Handle("/login", wrapHandler((*customContext).handleLoginCommand))
+	s.bot.Handle("\f"+btnKeyTypeAddAccountCancel, wrapHandler((*customContext).handleAddAccountCancel))
+	s.bot.Handle("\f"+btnKeyTypeForgotPassword, wrapHandler((*customContext).handleForgotPassword))
 	s.bot.Handle(tele.OnText, wrapHandler((*customContext).handleText))
 
+	// payments are handled for everyone, so that donation is not lost if user logged out meanwhile
+	s.bot.Handle(tele.OnCheckout, wrapHandler((*customContext).handleCheckout))
+	s.bot.Handle(tele.OnPayment, wrapHandler((*customContext).handlePayment))
+
+	// account deletion is available even if user is not logged in
+	s.bot.Handle("/deleteaccount", wrapHandler((*customContext).handleDeleteAccount))
+	s.bot.Handle("\f"+btnKeyTypeDeleteAccount, wrapHandler((*customContext).handleDeleteAccountConfirm))
+
 	s.bot.Handle("/debug", wrapHandler((*customContext).handleDebug), allowlist(*adminID))
 	s.bot.Handle("\f"+btnKeyTypeRetryDebug, wrapHandler((*customContext).handleDebugRetry), allowlist(*adminID))
+	s.bot.Handle("/poolhealth", wrapHandler((*customContext).handlePoolHealth), allowlist(*adminID))
 
 	authed := s.bot.Group()
 	authed.Use(s.checkLoggedIn)
 
 	authed.Handle("/help", wrapHandler((*customContext).handleHelp))
 	authed.Handle("/status", wrapHandler((*customContext).handleStatus))
+	authed.Handle("/logout", wrapHandler((*customContext).handleLogout))
 	authed.Handle(tele.OnLocation, wrapHandler((*customContext).handleLocation))
+	authed.Handle(tele.OnEdited, wrapHandler((*customContext).handleEdited))
+	authed.Handle(tele.OnPhoto, wrapHandler((*customContext).handlePhoto))
 	authed.Handle("/rate", wrapHandler((*customContext).handleSendRateMsg))
+	authed.Handle("/export", wrapHandler((*customContext).handleExport))
+	authed.Handle("/stats", wrapHandler((*customContext).handleStats))
+	authed.Handle("/points", wrapHandler((*customContext).handlePoints))
+	authed.Handle("/unrated", wrapHandler((*customContext).handleUnratedTrips))
+	authed.Handle("/cancel", wrapHandler((*customContext).handleCancelReserve))
+	authed.Handle("/trip", wrapHandler((*customContext).handleTrip))
+	authed.Handle("/accounts", wrapHandler((*customContext).handleAccounts))
+	authed.Handle("/settings", wrapHandler((*customContext).handleSettings))
+	authed.Handle("/commute", wrapHandler((*customContext).handleCommute))
+	authed.Handle("/pricing", wrapHandler((*customContext).handlePricing))
+	authed.Handle("/donate", wrapHandler((*customContext).handleDonate))
+	authed.Handle("/feedback", wrapHandler((*customContext).handleFeedback))
 
 	authed.Handle("/test", wrapHandler((*customContext).handleLocationTest), allowlist(*adminID))
 
@@ -60,6 +88,25 @@ func setupHandlers(s *server) {
 	authed.Handle("\f"+btnKeyTypeStation, wrapHandler((*customContext).handleStation))
 	authed.Handle("\f"+btnKeyTypeBike, wrapHandler((*customContext).handleTapBike))
 	authed.Handle("\f"+btnKeyTypeBikeUnlock, wrapHandler((*customContext).handleUnlockBike))
+	authed.Handle("\f"+btnKeyTypeCancelReserve, wrapHandler((*customContext).handleCancelReserve))
+	authed.Handle("\f"+btnKeyTypeAvoidBike, wrapHandler((*customContext).handleToggleAvoidBike))
+	authed.Handle("\f"+btnKeyTypeFavBike, wrapHandler((*customContext).handleToggleFavoriteBike))
+	authed.Handle("\f"+btnKeyTypeReportBike, wrapHandler((*customContext).handleReportBike))
+	authed.Handle("\f"+btnKeyTypeReportTrip, wrapHandler((*customContext).handleReportTrip))
+	authed.Handle("\f"+btnKeyTypeReportCategory, wrapHandler((*customContext).handleReportCategory))
+	authed.Handle("\f"+btnKeyTypeReportCancel, wrapHandler((*customContext).handleReportCancel))
+	authed.Handle("\f"+btnKeyTypeReportStation, wrapHandler((*customContext).handleReportStation))
+	authed.Handle("\f"+btnKeyTypeShareStation, wrapHandler((*customContext).handleShareStation))
+	authed.Handle("\f"+btnKeyTypeBikeUnlockForce, wrapHandler((*customContext).handleUnlockBikeForce))
+	authed.Handle("\f"+btnKeyTypeUnlockNearestFav, wrapHandler((*customContext).handleUnlockNearestFavorite))
+	authed.Handle("\f"+btnKeyTypeNearbyFilter, wrapHandler((*customContext).handleNearbyFilter))
+	authed.Handle("\f"+btnKeyTypeSetting, wrapHandler((*customContext).handleSetting))
+	authed.Handle("\f"+btnKeyTypeCommute, wrapHandler((*customContext).handleCommuteSetting))
+	authed.Handle("\f"+btnKeyTypeDonate, wrapHandler((*customContext).handleDonateAmount))
+	authed.Handle("\f"+btnKeyTypeFeedbackCancel, wrapHandler((*customContext).handleFeedbackCancel))
+	authed.Handle("\f"+btnKeyTypeSwitchAccount, wrapHandler((*customContext).handleSwitchAccount))
+	authed.Handle("\f"+btnKeyTypeRemoveAccount, wrapHandler((*customContext).handleRemoveAccount))
+	authed.Handle("\f"+btnKeyTypeAddAccount, wrapHandler((*customContext).handleAddAccount))
 	authed.Handle("\f"+btnKeyTypeCloseMenu, wrapHandler((*customContext).deleteCallbackMessageWithReply))
 	authed.Handle("\f"+btnKeyTypeCloseMenuKeepReply, wrapHandler((*customContext).deleteCallbackMessage))
 	authed.Handle("\f"+btnKeyTypeIgnore, wrapHandler((*customContext).respond))
@@ -72,6 +119,8 @@ func setupHandlers(s *server) {
 	authed.Handle("\f"+btnKeyTypeRateAddText, wrapHandler((*customContext).handleRateAddText))
 	authed.Handle("\f"+btnKeyTypeRateCommentCancel, wrapHandler((*customContext).handleCancelAddComment))
 	authed.Handle("\f"+btnKeyTypeRateSubmit, wrapHandler((*customContext).handleRateSubmit))
+	authed.Handle("\f"+btnKeyTypeRateOldStar, wrapHandler((*customContext).handleRateOldStar))
+	authed.Handle("\f"+btnKeyTypeRateOldSubmit, wrapHandler((*customContext).handleRateOldSubmit))
 
 	authed.Handle("\f"+btnKeyTypePayPoints, wrapHandler((*customContext).handlePayPoints))
 	authed.Handle("\f"+btnKeyTypePayMoney, wrapHandler((*customContext).handlePayMoney))
@@ -89,6 +138,38 @@ const (
 	btnKeyTypeBike       = "bike"
 	btnKeyTypeBikeUnlock = "unlock_bike"
 
+	btnKeyTypeCancelReserve = "cancel_reserve"
+
+	btnKeyTypeAvoidBike       = "avoid_bike"
+	btnKeyTypeBikeUnlockForce = "unlock_bike_force"
+	btnKeyTypeFavBike         = "favorite_bike"
+
+	btnKeyTypeReportBike     = "report_bike"
+	btnKeyTypeReportTrip     = "report_trip"
+	btnKeyTypeReportCategory = "report_category"
+	btnKeyTypeReportCancel   = "report_cancel"
+	btnKeyTypeReportStation  = "report_station"
+
+	btnKeyTypeShareStation = "share_station"
+
+	btnKeyTypeUnlockNearestFav = "unlock_nearest_fav"
+	btnKeyTypeNearbyFilter     = "nearby_filter"
+
+	btnKeyTypeSetting = "setting"
+	btnKeyTypeCommute = "commute"
+	btnKeyTypeDonate  = "donate"
+
+	btnKeyTypeFeedbackCancel = "feedback_cancel"
+
+	btnKeyTypeDeleteAccount = "delete_account"
+
+	btnKeyTypeForgotPassword = "forgot_password"
+
+	btnKeyTypeSwitchAccount    = "switch_account"
+	btnKeyTypeRemoveAccount    = "remove_account"
+	btnKeyTypeAddAccount       = "add_account"
+	btnKeyTypeAddAccountCancel = "add_account_cancel"
+
 	btnKeyTypeCloseMenu          = "close_menu"
 	btnKeyTypeCloseMenuKeepReply = "close_menu_keep_reply"
 
@@ -101,6 +182,9 @@ const (
 	btnKeyTypeRateCommentCancel = "rate_comment_cancel"
 	btnKeyTypeRateSubmit        = "rate_submit"
 
+	btnKeyTypeRateOldStar   = "rate_old_star"
+	btnKeyTypeRateOldSubmit = "rate_old_submit"
+
 	btnKeyTypePayPoints = "trip_pay_points"
 	btnKeyTypePayMoney  = "trip_pay_money"
 
@@ -130,6 +214,12 @@ func init() {
 }
 
 func (c *customContext) handleStart() error {
+	if c.user.State >= UserStateLoggedIn {
+		if handled, err := c.handleStartPayload(c.Message().Payload); handled {
+			return err
+		}
+	}
+
 	if err := c.Send(messageHello, tele.ModeMarkdown); err != nil {
 		return err
 	}
@@ -147,6 +237,10 @@ func (c *customContext) handleLogin() error {
 }
 
 func (c *customContext) handleText() error {
+	if handled, err := c.handleAdminReply(); handled {
+		return err
+	}
+
 	switch c.user.State {
 	case UserStateNone:
 		return c.handleStart()
@@ -163,7 +257,7 @@ func (c *customContext) handleText() error {
 		c.user.Email = email
 		c.user.EmailMessageID = c.Message().ID
 
-		if err := c.Send(messagePassword); err != nil {
+		if err := c.Send(messagePassword, forgotPasswordMarkup()); err != nil {
 			return err
 		}
 		c.user.State = UserStateWaitingForPassword
@@ -195,6 +289,7 @@ func (c *customContext) handleText() error {
 			if _, err := c.Bot().Edit(m,
 				"Invalid credentials, please try different password.\n"+
 					"To change email, run /login.",
+				forgotPasswordMarkup(),
 			); err != nil {
 				return err
 			}
@@ -212,11 +307,24 @@ func (c *customContext) handleText() error {
 			return err
 		}
 
-		dbToken := Token{
-			ID:    c.user.ID,
-			Token: tok,
+		if err := c.saveLoginToken(&Token{Token: tok}); err != nil {
+			return err
 		}
-		if err := c.s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&dbToken).Error; err != nil {
+
+		// status below would fail with a generic error, tell broken session from Gira being down
+		if err := c.gira.Ping(c); gira.IsAuthError(err) {
+			log.Printf("[uid:%d] ping after login failed: %v", c.user.ID, err)
+			c.user.Email = ""
+			c.user.EmailMessageID = 0
+			c.user.State = UserStateNone
+			_, err := c.Bot().Edit(m, "Logged in, but Gira doesn't accept the session. Please try /login again a bit later.")
+			return err
+		} else if err != nil {
+			log.Printf("[uid:%d] ping after login failed: %v", c.user.ID, err)
+			c.user.Email = ""
+			c.user.EmailMessageID = 0
+			c.user.State = UserStateLoggedIn
+			_, err := c.Bot().Edit(m, "Logged in, but Gira is not responding right now. Check /status in a few minutes.")
 			return err
 		}
 
@@ -236,9 +344,12 @@ func (c *customContext) handleText() error {
 	case UserStateLoggedIn:
 		return c.handleLoggedInText()
 	case UserStateWaitingForFavName:
-		name := c.Text()
-		if utf8.RuneCountInString(name) > 2 {
-			return c.Send("Name too long, try again")
+		name := strings.TrimSpace(c.Text())
+		if name == "" || strings.Contains(name, "\n") {
+			return c.Send("Name should be a single line, try again")
+		}
+		if utf8.RuneCountInString(name) > favNameMaxLen {
+			return c.Send(fmt.Sprintf("Name too long, %d characters max, try again", favNameMaxLen))
 		}
 		c.user.Favorites[c.user.EditingStationFav] = name
 		c.user.EditingStationFav = ""
@@ -253,21 +364,50 @@ func (c *customContext) handleText() error {
 			return err
 		}
 
-		if err := c.Send("Thanks for the comment! Don't forget to submit the rating."); err != nil {
-			return err
-		}
-
-		_, err := c.Bot().Edit(
-			c.getRateMsg(),
-			messageRateTrip,
-			getStarButtons(c.user.CurrentTripRating.Rating),
-		)
-		return err
+		return c.restoreRateMessage("Thanks for the comment! Don't forget to submit the rating.")
+	case UserStateWaitingForBikeReport:
+		return c.submitBikeReport(c.Text())
+	case UserStateWaitingForStationReport:
+		return c.submitStationReport(c.Text())
+	case UserStateWaitingForFeedback:
+		return c.submitFeedback(c.Text())
 	default:
 		return c.Send("Unknown state")
 	}
 }
 
+// forgotPasswordMarkup returns markup with a button to request password reset for email being logged in with.
+func forgotPasswordMarkup() *tele.ReplyMarkup {
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(tele.Row{{Unique: btnKeyTypeForgotPassword, Text: "🔑 Forgot password?"}})
+	return rm
+}
+
+func (c *customContext) handleForgotPassword() error {
+	if c.user.State != UserStateWaitingForPassword || c.user.Email == "" {
+		return c.Respond(&tele.CallbackResponse{Text: "Login has already ended, start over with /login."})
+	}
+
+	if err := c.s.auth.RequestPasswordReset(c, c.user.Email); err != nil {
+		log.Printf("[uid:%d] password reset error: %v", c.user.ID, err)
+		return c.Respond(&tele.CallbackResponse{
+			Text:      "Couldn't request password reset, please try again or use the official app.",
+			ShowAlert: true,
+		})
+	}
+	log.Printf("[uid:%d] requested password reset", c.user.ID)
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	// button is removed, so that reset emails are not requested over and over
+	return c.Edit(
+		"📧 I've asked Gira to send a password reset link to your email. "+
+			"Set a new password with it, then send it to me here.",
+		&tele.ReplyMarkup{},
+	)
+}
+
 func (c *customContext) deleteMessage(id int) error {
 	return c.Bot().Delete(tele.StoredMessage{
 		ChatID:    c.user.ID,
@@ -289,10 +429,6 @@ func (c *customContext) handleHelp() error {
 	return c.Send(messageHelp, tele.ModeMarkdown, menu)
 }
 
-func (c *customContext) handleFeedback() error {
-	return c.Send(messageFeedback, tele.ModeMarkdown)
-}
-
 type UserState int
 
 const (
@@ -302,6 +438,9 @@ const (
 	UserStateLoggedIn
 	UserStateWaitingForFavName
 	UserStateWaitingForRateComment
+	UserStateWaitingForBikeReport
+	UserStateWaitingForStationReport
+	UserStateWaitingForFeedback
 )
 
 func (c *customContext) handleStatus() error {
@@ -337,19 +476,78 @@ func (c *customContext) handleStatus() error {
 		balanceWarning = " ⚠️ _You won't be able to unlock bikes until you top up in official app._"
 	}
 
-	return c.Send(fmt.Sprintf(
+	// account details are from auth API, status is still useful without them
+	var profileStr string
+	profile, err := c.getProfile(giraauth.UserEmail | giraauth.UserNavegante)
+	if err != nil {
+		log.Printf("[uid:%d] ignored profile error: %v", c.user.ID, err)
+	}
+	if profile.Email != "" {
+		profileStr += fmt.Sprintf("Email: `%s`\n", profile.Email)
+	}
+	if profile.NaveganteNumber != "" {
+		profileStr += fmt.Sprintf("Navegante: `%s`\n", profile.NaveganteNumber)
+	}
+
+	if err := c.Send(fmt.Sprintf(
 		"Logged in. Gira account info:\n"+
 			"Name: `%s`\n"+
-			"Balance: `%.0f€`%s\n"+
+			"%s"+
+			"Balance: `%s`%s\n"+
 			"Bonus: `%d` (`%d€`)\n"+
 			"%s",
 		info.Name,
+		profileStr,
 		info.Balance,
 		balanceWarning,
 		info.Bonus,
-		info.Bonus/500,
+		info.Bonus/pointsPerEuro,
 		subscr,
-	), tele.ModeMarkdown)
+	), tele.ModeMarkdown); err != nil {
+		return err
+	}
+
+	if notice := serviceNotice(c, c.gira); notice != "" {
+		// plain text, announcements are not markdown-safe
+		if err := c.Send("Gira service status:\n" + notice); err != nil {
+			return err
+		}
+	}
+
+	return c.detectActiveTrip()
+}
+
+// detectActiveTrip checks for an active trip the bot is not watching, e.g. started from the official app
+// or if the bot state was lost, and attaches to it.
+func (c *customContext) detectActiveTrip() error {
+	if c.user.hasTripOnOtherAccount() {
+		// only one trip is watched at a time
+		return nil
+	}
+	if c.user.CurrentTripRateAwaiting {
+		// rating of the finished trip refers to CurrentTripCode, attach the new one after it's rated
+		return nil
+	}
+
+	trip, err := c.gira.GetActiveTrip(c)
+	if errors.Is(err, gira.ErrNoActiveTrip) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("[uid:%d] ignored get active trip error: %v", c.user.ID, err)
+		return nil
+	}
+
+	if c.user.CurrentTripCode == trip.Code {
+		// already known and watched
+		return nil
+	}
+
+	log.Printf("[uid:%d] found unknown active trip %s, attaching", c.user.ID, trip.Code)
+	if err := c.Send("🚲 Found an active trip I didn't know about, tracking it now."); err != nil {
+		return err
+	}
+	return c.attachActiveTrip(trip, c.user.tokenID())
 }
 
 func (c *customContext) handleLocationTest() error {
@@ -360,10 +558,56 @@ func (c *customContext) handleLocationTest() error {
 }
 
 func (c *customContext) handleLocation() error {
-	return c.sendNearbyStations(c.Message().Location)
+	loc := c.Message().Location
+	c.user.LastLatitude = float64(loc.Lat)
+	c.user.LastLongitude = float64(loc.Lng)
+	c.user.LastLocationAt = time.Now()
+
+	if loc.LivePeriod > 0 {
+		return c.startLiveLocation(loc)
+	}
+	return c.sendNearbyStations(loc)
+}
+
+const (
+	// stationMaxResults is the default number of nearby stations shown, see UserSettings.
+	stationMaxResults = 5
+	// nearbyFilterCandidates is how many nearest stations are checked when filter is active.
+	nearbyFilterCandidates = 20
+)
+
+// nearbyFilter limits nearby stations to the ones having specific bikes or docks available.
+type nearbyFilter string
+
+const (
+	nearbyFilterAll          nearbyFilter = ""
+	nearbyFilterElectric     nearbyFilter = "electric"
+	nearbyFilterConventional nearbyFilter = "conventional"
+	nearbyFilterFreeDocks    nearbyFilter = "free"
+)
+
+var nearbyFilters = []struct {
+	filter nearbyFilter
+	text   string
+}{
+	{nearbyFilterAll, "All"},
+	{nearbyFilterElectric, "⚡️"},
+	{nearbyFilterConventional, "⚙️"},
+	{nearbyFilterFreeDocks, "🆓"},
 }
 
-const stationMaxResults = 5
+func (f nearbyFilter) matches(docks gira.Docks) bool {
+	switch f {
+	case nearbyFilterElectric:
+		return docks.ElectricBikesAvailable() > 0
+	case nearbyFilterConventional:
+		return docks.ConventionalBikesAvailable() > 0
+	case nearbyFilterFreeDocks:
+		return docks.Free() > 0
+	default:
+		return true
+	}
+}
 
 func (c *customContext) sendNearbyStations(loc *tele.Location) error {
 	err, cleanup := c.sendStationLoader()
@@ -372,10 +616,19 @@ func (c *customContext) sendNearbyStations(loc *tele.Location) error {
 	}
 	defer cleanup()
 
-	ss, err := c.gira.GetStations(c)
+	text, rm, err := c.getNearbyStationsMessage(loc)
 	if err != nil {
 		return err
 	}
+	return c.Reply(text, tele.NoPreview, tele.ModeMarkdown, rm)
+}
+
+// getNearbyStationsMessage returns the list of nearest active stations, filtered by user's nearby filter.
+func (c *customContext) getNearbyStationsMessage(loc *tele.Location) (string, *tele.ReplyMarkup, error) {
+	ss, err := c.gira.GetStations(c)
+	if err != nil {
+		return "", nil, err
+	}
 
 	ss = slices.DeleteFunc(ss, func(i gira.Station) bool {
 		return i.Status != gira.AssetStatusActive
@@ -385,7 +638,80 @@ func (c *customContext) sendNearbyStations(loc *tele.Location) error {
 		return cmp.Compare(distance(i, loc), distance(j, loc))
 	})
 
-	return c.sendStationList(ss[:min(stationMaxResults, len(ss))], loc)
+	if radius := c.user.Settings.NearbyMaxRadius; radius > 0 {
+		ss = slices.DeleteFunc(ss, func(i gira.Station) bool {
+			return distance(i, loc) > float64(radius)
+		})
+	}
+
+	maxResults := c.user.Settings.nearbyMaxResults()
+	if c.user.NearbyFilter == nearbyFilterAll {
+		ss = ss[:min(maxResults, len(ss))]
+		return c.getStationListMessage(ss, c.getStationsDocks(ss), loc)
+	}
+
+	// docks have to be fetched before filtering, so check a bit more stations than shown
+	ss = ss[:min(nearbyFilterCandidates, len(ss))]
+	docks := c.getStationsDocks(ss)
+
+	var (
+		filtered      []gira.Station
+		filteredDocks []gira.Docks
+	)
+	for i, s := range ss {
+		if len(filtered) >= maxResults {
+			break
+		}
+		if c.user.NearbyFilter.matches(docks[i]) {
+			filtered = append(filtered, s)
+			filteredDocks = append(filteredDocks, docks[i])
+		}
+	}
+
+	return c.getStationListMessage(filtered, filteredDocks, loc)
+}
+
+// handleNearbyFilter changes user's nearby filter and updates the station list in place.
+func (c *customContext) handleNearbyFilter() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	parts := strings.Split(cb.Data, "|")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid nearby filter callback data: %q", cb.Data)
+	}
+	lat, err := strconv.ParseFloat(parts[1], 32)
+	if err != nil {
+		return err
+	}
+	lng, err := strconv.ParseFloat(parts[2], 32)
+	if err != nil {
+		return err
+	}
+
+	c.user.NearbyFilter = nearbyFilter(parts[0])
+
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	text, rm, err := c.getNearbyStationsMessage(&tele.Location{Lat: float32(lat), Lng: float32(lng)})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	_, err = c.Bot().Edit(cb.Message, text, tele.NoPreview, tele.ModeMarkdown, rm)
+	if errors.Is(err, tele.ErrSameMessageContent) {
+		return nil
+	}
+	return err
 }
 
 func (c *customContext) sendStationLoader() (error, func()) {
@@ -406,6 +732,11 @@ func (c *customContext) sendStationLoader() (error, func()) {
 }
 
 func (c *customContext) sendTyping() (error, func()) {
+	if c.s.isOverloaded() {
+		// typing indicator is nice to have, save API calls when lagging behind
+		return nil, func() {}
+	}
+
 	done := make(chan struct{})
 	go func() {
 		for {
@@ -430,8 +761,18 @@ func (c *customContext) sendTyping() (error, func()) {
 
 // sendStationList sends a list of stations to the user.
 // If loc is not nil, it will also show the distance to the station.
-// Callers should not pass more than 5 stations at once.
+// Callers should not pass more than nearbyMaxResultsLimit stations at once.
 func (c *customContext) sendStationList(stations []gira.Station, loc *tele.Location) error {
+	text, rm, err := c.getStationListMessage(stations, c.getStationsDocks(stations), loc)
+	if err != nil {
+		return err
+	}
+	return c.Reply(text, tele.NoPreview, tele.ModeMarkdown, rm)
+}
+
+// getStationsDocks concurrently fetches docks of all stations.
+// Docks of stations that failed to load are left empty.
+func (c *customContext) getStationsDocks(stations []gira.Station) []gira.Docks {
 	stationsDocks := make([]gira.Docks, len(stations))
 	wg := sync.WaitGroup{}
 	wg.Add(len(stations))
@@ -446,7 +787,31 @@ func (c *customContext) sendStationList(stations []gira.Station, loc *tele.Locat
 		}(i, s.Serial)
 	}
 	wg.Wait()
+	return stationsDocks
+}
 
+const (
+	// favNameMaxLen is the maximum length of favorite station name in runes.
+	favNameMaxLen = 16
+	// favNameButtonMaxLen is the length of favorite name in station list buttons,
+	// longer names are truncated so that bike counts still fit on narrow screens.
+	favNameButtonMaxLen = 6
+)
+
+// favMarkdownEscaper escapes user-provided favorite names for markdown messages.
+var favMarkdownEscaper = strings.NewReplacer("[", "\\[", "_", "\\_", "*", "\\*", "`", "\\`")
+
+// favButtonLabel returns favorite name shortened for station list buttons.
+func favButtonLabel(name string) string {
+	runes := []rune(name)
+	if len(runes) <= favNameButtonMaxLen {
+		return name
+	}
+	return string(runes[:favNameButtonMaxLen-1]) + "…"
+}
+
+// getStationListMessage returns text and buttons for station list, stationsDocks should match stations.
+func (c *customContext) getStationListMessage(stations []gira.Station, stationsDocks []gira.Docks, loc *tele.Location) (string, *tele.ReplyMarkup, error) {
 	sb := strings.Builder{}
 	rm := &tele.ReplyMarkup{}
 
@@ -456,25 +821,30 @@ func (c *customContext) sendStationList(stations []gira.Station, loc *tele.Locat
 			dist = fmt.Sprintf(" (_%.0fm_)", distance(s, loc))
 		}
 
-		var fav string
+		var fav, btnFav string
 		if name := c.user.Favorites[s.Serial]; name != "" {
 			fav = fmt.Sprintf("[%s] ", name)
+			btnFav = fmt.Sprintf("[%s] ", favButtonLabel(name))
 		}
 
 		sb.WriteString(fmt.Sprintf(
-			"• %s*%s*%s: %s\n",
-			strings.ReplaceAll(fav, "[", "\\["), // escape markdown link
+			"• %s*%s*%s %s: %s\n",
+			favMarkdownEscaper.Replace(fav),
 			s.Number(),
 			dist,
+			occupancyBar(s.Bikes, s.Docks),
 			s.Location(),
 		))
 
-		// apparently, these values are not always the same
-		freeDocks := min(stationsDocks[i].Free(), s.Docks-s.Bikes)
+		for _, b := range c.favoriteBikesIn(stationsDocks[i]) {
+			sb.WriteString(fmt.Sprintf("  💖 your favorite bike %s is here\n", b.Name))
+		}
+
+		freeDocks := gira.FreeDocks(s, stationsDocks[i])
 
 		btnText := fmt.Sprintf(
 			"%s%s: %2d ⚡️ %2d ⚙️ %d 🆓",
-			fav,
+			btnFav,
 			s.Number(),
 			stationsDocks[i].ElectricBikesAvailable(),
 			stationsDocks[i].ConventionalBikesAvailable(),
@@ -490,12 +860,168 @@ func (c *customContext) sendStationList(stations []gira.Station, loc *tele.Locat
 		})
 	}
 
+	if loc != nil && len(stations) == 0 {
+		sb.WriteString("No nearby stations match the filter or max distance from /settings 🤷")
+	}
+
+	if loc != nil {
+		var row []tele.InlineButton
+		for _, f := range nearbyFilters {
+			text := f.text
+			if f.filter == c.user.NearbyFilter {
+				text = "• " + text + " •"
+			}
+			row = append(row, tele.InlineButton{
+				Unique: btnKeyTypeNearbyFilter,
+				Text:   text,
+				Data:   fmt.Sprintf("%s|%.6f|%.6f", f.filter, loc.Lat, loc.Lng),
+			})
+		}
+		rm.InlineKeyboard = append(rm.InlineKeyboard, row)
+	}
+
+	if loc != nil && len(c.user.Favorites) > 0 {
+		rm.InlineKeyboard = append(rm.InlineKeyboard, []tele.InlineButton{{
+			Unique: btnKeyTypeUnlockNearestFav,
+			Text:   "⭐️ Unlock at nearest favorite",
+			Data:   fmt.Sprintf("%.6f|%.6f", loc.Lat, loc.Lng),
+		}})
+	}
+
 	rm.InlineKeyboard = append(rm.InlineKeyboard, []tele.InlineButton{{
 		Unique: btnKeyTypeCloseMenu,
 		Text:   "Close",
 	}})
 
-	return c.Reply(sb.String(), tele.NoPreview, tele.ModeMarkdown, rm)
+	return sb.String(), rm, nil
+}
+
+// handleUnlockNearestFavorite finds the closest favorite station with e-bikes available
+// and sends unlock menu for the best e-bike there.
+func (c *customContext) handleUnlockNearestFavorite() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	latStr, lngStr, _ := strings.Cut(cb.Data, "|")
+	lat, err := strconv.ParseFloat(latStr, 32)
+	if err != nil {
+		return err
+	}
+	lng, err := strconv.ParseFloat(lngStr, 32)
+	if err != nil {
+		return err
+	}
+	loc := &tele.Location{Lat: float32(lat), Lng: float32(lng)}
+
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var stations []gira.Station
+	for serial := range c.user.Favorites {
+		s, err := c.gira.GetStationCached(c, serial)
+		if err != nil {
+			return err
+		}
+		if s.Status == gira.AssetStatusActive {
+			stations = append(stations, s)
+		}
+	}
+
+	slices.SortFunc(stations, func(i, j gira.Station) int {
+		return cmp.Compare(distance(i, loc), distance(j, loc))
+	})
+
+	for _, s := range stations {
+		docks, err := c.gira.GetStationDocks(c, s.Serial)
+		if err != nil {
+			return err
+		}
+
+		bike := c.bestElectricBike(docks)
+		if bike == nil {
+			continue
+		}
+
+		if err := c.Respond(); err != nil {
+			return err
+		}
+		if err := c.Send(fmt.Sprintf("⭐️ Nearest favorite with e-bikes: %s (%.0fm)", s.MapTitle(), distance(s, loc))); err != nil {
+			return err
+		}
+		return c.sendBikeMessage(bike.CallbackData())
+	}
+
+	return c.Respond(&tele.CallbackResponse{Text: "No e-bikes at your favorite stations 😔", ShowAlert: true})
+}
+
+// lastLocationMaxAge is how long user's last shared location is used as directions origin.
+const lastLocationMaxAge = time.Hour
+
+// getDirectionsRow returns buttons with walking directions to the station.
+// Last shared location is used as the origin if it's recent, otherwise maps apps use current location.
+func (c *customContext) getDirectionsRow(station gira.Station) tele.Row {
+	dest := fmt.Sprintf("%f,%f", station.Latitude, station.Longitude)
+
+	googleQ := url.Values{
+		"api":         {"1"},
+		"destination": {dest},
+		"travelmode":  {"walking"},
+	}
+	appleQ := url.Values{
+		"daddr":  {dest},
+		"dirflg": {"w"},
+	}
+
+	if !c.user.LastLocationAt.IsZero() && time.Since(c.user.LastLocationAt) < lastLocationMaxAge {
+		origin := fmt.Sprintf("%f,%f", c.user.LastLatitude, c.user.LastLongitude)
+		googleQ.Set("origin", origin)
+		appleQ.Set("saddr", origin)
+	}
+
+	return tele.Row{
+		{
+			Text: "🚶 Google Maps",
+			URL:  "https://www.google.com/maps/dir/?" + googleQ.Encode(),
+		},
+		{
+			Text: "🚶 Apple Maps",
+			URL:  "https://maps.apple.com/?" + appleQ.Encode(),
+		},
+	}
+}
+
+// freeDocksButtonText returns station view button text with free docks, and out of service ones if any.
+func freeDocksButtonText(a gira.Availability) string {
+	if a.OutOfService == 0 {
+		return fmt.Sprintf("🆓 %d docks", a.Free)
+	}
+	return fmt.Sprintf("🆓 %d docks, 🚫 %d", a.Free, a.OutOfService)
+}
+
+// occupancyBarWidth is the number of segments in station occupancy bar.
+const occupancyBarWidth = 5
+
+// occupancyBar returns a bar like "▰▰▰▱▱ 60%" showing how full the station is.
+func occupancyBar(bikes, docks int) string {
+	if docks <= 0 {
+		return strings.Repeat("▱", occupancyBarWidth) + " 0%"
+	}
+	bikes = max(0, min(bikes, docks))
+	// round to nearest segment, but show at least one for any bikes, and leave one empty for any free docks
+	filled := (bikes*occupancyBarWidth*2 + docks) / (docks * 2)
+	switch {
+	case bikes > 0 && filled == 0:
+		filled = 1
+	case bikes < docks && filled == occupancyBarWidth:
+		filled = occupancyBarWidth - 1
+	}
+	return strings.Repeat("▰", filled) + strings.Repeat("▱", occupancyBarWidth-filled) +
+		fmt.Sprintf(" %d%%", bikes*100/docks)
 }
 
 // distance returns the distance in meters between the station and the location.
@@ -527,38 +1053,83 @@ func (c *customContext) handleLoggedInText() error {
 
 	// if got number, first try to treat it as station number:
 	if _, err := strconv.Atoi(txt); err == nil {
-		stations, err := c.gira.GetStations(c)
-		if err != nil {
+		station, ok, err := c.findActiveStation(txt)
+		if !ok {
 			return err
 		}
+		return c.handleStationInner(station.Serial)
+	}
 
-		var station gira.Station
-		for _, s := range stations {
-			if s.Number() == txt {
-				station = s
-				break
-			}
+	// "472 12" is station and dock number, unlock the bike in that dock
+	if stationNum, dockStr, ok := strings.Cut(txt, " "); ok {
+		_, stErr := strconv.Atoi(stationNum)
+		dockNum, dockErr := strconv.Atoi(strings.TrimSpace(dockStr))
+		if stErr == nil && dockErr == nil {
+			return c.handleStationDock(stationNum, dockNum)
 		}
+	}
 
-		if station.Status == "" {
-			return c.Send("Station not found")
-		}
+	// "E1234" is bike name, show where it's docked
+	chr := strings.ToLower(txt[:1])[0]
+	if _, err := strconv.Atoi(txt[1:]); err == nil && (chr == 'e' || chr == 'c') {
+		return c.handleFindBike(txt)
+	}
 
-		if station.Status != gira.AssetStatusActive {
-			return c.Send("Sorry, station is not active")
+	return c.Send("Unknown command, try /help")
+}
+
+// findActiveStation finds station by its number. If it's not found or not active,
+// user is told about it and ok is false.
+func (c *customContext) findActiveStation(number string) (station gira.Station, ok bool, err error) {
+	stations, err := c.gira.GetStations(c)
+	if err != nil {
+		return gira.Station{}, false, err
+	}
+
+	for _, s := range stations {
+		if s.Number() == number {
+			station = s
+			break
 		}
+	}
 
-		return c.handleStationInner(station.Serial)
+	if station.Status == "" {
+		return gira.Station{}, false, c.Send("Station not found")
 	}
 
-	chr := strings.ToLower(txt[:1])[0]
-	if chr == 'e' || chr == 'c' {
-		// TODO: process as bike number
-		// We can't directly get bike by name, so we need to get all stations and then all docks.
-		// Maybe we can regularly cache all docks and bikes in the background.
+	if station.Status != gira.AssetStatusActive {
+		return gira.Station{}, false, c.Send("Sorry, station is not active")
 	}
 
-	return c.Send("Unknown command, try /help")
+	return station, true, nil
+}
+
+// handleStationDock sends unlock confirmation for the bike in the given dock of the station.
+func (c *customContext) handleStationDock(stationNum string, dockNum int) error {
+	station, ok, err := c.findActiveStation(stationNum)
+	if !ok {
+		return err
+	}
+
+	docks, err := c.gira.GetStationDocks(c, station.Serial)
+	if err != nil {
+		return err
+	}
+
+	for _, dock := range docks {
+		if dock.Number != dockNum {
+			continue
+		}
+		if dock.Bike == nil {
+			return c.Send(fmt.Sprintf("Dock %d at station %s is empty", dockNum, station.Number()))
+		}
+		if dock.Status != gira.AssetStatusActive {
+			return c.Send(fmt.Sprintf("Sorry, dock %d at station %s is not active", dockNum, station.Number()))
+		}
+		return c.sendBikeMessage(dock.Bike.CallbackData())
+	}
+
+	return c.Send(fmt.Sprintf("Dock %d not found at station %s", dockNum, station.Number()))
 }
 
 func (c *customContext) handleStation() error {
@@ -591,7 +1162,12 @@ func (c *customContext) handleStation() error {
 		}
 	}
 
-	if err := c.handleStationInner(serial); err != nil {
+	var docksOpts []gira.CallOption
+	if cb2 == "delete_msg" {
+		// user explicitly asked to refresh
+		docksOpts = append(docksOpts, gira.WithNoCache())
+	}
+	if err := c.handleStationInner(serial, docksOpts...); err != nil {
 		return err
 	}
 
@@ -602,7 +1178,8 @@ func (c *customContext) handleStation() error {
 	return nil
 }
 
-func (c *customContext) handleStationInner(serial gira.StationSerial) error {
+// handleStationInner sends station view, docksOpts are used for fetching docks.
+func (c *customContext) handleStationInner(serial gira.StationSerial, docksOpts ...gira.CallOption) error {
 	err, cleanup := c.sendTyping()
 	if err != nil {
 		return err
@@ -615,13 +1192,14 @@ func (c *customContext) handleStationInner(serial gira.StationSerial) error {
 		return err
 	}
 
-	// but docks are always retrieved fresh
-	docks, err := c.gira.GetStationDocks(c, serial)
+	// docks are retrieved fresh, save for a few seconds of client's docks cache
+	docks, err := c.gira.GetStationDocks(c, serial, docksOpts...)
 	if err != nil {
 		return err
 	}
 
-	freeDocks := docks.Free()
+	availability := docks.Availability()
+	bestEBike := c.bestElectricBike(docks)
 
 	// filter out docks with no bike or not active
 	docks = slices.DeleteFunc(docks, func(d gira.Dock) bool {
@@ -649,7 +1227,7 @@ func (c *customContext) handleStationInner(serial gira.StationSerial) error {
 	for _, dock := range docks {
 		dockBtns = append(dockBtns, tele.Btn{
 			Unique: btnKeyTypeBike,
-			Text:   dock.ButtonString(dock.Bike.Serial == maxEBike.Serial),
+			Text:   c.dockButtonString(dock, dock.Bike.Serial == maxEBike.Serial),
 			Data:   dock.Bike.CallbackData(),
 		})
 	}
@@ -664,6 +1242,13 @@ func (c *customContext) handleStationInner(serial gira.StationSerial) error {
 	}
 
 	btns := rm.Split(2, dockBtns)
+	if bestEBike != nil {
+		btns = append([]tele.Row{{{
+			Unique: btnKeyTypeBike,
+			Text:   "⚡️ Unlock best e-bike: " + bestEBike.PrettyString(),
+			Data:   bestEBike.CallbackData(),
+		}}}, btns...)
+	}
 	btns = append([]tele.Row{c.getStationFavButtons(station.Serial)}, btns...)
 	btns = append(btns, tele.Row{
 		{
@@ -672,23 +1257,42 @@ func (c *customContext) handleStationInner(serial gira.StationSerial) error {
 			Data:   string(serial) + "|delete_msg",
 		},
 		{
-			Text:   fmt.Sprintf("🆓 %d docks", freeDocks),
+			Text:   freeDocksButtonText(availability),
 			Unique: btnKeyTypeIgnore,
 		},
 		{
 			Text:   "❎ Close",
 			Unique: btnKeyTypeCloseMenu,
 		},
+	}, tele.Row{
+		{
+			Text:   "⚠️ Report station issue",
+			Unique: btnKeyTypeReportStation,
+			Data:   string(serial),
+		},
+		{
+			Text:   "📤 Share",
+			Unique: btnKeyTypeShareStation,
+			Data:   string(serial),
+		},
 	})
+	if trendRow := c.getStationTrendRow(serial); trendRow != nil {
+		btns = append(btns, trendRow)
+	}
+	btns = append(btns, c.getDirectionsRow(station))
 	rm.Inline(btns...)
 
 	// send station location as main message with buttons of bikes
+	title := station.MapTitle()
+	if favBikes := c.favoriteBikesIn(docks); len(favBikes) > 0 {
+		title = "💖 " + title
+	}
 	return c.Send(&tele.Venue{
 		Location: tele.Location{
 			Lat: float32(station.Latitude),
 			Lng: float32(station.Longitude),
 		},
-		Title: station.MapTitle(),
+		Title: title,
 	}, rm)
 }
 
@@ -710,27 +1314,19 @@ func (c *customContext) sendBikeMessage(bikeCallback string) error {
 	// save for re-sending bike after trip interval limit
 	c.user.LastSelectedBikeCb = bikeCallback
 
-	btnsRow := []tele.InlineButton{
-		{
-			Text:   "🔓 Unlock",
-			Unique: btnKeyTypeBikeUnlock,
-			Data:   bike.CallbackData(),
-		},
-		{
-			Text:   "❌ Cancel",
-			Unique: btnKeyTypeCloseMenu,
-		},
+	text := bike.TextString(*ebikeRange) + "\n\nTapping 'Unlock' will start the trip."
+	if c.isBikeAvoided(bike.Serial) {
+		text = "🚫 You marked this bike to avoid.\n" + text
 	}
 
-	return c.Send(bike.TextString()+"\n\nTapping 'Unlock' will start the trip.", &tele.ReplyMarkup{
-		InlineKeyboard: [][]tele.InlineButton{btnsRow},
-	})
+	return c.Send(text, c.getBikeMarkup(bike))
 }
 
-func (c *customContext) handleUnlockBike() error {
-	cb := c.Callback()
-	if cb == nil {
-		return c.Send("No callback")
+// handleFindBike shows where the bike is docked, with unlock menu. It needs bike index, see gira.Indexer,
+// as otherwise docks of all stations have to be fetched.
+func (c *customContext) handleFindBike(name string) error {
+	if c.s.indexer == nil {
+		return c.Send("Bike search is not enabled, send station number instead.")
 	}
 
 	err, cleanup := c.sendTyping()
@@ -739,25 +1335,92 @@ func (c *customContext) handleUnlockBike() error {
 	}
 	defer cleanup()
 
+	loc, err := c.gira.FindBike(c, name)
+	if errors.Is(err, gira.ErrBikeNotFound) {
+		return c.Send("Bike is not docked at any station, someone might be riding it.")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.Send(fmt.Sprintf("🚲 %s is at %s", loc.Bike.Name, loc.Station.MapTitle())); err != nil {
+		return err
+	}
+	return c.sendBikeMessage(loc.Bike.CallbackData())
+}
+
+// unlockCallTimeout limits each of unlock requests. They are not retried, as a retry of a request
+// which actually succeeded might reserve a bike or start a trip twice, user can retry instead.
+const unlockCallTimeout = 20 * time.Second
+
+// unlockCallOptions are call options of unlock requests, see unlockCallTimeout.
+var unlockCallOptions = []gira.CallOption{gira.WithTimeout(unlockCallTimeout), gira.WithNoRetry()}
+
+func (c *customContext) handleUnlockBike() error {
+	return c.unlockBike(false)
+}
+
+func (c *customContext) handleUnlockBikeForce() error {
+	return c.unlockBike(true)
+}
+
+// unlockBike reserves the bike from callback and starts the trip.
+// If the bike is in user's avoid list, confirmation is asked first, unless force is set.
+func (c *customContext) unlockBike(force bool) error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
 	bike, err := gira.BikeFromCallbackData(cb.Data)
 	if err != nil {
 		return err
 	}
 
-	bikeDesc := bike.TextString() + "\n\n"
+	bikeDesc := bike.TextString(*ebikeRange) + "\n\n"
+
+	if c.user.hasTripOnOtherAccount() {
+		// only one trip is watched at a time
+		return c.Respond(&tele.CallbackResponse{
+			Text:      "You have an active trip on another account, finish it or switch to that account first.",
+			ShowAlert: true,
+		})
+	}
+
+	if !force && c.isBikeAvoided(bike.Serial) {
+		rm := &tele.ReplyMarkup{}
+		rm.Inline(tele.Row{
+			{
+				Text:   "⚠️ Unlock anyway",
+				Unique: btnKeyTypeBikeUnlockForce,
+				Data:   bike.CallbackData(),
+			},
+			{
+				Text:   "❌ Cancel",
+				Unique: btnKeyTypeCloseMenu,
+			},
+		})
+		return c.Edit(bikeDesc+"🚫 This bike is in your avoid list. Are you sure you want to unlock it?", rm)
+	}
+
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	if err := c.Edit(bikeDesc + "Unlocking bike..."); err != nil {
 		return err
 	}
 
-	ok, err := c.gira.ReserveBike(c, bike.Serial)
+	ok, err := c.gira.ReserveBike(c, bike.Serial, unlockCallOptions...)
 
 	if errors.Is(err, gira.ErrBikeAlreadyReserved) {
 		log.Printf("[uid:%d] bike already reserved, trying to cancel: %+v", c.user.ID, bike)
 		// at least try to cancel the reservation, ignore errors
 		if cancelled, _ := c.gira.CancelBikeReserve(c); cancelled {
 			// then, retry to reserve again
-			ok, err = c.gira.ReserveBike(c, bike.Serial)
+			ok, err = c.gira.ReserveBike(c, bike.Serial, unlockCallOptions...)
 		}
 	}
 
@@ -770,29 +1433,82 @@ func (c *customContext) handleUnlockBike() error {
 		return c.Edit("Bike can't be reserved, try again?")
 	}
 
-	ok, err = c.gira.StartTrip(c)
-	if err != nil {
-		return err
+	ok, err = c.gira.StartTrip(c, unlockCallOptions...)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.Printf("[uid:%d] bike start trip failed: %+v", c.user.ID, bike)
+		return c.Edit("Bike can't be unlocked, try again?")
+	}
+
+	c.user.setTripAccount(c.user.tokenID())
+	go func() {
+		if err := c.watchActiveTrip(true); err != nil {
+			c.Bot().OnError(fmt.Errorf("watching active trip: %v", err), c)
+		}
+	}()
+
+	c.user.CurrentTripMessageID = strconv.Itoa(c.Message().ID)
+
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(tele.Row{{
+		Unique: btnKeyTypeCancelReserve,
+		Text:   "❌ Cancel reservation",
+	}})
+	return c.Edit(
+		bikeDesc+
+			"Unlocked bike, waiting for trip to start.\n"+
+			"It might take some time to physically unlock the bike.",
+		rm,
+	)
+}
+
+// handleCancelReserve cancels pending bike reservation. It's called both from the button
+// on unlock message and via /cancel, for cases when Gira gets stuck with reserved bike.
+func (c *customContext) handleCancelReserve() error {
+	if c.user.CurrentTripMessageID != "" {
+		// reservation is pending on the account bike was unlocked with
+		c.useTripAccount()
+	}
+
+	cancelled, err := c.gira.CancelBikeReserve(c)
+	if err != nil {
+		return err
+	}
+
+	if !cancelled {
+		msg := "Nothing to cancel, there's no pending reservation. If the trip has already started, return the bike to a dock."
+		if c.Callback() != nil {
+			return c.Respond(&tele.CallbackResponse{Text: msg, ShowAlert: true})
+		}
+		return c.Send(msg)
+	}
+
+	log.Printf("[uid:%d] bike reservation cancelled", c.user.ID)
+
+	// reservation was pending, so trip won't start, stop waiting for it
+	c.s.mu.Lock()
+	if cancel, ok := c.s.activeTripsCancels[c.user.ID]; ok {
+		cancel()
+		delete(c.s.activeTripsCancels, c.user.ID)
 	}
+	c.s.mu.Unlock()
 
-	if !ok {
-		log.Printf("[uid:%d] bike start trip failed: %+v", c.user.ID, bike)
-		return c.Edit("Bike can't be unlocked, try again?")
+	if c.Callback() != nil {
+		c.user.CurrentTripMessageID = ""
+		return c.Edit("Reservation cancelled.", &tele.ReplyMarkup{})
 	}
 
-	go func() {
-		if err := c.watchActiveTrip(true); err != nil {
-			c.Bot().OnError(fmt.Errorf("watching active trip: %v", err), c)
+	if c.user.CurrentTripMessageID != "" {
+		// drop the cancel button of the unlock message, it's the one callback path edits
+		if _, err := c.Bot().Edit(c.getActiveTripMsg(), "Reservation cancelled.", &tele.ReplyMarkup{}); err != nil {
+			log.Printf("[uid:%d] ignored edit unlock message error: %v", c.user.ID, err)
 		}
-	}()
-
-	c.user.CurrentTripMessageID = strconv.Itoa(c.Message().ID)
-	return c.Edit(
-		bikeDesc+
-			"Unlocked bike, waiting for trip to start.\n"+
-			"It might take some time to physically unlock the bike.",
-		&tele.ReplyMarkup{},
-	)
+		c.user.CurrentTripMessageID = ""
+	}
+	return c.Send("Reservation cancelled.")
 }
 
 func (c *customContext) deleteCallbackMessageWithReply() error {
@@ -830,17 +1546,24 @@ func (c *customContext) watchActiveTrip(isNewTrip bool) error {
 	c.s.activeTripsCancels[c.user.ID] = cancel
 	c.s.mu.Unlock()
 
-	ch, err := gira.SubscribeActiveTrips(ctx, c.getTokenSource())
+	// user might switch accounts during the trip, keep watching the one trip is on
+	c.useTripAccount()
+	ch, err := gira.SubscribeActiveTrips(ctx, c.s.getTokenSource(c.user.tripTokenID()), c.gira)
 	if err != nil {
 		return err
 	}
+	// keep Firebase token fresh, so that trip requests don't wait for the token server
+	go c.s.prefetchFbToken(ctx, c.user.tripTokenID())
 
 	// TODO: check for case with two bikes and fast return
-	// TODO: cancel watch if trip did not start after some time
 
 	if isNewTrip {
 		// first channel pass -- wait for new trip
-		if err := c.waitForTripStart(ch); err != nil {
+		err := c.waitForTripStart(ch)
+		if errors.Is(err, errTripNotStarted) {
+			return nil
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -854,6 +1577,15 @@ func (c *customContext) watchActiveTrip(isNewTrip bool) error {
 			continue
 		}
 
+		if trip.Finished {
+			// count the trip before sending the summary, as badges depend on it
+			// incremented in place, it's not overwritten by handlers, see userBackgroundFields
+			if err := c.s.db.Model(c.user).UpdateColumn("finished_trips", gorm.Expr("finished_trips + 1")).Error; err != nil {
+				return err
+			}
+			c.user.FinishedTrips++
+		}
+
 		if err := c.updateActiveTripMessage(trip); err != nil {
 			return err
 		}
@@ -862,11 +1594,6 @@ func (c *customContext) watchActiveTrip(isNewTrip bool) error {
 			log.Printf("[uid:%d] active trip finished: %+v", c.user.ID, trip)
 			cancel()
 
-			c.user.FinishedTrips++
-			if err := c.s.db.Model(c.user).Update("FinishedTrips", c.user.FinishedTrips).Error; err != nil {
-				return err
-			}
-
 			return c.handleSendRateMsg()
 		}
 	}
@@ -874,11 +1601,108 @@ func (c *customContext) watchActiveTrip(isNewTrip bool) error {
 	return nil
 }
 
+// handleTrip re-sends active trip message, e.g. if it was deleted, and re-attaches the watcher.
+func (c *customContext) handleTrip() error {
+	tokenID := c.user.tripLookupTokenID()
+	if tokenID != c.user.tokenID() {
+		c.gira = c.s.newGiraClient(tokenID)
+	}
+
+	trip, err := c.gira.GetActiveTrip(c)
+	if errors.Is(err, gira.ErrNoActiveTrip) {
+		return c.Send("You don't have an active trip right now 🚶")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.attachActiveTrip(trip, tokenID)
+}
+
+// activeTripBikeName returns bike name for the active trip message. Active trip query doesn't return
+// the name, only bike code, which is shown until the first trip update with the name arrives.
+func activeTripBikeName(trip gira.Trip) string {
+	if trip.BikeName != "" {
+		return trip.BikeName
+	}
+	return string(trip.BikeCode)
+}
+
+// attachActiveTrip sends a new active trip message for the trip and starts watching it.
+// It's used both to re-send the message and to pick up trips the bot doesn't know about.
+// tokenID is the account the trip was fetched with, which can differ from the active one.
+func (c *customContext) attachActiveTrip(trip gira.Trip, tokenID int64) error {
+	if c.user.CurrentTripMessageID != "" {
+		if err := c.Bot().Delete(c.getActiveTripMsg()); err != nil {
+			log.Printf("[uid:%d] ignored delete old trip message error: %v", c.user.ID, err)
+		}
+	}
+
+	m, err := c.Bot().Send(c.Recipient(), "Loading active trip...")
+	if err != nil {
+		return err
+	}
+
+	c.user.setTripAccount(tokenID)
+	c.user.CurrentTripCode = trip.Code
+	c.user.CurrentTripMessageID = strconv.Itoa(m.ID)
+	// watcher runs outside of handler, so save the state now
+	if err := c.s.db.Model(c.user).Updates(map[string]any{
+		"TripAccount":          c.user.TripAccount,
+		"CurrentTripCode":      c.user.CurrentTripCode,
+		"CurrentTripMessageID": c.user.CurrentTripMessageID,
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := c.updateActiveTripMessage(gira.TripUpdate{
+		Code:      trip.Code,
+		Bike:      activeTripBikeName(trip),
+		StartDate: trip.StartDate,
+		Cost:      trip.Cost,
+	}); err != nil {
+		return err
+	}
+
+	if err := c.Bot().Pin(c.getActiveTripMsg(), tele.Silent); err != nil {
+		log.Printf("[uid:%d] ignored pin trip message error: %v", c.user.ID, err)
+	}
+
+	// watchActiveTrip cancels the previous watcher, if there's any
+	go func() {
+		if err := c.watchActiveTrip(false); err != nil {
+			c.Bot().OnError(fmt.Errorf("watching active trip: %v", err), c)
+		}
+	}()
+	return nil
+}
+
+// tripStartTimeout is how long to wait for the trip to start after unlock.
+const tripStartTimeout = 2 * time.Minute
+
+// errTripNotStarted is returned by waitForTripStart if the trip didn't start in time.
+var errTripNotStarted = errors.New("trip did not start")
+
 // waitForTripStart reads TripUpdates from the channel until it finds the one
 // that is not finished or canceled. It then updates the user's current trip code
 // and sends the initial message.
+// If no trip appears within tripStartTimeout, user is informed and errTripNotStarted is returned.
 func (c *customContext) waitForTripStart(ch <-chan gira.TripUpdate) error {
-	for trip := range ch {
+	timeout := time.NewTimer(tripStartTimeout)
+	defer timeout.Stop()
+
+	for {
+		var trip gira.TripUpdate
+		select {
+		case <-timeout.C:
+			return c.handleTripStartTimeout()
+		case upd, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			trip = upd
+		}
+
 		log.Printf("[uid:%d] got some current trip: %+v", c.user.ID, trip)
 
 		if trip.Finished || trip.Canceled {
@@ -894,9 +1718,50 @@ func (c *customContext) waitForTripStart(ch <-chan gira.TripUpdate) error {
 		}
 
 		// found trip, update initial message
-		return c.updateActiveTripMessage(trip)
+		if err := c.updateActiveTripMessage(trip); err != nil {
+			return err
+		}
+
+		// keep trip status visible at the top of the chat while riding
+		if err := c.Bot().Pin(c.getActiveTripMsg(), tele.Silent); err != nil {
+			log.Printf("[uid:%d] ignored pin trip message error: %v", c.user.ID, err)
+		}
+		return nil
 	}
-	return nil
+}
+
+// handleTripStartTimeout is called when bike was unlocked, but trip never started.
+// It releases the reservation if there's any, and tells user what to do.
+func (c *customContext) handleTripStartTimeout() error {
+	log.Printf("[uid:%d] trip did not start in %v", c.user.ID, tripStartTimeout)
+
+	// handler context is likely expired by now
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := c.gira.CancelBikeReserve(ctx); err != nil {
+		log.Printf("[uid:%d] ignored cancel reserve error: %v", c.user.ID, err)
+	}
+
+	if _, err := c.Bot().Edit(
+		c.getActiveTripMsg(),
+		fmt.Sprintf(
+			"⏱ The trip didn't start within %.0f minutes after unlock, so I stopped waiting for it.\n"+
+				"If the bike didn't unlock, try again with another bike. "+
+				"If you are riding it anyway, run /trip, or call Gira support at +351 211 163 125.",
+			tripStartTimeout.Minutes(),
+		),
+		&tele.ReplyMarkup{},
+	); err != nil {
+		log.Printf("[uid:%d] ignored edit unlock message error: %v", c.user.ID, err)
+	}
+
+	c.user.CurrentTripMessageID = ""
+	if err := c.s.db.Model(c.user).Update("CurrentTripMessageID", "").Error; err != nil {
+		return err
+	}
+
+	return errTripNotStarted
 }
 
 func (c *customContext) updateActiveTripMessage(trip gira.TripUpdate) error {
@@ -910,7 +1775,15 @@ func (c *customContext) updateActiveTripMessage(trip gira.TripUpdate) error {
 
 	var costStr string
 	if trip.Cost != 0 {
-		costStr = fmt.Sprintf("🤑 Cost:  %.0f€\n", trip.Cost)
+		costStr = fmt.Sprintf("🤑 Cost:  %s\n", trip.Cost)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Gira reports cost only after it's charged, estimate it locally
+		if t := c.getCurrentTripTariff(ctx); t != nil {
+			costStr = fmt.Sprintf("💶 Estimated cost if you dock now: %s\n", t.cost(time.Since(trip.StartDate)))
+		}
 	}
 
 	_, err := c.Bot().Edit(
@@ -938,28 +1811,59 @@ func (c *customContext) updateEndedTripMessage(trip gira.TripUpdate) error {
 	var btns tele.Row
 	var costStr string
 
+	var stationsStr, ecoStr, badgesStr string
+	var stationBtns tele.Row
+
+	// optional trip details have own timeout, so that slow lookups don't affect payment info below
+	enrichCtx, enrichCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer enrichCancel()
+
+	// trip update doesn't have stations and distance, fetch full trip
+	tripDetails, err := c.gira.GetTrip(enrichCtx, trip.Code)
+	if err != nil {
+		log.Printf("[uid:%d] ignored get trip error: %v", c.user.ID, err)
+	} else {
+		stationsStr, stationBtns = c.getTripStationsInfo(enrichCtx, tripDetails)
+		stationsStr += c.getFreeDocksNearInfo(enrichCtx, tripDetails.EndLocation)
+
+		ecoStr, err = c.recordTripEcoStats(tripDetails, trip.Bike)
+		if err != nil {
+			log.Printf("[uid:%d] ignored eco stats error: %v", c.user.ID, err)
+		}
+
+		badgesStr, err = c.awardBadges(tripDetails)
+		if err != nil {
+			log.Printf("[uid:%d] ignored badges error: %v", c.user.ID, err)
+		}
+	}
+
+	streakStr, err := c.recordRideDay()
+	if err != nil {
+		log.Printf("[uid:%d] ignored ride day error: %v", c.user.ID, err)
+	}
+
 	if trip.Cost > 0 {
 		log.Printf("last trip was not free: %+v", trip)
 
-		costStr = fmt.Sprintf("\n🤑 Cost: %.0f€\n", trip.Cost)
-
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		status, err := c.gira.GetClientInfo(ctx)
+		costStr = fmt.Sprintf("\n🤑 Cost: %s\n", trip.Cost)
+
+		balance, err := c.gira.GetBalance(ctx)
 		if err != nil {
-			log.Printf("[uid:%d] ignored client info error: %v", c.user.ID, err)
+			log.Printf("[uid:%d] ignored balance error: %v", c.user.ID, err)
 		}
 
 		if trip.CanUsePoints {
 			btns = append(btns, tele.Btn{
 				Unique: btnKeyTypePayPoints,
 				Text:   "💰 Pay with points",
-				Data:   string(trip.Code),
+				Data:   payButtonData(trip),
 			})
 
 			if err == nil {
-				costStr += fmt.Sprintf("💰 Points balance: %d€\n", status.Bonus/500)
+				costStr += fmt.Sprintf("💰 Points balance: %d€\n", balance.Bonus/pointsPerEuro)
 			}
 		}
 
@@ -967,11 +1871,11 @@ func (c *customContext) updateEndedTripMessage(trip gira.TripUpdate) error {
 			btns = append(btns, tele.Btn{
 				Unique: btnKeyTypePayMoney,
 				Text:   "💶 Pay with money",
-				Data:   string(trip.Code),
+				Data:   payButtonData(trip),
 			})
 
 			if err == nil {
-				costStr += fmt.Sprintf("💶 Account balance: %.0f€\n", status.Balance)
+				costStr += fmt.Sprintf("💶 Account balance: %s\n", balance.Balance)
 			}
 		}
 
@@ -983,8 +1887,20 @@ func (c *customContext) updateEndedTripMessage(trip gira.TripUpdate) error {
 		}
 	}
 
+	reportBtns := tele.Row{{
+		Unique: btnKeyTypeReportTrip,
+		Text:   "🛠 Report bike problem",
+		Data:   string(trip.Code) + "|" + trip.Bike,
+	}}
+
+	var rows []tele.Row
+	for _, row := range []tele.Row{btns, stationBtns, reportBtns} {
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
 	rm := &tele.ReplyMarkup{}
-	rm.Inline(btns)
+	rm.Inline(rows...)
 
 	if _, err := c.Bot().Send(
 		tele.ChatID(c.user.ID),
@@ -992,13 +1908,21 @@ func (c *customContext) updateEndedTripMessage(trip gira.TripUpdate) error {
 			"Trip ended, thanks for using BetterGiraBot!\n"+
 				"🚲 Bike: %s\n"+
 				"🕑 Duration: %s\n"+
+				"%s"+
+				"%s"+
 				"💰 Points earned: +%d, total %d (%d€)\n"+
+				"%s"+
+				"%s"+
 				"%s",
 			trip.Bike,
 			trip.PrettyDuration(),
+			stationsStr,
+			ecoStr,
 			trip.TripPoints,
 			trip.ClientPoints,
-			trip.ClientPoints/500,
+			trip.ClientPoints/pointsPerEuro,
+			streakStr,
+			badgesStr,
 			costStr,
 		),
 		rm,
@@ -1006,62 +1930,206 @@ func (c *customContext) updateEndedTripMessage(trip gira.TripUpdate) error {
 		return err
 	}
 
+	if msgID, err := strconv.Atoi(c.user.CurrentTripMessageID); err == nil {
+		// deleting the message unpins it as well, but it might fail, so unpin explicitly first
+		if err := c.Bot().Unpin(tele.ChatID(c.user.ID), msgID); err != nil {
+			log.Printf("[uid:%d] ignored unpin trip message error: %v", c.user.ID, err)
+		}
+	}
+
 	if err := c.Bot().Delete(c.getActiveTripMsg()); err != nil {
 		return err
 	}
 	c.user.CurrentTripMessageID = ""
+	// this is called from watcher, save it so that background jobs know the trip has ended
+	if err := c.s.db.Model(c.user).Update("CurrentTripMessageID", "").Error; err != nil {
+		return err
+	}
+
+	c.user.CurrentTripTariff = ""
+	if err := c.s.db.Model(c.user).Update("CurrentTripTariff", "").Error; err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (c *customContext) handlePayPoints() error {
-	if c.Callback() == nil {
-		return c.Send("No callback")
+// getTripStationsInfo returns a summary line with trip start/end stations and buttons to open them.
+// Errors are only logged, as this info is not essential for trip summary.
+func (c *customContext) getTripStationsInfo(ctx context.Context, trip gira.Trip) (string, tele.Row) {
+	start, err := c.gira.GetStationByCodeCached(ctx, trip.StartLocation)
+	if err != nil {
+		log.Printf("[uid:%d] ignored start station error: %v", c.user.ID, err)
+		return "", nil
+	}
+	end, err := c.gira.GetStationByCodeCached(ctx, trip.EndLocation)
+	if err != nil {
+		log.Printf("[uid:%d] ignored end station error: %v", c.user.ID, err)
+		return "", nil
 	}
 
-	tc := gira.TripCode(c.Callback().Data)
-	if tc == "" {
-		return c.Send("No trip code")
+	str := fmt.Sprintf("📍 Route: %s → %s\n", start.Number(), end.Number())
+	btns := tele.Row{
+		{
+			Unique: btnKeyTypeStation,
+			Text:   "🅿️ From " + start.Number(),
+			Data:   string(start.Serial),
+		},
+		{
+			Unique: btnKeyTypeStation,
+			Text:   "🅿️ To " + end.Number(),
+			Data:   string(end.Serial),
+		},
 	}
+	return str, btns
+}
 
-	paid, err := c.gira.PayTripWithPoints(c, tc)
+// freeDocksNearMaxResults is how many alternative stations are shown in trip summary.
+const freeDocksNearMaxResults = 3
+
+// getFreeDocksNearInfo returns a summary line with nearest stations with free docks around trip end station.
+// Errors are only logged, as this info is not essential for trip summary.
+func (c *customContext) getFreeDocksNearInfo(ctx context.Context, code gira.StationCode) string {
+	end, err := c.gira.GetStationByCodeCached(ctx, code)
 	if err != nil {
-		return err
+		log.Printf("[uid:%d] ignored end station error: %v", c.user.ID, err)
+		return ""
 	}
 
-	log.Printf("paid for %s with points: %d", tc, paid)
+	ss, err := c.gira.GetStations(ctx)
+	if err != nil {
+		log.Printf("[uid:%d] ignored get stations error: %v", c.user.ID, err)
+		return ""
+	}
 
-	// remove pay buttons from trip message
-	if err := c.Edit(&tele.ReplyMarkup{}); err != nil {
-		return err
+	ss = slices.DeleteFunc(ss, func(i gira.Station) bool {
+		return i.Status != gira.AssetStatusActive || i.Serial == end.Serial || i.FreeDocksEstimate() == 0
+	})
+
+	loc := &tele.Location{Lat: float32(end.Latitude), Lng: float32(end.Longitude)}
+	slices.SortFunc(ss, func(i, j gira.Station) int {
+		return cmp.Compare(distance(i, loc), distance(j, loc))
+	})
+
+	var alts []string
+	for _, s := range ss[:min(freeDocksNearMaxResults, len(ss))] {
+		alts = append(alts, fmt.Sprintf("%s (%.0fm, %d 🆓)", s.Number(), distance(s, loc), s.FreeDocksEstimate()))
 	}
+	if len(alts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🅿️ Free docks near %s: %s\n", end.Number(), strings.Join(alts, ", "))
+}
 
-	return c.Reply(fmt.Sprintf("Paid with points: -%v", paid))
+func (c *customContext) handlePayPoints() error {
+	return c.payTrip("points", c.gira.PayTripWithPoints)
 }
 
 func (c *customContext) handlePayMoney() error {
+	return c.payTrip("money", c.gira.PayTripWithMoney)
+}
+
+func (c *customContext) payTrip(method string, pay func(context.Context, gira.TripCode) (int, error)) error {
 	if c.Callback() == nil {
 		return c.Send("No callback")
 	}
 
-	tc := gira.TripCode(c.Callback().Data)
+	code, bike, _ := strings.Cut(c.Callback().Data, "|")
+	tc := gira.TripCode(code)
 	if tc == "" {
 		return c.Send("No trip code")
 	}
 
-	paid, err := c.gira.PayTripWithMoney(c, tc)
+	// pay buttons are on the last trip message, which is on trip's account
+	c.useTripAccount()
+
+	paid, err := pay(c, tc)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("paid for %s with money: %d", tc, paid)
+	log.Printf("paid for %s with %s: %d", tc, method, paid)
 
 	// remove pay buttons from trip message
 	if err := c.Edit(&tele.ReplyMarkup{}); err != nil {
 		return err
 	}
 
-	return c.Reply(fmt.Sprintf("Paid with money: -%v", paid))
+	return c.Reply(c.getTripReceipt(tc, bike, fmt.Sprintf("Paid with %s: -%v", method, paid)))
+}
+
+// payButtonData returns callback data of pay buttons. Bike name is passed along, as trip query doesn't have it.
+// Buttons sent before the name was added have only the trip code.
+func payButtonData(trip gira.TripUpdate) string {
+	return string(trip.Code) + "|" + trip.Bike
+}
+
+// getReceiptStationName returns station number for the receipt, falling back to its code.
+func (c *customContext) getReceiptStationName(ctx context.Context, code gira.StationCode) string {
+	st, err := c.gira.GetStationByCodeCached(ctx, code)
+	if err != nil {
+		log.Printf("[uid:%d] ignored receipt station error: %v", c.user.ID, err)
+		return string(code)
+	}
+	return st.Number()
+}
+
+// getTripReceipt returns receipt for a paid trip. Trip is re-fetched to verify the payment went through,
+// any errors are only logged, as the payment is already done at this point.
+func (c *customContext) getTripReceipt(tc gira.TripCode, bike, paidStr string) string {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	sb := strings.Builder{}
+	sb.WriteString("🧾 Trip receipt\n")
+
+	trip, tripErr := c.gira.GetTrip(ctx, tc)
+	if tripErr != nil {
+		log.Printf("[uid:%d] ignored receipt get trip error: %v", c.user.ID, tripErr)
+		sb.WriteString("⚠️ Couldn't fetch trip details, check payment in the official app.\n")
+	} else {
+		if bike == "" {
+			bike = activeTripBikeName(trip)
+		}
+		sb.WriteString(fmt.Sprintf(
+			"🚲 Bike: %s\n"+
+				"📍 %s → %s\n"+
+				"🕑 Duration: %s\n"+
+				"💶 Cost: %s\n",
+			bike,
+			c.getReceiptStationName(ctx, trip.StartLocation),
+			c.getReceiptStationName(ctx, trip.EndLocation),
+			trip.PrettyDuration(),
+			trip.Cost,
+		))
+		if trip.CostBonus > 0 {
+			sb.WriteString(fmt.Sprintf("💰 Points used: %d (%d€)\n", trip.CostBonus, trip.CostBonus/pointsPerEuro))
+		}
+	}
+
+	switch {
+	case tripErr != nil:
+		sb.WriteString("❔ " + paidStr + ", not verified\n")
+	case trip.Cost > 0:
+		// payable trips have remaining cost, same as in active trip resync
+		sb.WriteString(fmt.Sprintf("⚠️ %s, but trip still shows %s to pay, check it in the official app\n", paidStr, trip.Cost))
+	default:
+		sb.WriteString("✅ " + paidStr + "\n")
+	}
+
+	balance, err := c.gira.GetBalance(ctx)
+	if err != nil {
+		log.Printf("[uid:%d] ignored receipt balance error: %v", c.user.ID, err)
+	} else {
+		sb.WriteString(fmt.Sprintf(
+			"\nRemaining balance: %s, points: %d (%d€)",
+			balance.Balance,
+			balance.Bonus,
+			balance.Bonus/pointsPerEuro,
+		))
+	}
+
+	return sb.String()
 }
 
 func (c *customContext) handleSendRateMsg() error {
@@ -1073,6 +2141,7 @@ func (c *customContext) handleSendRateMsg() error {
 	}
 
 	c.user.CurrentTripRating = gira.TripRating{}
+	c.user.CurrentTripRatingPhoto = ""
 	c.user.CurrentTripRateAwaiting = true
 
 	m, err := c.Bot().Send(
@@ -1085,12 +2154,16 @@ func (c *customContext) handleSendRateMsg() error {
 	}
 
 	c.user.RateMessageID = strconv.Itoa(m.ID)
+	c.user.RateRequestedAt = time.Now()
+	c.user.RateReminderSent = false
 
 	// this function might not called with a saved hook (from watchActiveTrip), so we need to save the user manually
 	return c.s.db.Model(c.user).
 		Update("CurrentTripRating", "{}").
 		Update("CurrentTripRateAwaiting", true).
 		Update("RateMessageID", strconv.Itoa(m.ID)).
+		Update("RateRequestedAt", c.user.RateRequestedAt).
+		Update("RateReminderSent", false).
 		Error
 }
 
@@ -1115,22 +2188,27 @@ func (c *customContext) handleRateStar() error {
 	return c.Respond()
 }
 
-func getStarButtons(rating int) *tele.ReplyMarkup {
-	rm := &tele.ReplyMarkup{}
-	var btns []tele.Btn
+// getStarsRow returns a row of 5 star buttons, with dataPrefix prepended to the rating in button data.
+func getStarsRow(unique, dataPrefix string, rating int) tele.Row {
+	var btns tele.Row
 	for i := 0; i < 5; i++ {
 		text := "☆"
 		if i < rating {
 			text = "⭐️"
 		}
 		btns = append(btns, tele.Btn{
-			Unique: btnKeyTypeRateStar,
+			Unique: unique,
 			Text:   text,
-			Data:   strconv.Itoa(i + 1),
+			Data:   dataPrefix + strconv.Itoa(i+1),
 		})
 	}
+	return btns
+}
+
+func getStarButtons(rating int) *tele.ReplyMarkup {
+	rm := &tele.ReplyMarkup{}
 	rm.Inline(
-		btns,
+		getStarsRow(btnKeyTypeRateStar, "", rating),
 		tele.Row{
 			{
 				Unique: btnKeyTypeRateAddText,
@@ -1153,11 +2231,68 @@ func (c *customContext) handleRateAddText() error {
 		Text:   "❌ Cancel",
 	}})
 	return c.Edit(
-		"Please send your comment regarding the trip",
+		"Please send your comment regarding the trip, or a photo, e.g. of bike damage",
 		rm,
 	)
 }
 
+// restoreRateMessage sends text and puts star buttons back on rating message after comment or photo was added.
+func (c *customContext) restoreRateMessage(text string) error {
+	if err := c.Send(text); err != nil {
+		return err
+	}
+
+	_, err := c.Bot().Edit(
+		c.getRateMsg(),
+		messageRateTrip,
+		getStarButtons(c.user.CurrentTripRating.Rating),
+	)
+	return err
+}
+
+// ratePhotoMaxSize is the maximum size of photo attached to trip rating.
+const ratePhotoMaxSize = 5 << 20
+
+// handleRatePhoto attaches photo to the trip rating, photo caption becomes the comment.
+func (c *customContext) handleRatePhoto() error {
+	photo := c.Message().Photo
+	if photo.FileSize > ratePhotoMaxSize {
+		return c.Reply(fmt.Sprintf("Photo is too large, %d MB max, try again", ratePhotoMaxSize>>20))
+	}
+
+	c.user.CurrentTripRatingPhoto = photo.FileID
+	if caption := strings.TrimSpace(c.Message().Caption); caption != "" {
+		c.user.CurrentTripRating.Comment = caption
+	}
+	c.user.State = UserStateLoggedIn
+
+	return c.restoreRateMessage("📷 Photo attached! Don't forget to submit the rating.")
+}
+
+// ratingAttachment downloads photo attached to rating, if any.
+func (c *customContext) ratingAttachment() (*gira.Attachment, error) {
+	if c.user.CurrentTripRatingPhoto == "" {
+		return nil, nil
+	}
+
+	rc, err := c.Bot().File(&tele.File{FileID: c.user.CurrentTripRatingPhoto})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, ratePhotoMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > ratePhotoMaxSize {
+		return nil, fmt.Errorf("rating photo is larger than %d bytes", ratePhotoMaxSize)
+	}
+
+	// Telegram re-encodes photos to JPEG
+	return &gira.Attachment{FileName: "photo.jpg", MimeType: "image/jpeg", Data: data}, nil
+}
+
 func (c *customContext) handleCancelAddComment() error {
 	c.user.State = UserStateLoggedIn
 
@@ -1181,7 +2316,14 @@ func (c *customContext) handleRateSubmit() error {
 	}
 	defer cleanup()
 
-	ok, err := c.gira.RateTrip(c, c.user.CurrentTripCode, c.user.CurrentTripRating)
+	rating := c.user.CurrentTripRating
+	rating.Attachment, err = c.ratingAttachment()
+	if err != nil {
+		return err
+	}
+
+	c.useTripAccount()
+	ok, err := c.gira.RateTrip(c, c.user.CurrentTripCode, rating)
 	if err != nil {
 		return err
 	}
@@ -1194,10 +2336,14 @@ func (c *customContext) handleRateSubmit() error {
 	if c.user.CurrentTripRating.Comment != "" {
 		comment = fmt.Sprintf("\nComment: %s", c.user.CurrentTripRating.Comment)
 	}
+	if c.user.CurrentTripRatingPhoto != "" {
+		comment += "\n📷 Photo attached"
+	}
 
 	c.user.RateMessageID = ""
 	c.user.CurrentTripCode = ""
 	c.user.CurrentTripRating = gira.TripRating{}
+	c.user.CurrentTripRatingPhoto = ""
 	c.user.CurrentTripRateAwaiting = false
 
 	// send separate message to clear annoying typing status
@@ -1210,7 +2356,7 @@ func (c *customContext) handleRateSubmit() error {
 	}
 
 	if !c.user.SentDonateMessage {
-		if err := c.Send(messageDonate, tele.ModeMarkdown, tele.NoPreview); err != nil {
+		if err := c.sendDonateMessage(); err != nil {
 			return err
 		}
 		c.user.SentDonateMessage = true
@@ -1294,7 +2440,11 @@ func (c *customContext) getStationFavButtons(serial gira.StationSerial) tele.Row
 }
 
 func (c *customContext) handleRenameFavorite() error {
-	if err := c.Send("Please send new name for this station (1-2 emojis tops)"); err != nil {
+	if err := c.Send(fmt.Sprintf(
+		"Please send new name for this station, up to %d characters. "+
+			"Short names or emojis look best in station lists.",
+		favNameMaxLen,
+	)); err != nil {
 		return err
 	}
 	c.user.EditingStationFav = gira.StationSerial(c.Callback().Data)
@@ -1358,8 +2508,6 @@ func (c *customContext) handleDebugRetry() error {
 	return c.runDebug(c.Message().ReplyTo.Text)
 }
 
-var debugStatsFirebaseToken = ""
-
 func (c *customContext) runDebug(text string) error {
 	defer func() {
 		if err := recover(); err != nil {
@@ -1403,30 +2551,17 @@ func (c *customContext) runDebug(text string) error {
 			if err != nil {
 				return nil, err
 			}
-			return tokenserver.Get(c, tok)
+			return c.s.tokenServer.Get(c, tok)
 		},
 		"fbTokenEnc": func() (any, error) {
 			tok, err := getAccessToken()
 			if err != nil {
 				return nil, err
 			}
-			return tokenserver.GetEncrypted(c, tok)
+			return c.s.tokenServer.GetEncrypted(c, tok)
 		},
 		"fbStats": func() (any, error) {
-			// nah, race conditions shouldn't happen here
-			if debugStatsFirebaseToken == "" {
-				tok, err := getAccessToken()
-				if err != nil {
-					return nil, err
-				}
-				fbt, err := tokenserver.Get(c, tok)
-				if err != nil {
-					return nil, err
-				}
-				debugStatsFirebaseToken = fbt
-			}
-
-			return tokenserver.GetStats(c, debugStatsFirebaseToken)
+			return c.s.getPoolStats(c)
 		},
 		"client": func() (any, error) {
 			return c.gira.GetClientInfo(c)
@@ -1520,6 +2655,16 @@ func (c *customContext) runDebug(text string) error {
 			}
 			return c.gira.PayTripWithMoney(c, gira.TripCode(args[1]))
 		},
+		"graphql": func() (any, error) {
+			args := strings.SplitN(text, " ", 2)
+			if len(args) < 2 {
+				return "missing query", nil
+			}
+
+			var res map[string]any
+			err := c.s.newGiraClient(c.user.tokenID()).Do(c, args[1], nil, &res)
+			return res, err
+		},
 		"wsServerTime": func() (any, error) {
 			if len(args) == 1 {
 				return "missing duration", nil
@@ -1553,7 +2698,7 @@ func (c *customContext) runDebug(text string) error {
 			ctx, cancel := context.WithTimeout(context.Background(), dur)
 			defer cancel()
 
-			ch, err := gira.SubscribeActiveTrips(ctx, c.getTokenSource())
+			ch, err := gira.SubscribeActiveTrips(ctx, c.getTokenSource(), nil)
 			for trip := range ch {
 				_ = c.Send(fmt.Sprintf("Current trip: `%+v`", trip), tele.ModeMarkdown)
 			}
@@ -1567,7 +2712,14 @@ func (c *customContext) runDebug(text string) error {
 			})
 			res := map[string]any{}
 			for _, m := range ms {
-				res[*m.Name] = m.Metric[0].Counter.Value
+				// sum over all labels, e.g. per-operation request counters
+				var sum float64
+				for _, metric := range m.Metric {
+					if metric.Counter != nil {
+						sum += metric.Counter.GetValue()
+					}
+				}
+				res[m.GetName()] = sum
 			}
 			return res, nil
 		},
@@ -1595,6 +2747,17 @@ func (c *customContext) runDebug(text string) error {
 			}
 			return res, nil
 		},
+		"stationReports": func() (any, error) {
+			var reports []StationReport
+			q := c.s.db.Order("id DESC").Limit(20)
+			if len(args) > 1 {
+				q = q.Where("station_serial = ?", args[1])
+			}
+			if err := q.Find(&reports).Error; err != nil {
+				return nil, err
+			}
+			return reports, nil
+		},
 		"broadcast": func() (any, error) {
 			args := strings.SplitN(text, " ", 3)
 			if len(args) < 3 {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/girafake"
+)
+
+func TestOccupancyBar(t *testing.T) {
+	tests := []struct {
+		bikes, docks int
+		want         string
+	}{
+		{0, 0, "▱▱▱▱▱ 0%"},
+		{0, 10, "▱▱▱▱▱ 0%"},
+		{-1, 10, "▱▱▱▱▱ 0%"},
+		{1, 20, "▰▱▱▱▱ 5%"},
+		{5, 10, "▰▰▰▱▱ 50%"},
+		{6, 10, "▰▰▰▱▱ 60%"},
+		{19, 20, "▰▰▰▰▱ 95%"},
+		{10, 10, "▰▰▰▰▰ 100%"},
+		{12, 10, "▰▰▰▰▰ 100%"},
+	}
+
+	for _, tt := range tests {
+		if got := occupancyBar(tt.bikes, tt.docks); got != tt.want {
+			t.Errorf("occupancyBar(%d, %d) = %q, want %q", tt.bikes, tt.docks, got, tt.want)
+		}
+	}
+}
+
+func TestGetTripReceipt(t *testing.T) {
+	ctx := context.Background()
+
+	g := girafake.New()
+	g.ClientInfo = gira.ClientInfo{Bonus: 1200, Balance: 500}
+	g.AddStation(gira.Station{Code: "sc1", Serial: "ss1", Name: "101 - Start", Status: gira.AssetStatusActive}, gira.Docks{
+		{Code: "dc1", Serial: "ds1", Number: 1, Bike: &gira.Bike{Code: "bc1", Serial: "bs1", Name: "E0001", Type: gira.BikeTypeElectric}},
+	})
+	g.AddStation(gira.Station{Code: "sc2", Serial: "ss2", Name: "202 - End", Status: gira.AssetStatusActive}, gira.Docks{
+		{Code: "dc2", Serial: "ds2", Number: 1},
+	})
+
+	if ok, err := g.ReserveBike(ctx, "bs1"); !ok || err != nil {
+		t.Fatalf("ReserveBike() = %v, %v", ok, err)
+	}
+	if ok, err := g.StartTrip(ctx); !ok || err != nil {
+		t.Fatalf("StartTrip() = %v, %v", ok, err)
+	}
+	trip, err := g.FinishTrip("sc2", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.PayTripWithPoints(ctx, trip.Code); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &customContext{ctx: ctx, user: &User{ID: 1}, gira: g}
+	got := c.getTripReceipt(trip.Code, "", "Paid with points: -500")
+	for _, want := range []string{
+		"Bike: E0001",
+		"101 → 202",
+		"Points used: 500 (1€)",
+		"Paid with points: -500",
+		"points: 700 (1€)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("receipt doesn't contain %q:\n%s", want, got)
+		}
+	}
+
+	if !strings.Contains(got, "✅ Paid with points") {
+		t.Errorf("receipt of paid trip isn't confirmed:\n%s", got)
+	}
+
+	got = c.getTripReceipt("unknown", "", "Paid")
+	if !strings.Contains(got, "Couldn't fetch trip details") || strings.Contains(got, "✅") {
+		t.Errorf("receipt of unknown trip:\n%s", got)
+	}
+
+	// payment call succeeded, but trip still has cost
+	g.Trips = append(g.Trips, gira.Trip{Code: "unpaid", Cost: gira.MoneyFromEuros(1)})
+	got = c.getTripReceipt("unpaid", "E0002", "Paid with money: -1")
+	if !strings.Contains(got, "⚠️ Paid with money: -1, but trip still shows") || strings.Contains(got, "✅") {
+		t.Errorf("receipt of unpaid trip:\n%s", got)
+	}
+}
+
+func TestDetectActiveTripKeepsAwaitedRating(t *testing.T) {
+	g := girafake.New()
+	g.ActiveTrip = &gira.Trip{Code: "new"}
+
+	c := &customContext{
+		ctx:  context.Background(),
+		user: &User{ID: 1, CurrentTripCode: "old", CurrentTripRateAwaiting: true},
+		gira: g,
+	}
+	if err := c.detectActiveTrip(); err != nil {
+		t.Fatal(err)
+	}
+	if c.user.CurrentTripCode != "old" || !c.user.CurrentTripRateAwaiting {
+		t.Errorf("trip = %s, rate awaiting = %v, want rating of old trip kept", c.user.CurrentTripCode, c.user.CurrentTripRateAwaiting)
+	}
+}
+
+func TestTripAccountOnOtherAccount(t *testing.T) {
+	const accountA, accountB = 10, 20
+
+	// trip was started on B, then user switched to A
+	u := &User{ID: 1, ActiveAccount: accountA, TripAccount: accountB, CurrentTripMessageID: "5"}
+
+	// re-attaching the trip, e.g. with /trip, looks it up on B and keeps it there
+	tokenID := u.tripLookupTokenID()
+	if tokenID != accountB {
+		t.Fatalf("tripLookupTokenID() = %d, want %d", tokenID, accountB)
+	}
+	u.setTripAccount(tokenID)
+	if got := u.tripTokenID(); got != accountB {
+		t.Errorf("after re-attach tripTokenID() = %d, want %d", got, accountB)
+	}
+	if !u.hasTripOnOtherAccount() {
+		t.Error("after re-attach hasTripOnOtherAccount() = false, want true")
+	}
+
+	// without a watched trip, the active account is used
+	u.CurrentTripMessageID = ""
+	if got := u.tripLookupTokenID(); got != accountA {
+		t.Errorf("without trip tripLookupTokenID() = %d, want %d", got, accountA)
+	}
+
+	// primary account is stored as 0
+	u.setTripAccount(u.ID)
+	if u.TripAccount != 0 || u.tripTokenID() != u.ID {
+		t.Errorf("primary account: TripAccount = %d, tripTokenID() = %d", u.TripAccount, u.tripTokenID())
+	}
+}
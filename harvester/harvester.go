@@ -0,0 +1,178 @@
+// Package harvester submits harvested Firebase integrity tokens to the token exchange server
+// (see token-server), for those who run token sources like emulator farms.
+package harvester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned if the server already has the token, e.g. if it's submitted twice.
+	ErrDuplicate = errors.New("harvester: token already submitted")
+	// ErrBadToken is returned if the server rejected the token as invalid or expired.
+	ErrBadToken = errors.New("harvester: token rejected")
+)
+
+const (
+	// MaxSourceLen is the maximum length of source label accepted by the server.
+	MaxSourceLen = 32
+
+	defaultAttempts   = 4
+	defaultRetryDelay = time.Second
+	defaultTimeout    = 10 * time.Second
+	retryMultiplier   = 2
+	retryJitter       = 0.2
+)
+
+// Client posts tokens to the exchange server. It's safe for concurrent use.
+type Client struct {
+	endpoint string
+	source   string
+
+	httpc      *http.Client
+	userAgent  string
+	timeout    time.Duration
+	attempts   int
+	retryDelay time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient makes client use httpc for requests instead of http.DefaultClient.
+func WithHTTPClient(httpc *http.Client) Option {
+	return func(c *Client) {
+		c.httpc = httpc
+	}
+}
+
+// WithUserAgent sets User-Agent of requests.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithRetries makes client try to post a token up to attempts times, waiting for exponentially
+// growing delay starting at baseDelay between tries. 1 disables retries.
+func WithRetries(attempts int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+		c.retryDelay = baseDelay
+	}
+}
+
+// WithTimeout limits each attempt to d, 0 disables the limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// NewClient returns client of exchange server at endpoint base URL. Posted tokens are labeled
+// with source, so that the server's operator can tell which token sources work.
+func NewClient(endpoint, source string, opts ...Option) (*Client, error) {
+	if len(source) > MaxSourceLen {
+		return nil, fmt.Errorf("harvester: source %q is longer than %d", source, MaxSourceLen)
+	}
+
+	c := &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		source:     source,
+		httpc:      http.DefaultClient,
+		userAgent:  "girabot-harvester",
+		timeout:    defaultTimeout,
+		attempts:   defaultAttempts,
+		retryDelay: defaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Post submits token to the server. Network errors and 5xx responses are retried, as long as ctx
+// allows. Errors match ErrDuplicate or ErrBadToken if the server didn't accept the token.
+func (c *Client) Post(ctx context.Context, token string) error {
+	for retries := 0; ; retries++ {
+		err := c.post(ctx, token)
+		if err == nil || !isTransient(err) || retries+1 >= c.attempts {
+			return err
+		}
+
+		d := c.retryDelay * time.Duration(math.Pow(retryMultiplier, float64(retries)))
+		d = time.Duration(float64(d) * (1 + retryJitter*(2*rand.Float64()-1)))
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// statusError is an unexpected response of the server.
+type statusError struct {
+	status string
+	code   int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("harvester: http %s: %s", e.status, e.body)
+}
+
+// isTransient returns whether post failed with network error or 5xx response, which are worth retrying.
+func isTransient(err error) bool {
+	if errors.Is(err, ErrDuplicate) || errors.Is(err, ErrBadToken) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code/100 == 5 || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func (c *Client) post(ctx context.Context, token string) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/post", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("X-Firebase-Token", token)
+	req.Header.Set("X-Token-Source", c.source)
+
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return fmt.Errorf("harvester: posting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("harvester: reading body: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrDuplicate
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", ErrBadToken, strings.TrimSpace(string(body)))
+	}
+	return &statusError{status: resp.Status, code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,78 @@
+package harvester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPost(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/post" || r.Method != http.MethodPost {
+			t.Errorf("request = %s %s, want POST /post", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("X-Token-Source"); got != "farm1" {
+			t.Errorf("source = %q, want farm1", got)
+		}
+
+		switch tok := r.Header.Get("X-Firebase-Token"); tok {
+		case "ok":
+			fmt.Fprint(w, "thanks!")
+		case "dup":
+			http.Error(w, "token already exists", http.StatusConflict)
+		case "bad":
+			http.Error(w, "bad token", http.StatusBadRequest)
+		case "flaky":
+			if hits < 3 {
+				http.Error(w, "failed to save token", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "thanks!")
+		default:
+			http.Error(w, "failed to save token", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := NewClient(srv.URL, strings.Repeat("x", MaxSourceLen+1)); err == nil {
+		t.Error("NewClient with long source succeeded, want error")
+	}
+
+	c, err := NewClient(srv.URL+"/", "farm1", WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		token    string
+		wantErr  error
+		wantHits int
+	}{
+		{"ok", nil, 1},
+		{"dup", ErrDuplicate, 1},
+		{"bad", ErrBadToken, 1},
+		{"flaky", nil, 3},
+		{"broken", nil, 3},
+	} {
+		hits = 0
+		err := c.Post(ctx, tt.token)
+		if tt.token == "broken" {
+			if err == nil {
+				t.Errorf("post %s succeeded, want error", tt.token)
+			}
+		} else if !errors.Is(err, tt.wantErr) {
+			t.Errorf("post %s error = %v, want %v", tt.token, err, tt.wantErr)
+		}
+		if hits != tt.wantHits {
+			t.Errorf("post %s hits = %d, want %d", tt.token, hits, tt.wantHits)
+		}
+	}
+}
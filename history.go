@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// StationSample is a snapshot of station availability, used to show availability trends.
+type StationSample struct {
+	ID            uint               `gorm:"primarykey"`
+	StationSerial gira.StationSerial `gorm:"index:idx_station_sampled"`
+	SampledAt     time.Time          `gorm:"index:idx_station_sampled"`
+
+	Bikes int
+	Docks int
+}
+
+const (
+	stationSampleInterval  = 15 * time.Minute
+	stationSampleRetention = 28 * 24 * time.Hour
+	// stationTrendWindow is how far ahead of current time-of-day samples are considered for the trend.
+	stationTrendWindow = time.Hour
+	// stationTrendMinSamples is the minimum number of samples to show a trend.
+	stationTrendMinSamples = 4
+)
+
+// stationSampler periodically samples availability of stations that are favorites of any user.
+// Gira API is called with the token of one of these users, see getStationsForSampling.
+func (s *server) stationSampler() {
+	for {
+		if err := s.sampleStations(); err != nil {
+			log.Println("station sampler error:", err)
+		}
+		time.Sleep(stationSampleInterval)
+	}
+}
+
+func (s *server) sampleStations() error {
+	var users []User
+	if err := s.db.Select("id", "active_account", "favorites").Find(&users).Error; err != nil {
+		return err
+	}
+
+	serials := map[gira.StationSerial]struct{}{}
+	var owners []User
+	for _, u := range users {
+		if len(u.Favorites) > 0 {
+			owners = append(owners, u)
+		}
+		for serial := range u.Favorites {
+			serials[serial] = struct{}{}
+		}
+	}
+	if len(serials) == 0 {
+		return nil
+	}
+
+	stations, err := s.getStationsForSampling(owners)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var samples []StationSample
+	for _, st := range stations {
+		if _, ok := serials[st.Serial]; !ok || st.Status != gira.AssetStatusActive {
+			continue
+		}
+		samples = append(samples, StationSample{
+			StationSerial: st.Serial,
+			SampledAt:     now,
+			Bikes:         st.Bikes,
+			Docks:         st.Docks,
+		})
+	}
+
+	if len(samples) > 0 {
+		if err := s.db.Create(&samples).Error; err != nil {
+			return err
+		}
+	}
+
+	return s.db.Where("sampled_at < ?", now.Add(-stationSampleRetention)).Delete(&StationSample{}).Error
+}
+
+// stationSamplerMaxAttempts is how many users' tokens are tried for sampling, if some of them are not valid anymore.
+const stationSamplerMaxAttempts = 5
+
+// getStationsForSampling gets stations with the token of one of users who have favorites,
+// so that sampling doesn't depend on any single account, e.g. admin's one, being logged in.
+func (s *server) getStationsForSampling(users []User) ([]gira.Station, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rand.Shuffle(len(users), func(i, j int) {
+		users[i], users[j] = users[j], users[i]
+	})
+
+	var errs []error
+	for _, u := range users[:min(len(users), stationSamplerMaxAttempts)] {
+		stations, err := s.newGiraClient(u.tokenID()).GetStations(ctx)
+		if err == nil {
+			return stations, nil
+		}
+		log.Printf("[uid:%d] station sampler: error getting stations: %v", u.ID, err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no token worked for sampling: %w", errors.Join(errs...))
+}
+
+// getStationTrend returns a short description of usual station availability for the next hour,
+// based on collected samples. Empty string is returned if there's not enough data.
+func (c *customContext) getStationTrend(serial gira.StationSerial) (string, error) {
+	var samples []StationSample
+	if err := c.s.db.
+		Where("station_serial = ? AND sampled_at > ?", serial, time.Now().Add(-stationSampleRetention)).
+		Find(&samples).Error; err != nil {
+		return "", err
+	}
+
+	now := time.Now().In(lisbonTZ)
+	nowMinute := now.Hour()*60 + now.Minute()
+	windowMinutes := int(stationTrendWindow.Minutes())
+	weekend := isWeekend(now)
+
+	var sum, n int
+	for _, sample := range samples {
+		t := sample.SampledAt.In(lisbonTZ)
+		if isWeekend(t) != weekend {
+			continue
+		}
+		// minutes since current time of day, wrapping around midnight
+		delta := (t.Hour()*60 + t.Minute() - nowMinute + 24*60) % (24 * 60)
+		if delta > windowMinutes {
+			continue
+		}
+		sum += sample.Bikes
+		n++
+	}
+
+	if n < stationTrendMinSamples {
+		return "", nil
+	}
+
+	avg := float64(sum) / float64(n)
+	at := now.Add(stationTrendWindow / 2).Format("15:04")
+	if avg < 1 {
+		return fmt.Sprintf("📊 Usually empty around %s", at), nil
+	}
+	return fmt.Sprintf("📊 Usually ~%.0f bikes around %s", math.Round(avg), at), nil
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// getStationTrendRow returns a button row with station trend, or nil if it's not available.
+func (c *customContext) getStationTrendRow(serial gira.StationSerial) tele.Row {
+	trend, err := c.getStationTrend(serial)
+	if err != nil {
+		log.Printf("[uid:%d] ignored station trend error: %v", c.user.ID, err)
+		return nil
+	}
+	if trend == "" {
+		return nil
+	}
+	return tele.Row{{
+		Text:   trend,
+		Unique: btnKeyTypeIgnore,
+	}}
+}
@@ -1,10 +0,0 @@
-package firebasetoken
-
-// func Get(ctx context.Context, authToken string) (string, error) {
-// 	raw, err := FetchRaw(ctx, authToken)
-// 	if err != nil {
-// 		return "", err
-// 	}
-
-// 	return Encrypt(raw, authToken)
-// }
@@ -3,24 +3,211 @@ package tokencrypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilyaluk/girabot/gira/giraauth"
 )
 
+// Version is the format of encrypted token. Formats after V1 are prefixed with "v<N>:", which can't
+// appear in V1 base64, so that Decrypt accepts tokens of any version, and new schemes can be added
+// without breaking consumers of the old ones.
+type Version int
+
+const (
+	// V1 is the original format: AES-CBC with key and IV taken from the sub and jti claims of the auth token,
+	// without a prefix. Gira API expects it, so it's what Encrypt returns.
+	V1 Version = 1
+	// V2 is AES-256-CBC with key derived from both claims with HMAC-SHA256, and random IV prepended
+	// to the ciphertext. It's as malleable as V1, use V3 where possible.
+	V2 Version = 2
+	// V3 is AES-256-GCM with key derived like in V2, and random nonce prepended to the ciphertext.
+	// Unlike CBC, it's not malleable, so it's the default for consumers which support it.
+	V3 Version = 3
+
+	DefaultVersion = V3
+)
+
+const (
+	// v2KeyLabel and v3KeyLabel separate keys of each version from anything else derived from the same claims.
+	v2KeyLabel = "girabot tokencrypto v2"
+	v3KeyLabel = "girabot tokencrypto v3"
+)
+
+// Header is the request header with comma-separated versions consumer accepts, e.g. "v3, v1",
+// and the response header with version of the token, see Negotiate.
+const Header = "X-Token-Encryption"
+
+// Negotiate returns the version to encrypt with for consumer which sent header value accepts:
+// DefaultVersion if it's accepted, otherwise the newest accepted one. Consumers which predate
+// versioning don't send the header, they get V1.
+func Negotiate(accepts string) Version {
+	best := Version(0)
+	for _, s := range strings.Split(accepts, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(s), "v"))
+		if err != nil {
+			continue
+		}
+		v := Version(n)
+		if v == DefaultVersion {
+			return v
+		}
+		if v >= V1 && v <= V3 {
+			best = max(best, v)
+		}
+	}
+	if best == 0 {
+		return V1
+	}
+	return best
+}
+
 func Encrypt(integrityToken, authToken string) (string, error) {
-	key, iv, err := getKeyAndIV(authToken)
+	return EncryptVersion(V1, integrityToken, authToken)
+}
+
+// EncryptVersion encrypts integrityToken with authToken in format v.
+func EncryptVersion(v Version, integrityToken, authToken string) (string, error) {
+	claims, err := giraauth.ParseClaims(authToken)
 	if err != nil {
-		return "", fmt.Errorf("failed to get key and IV: %w", err)
+		return "", fmt.Errorf("failed to parse auth token: %w", err)
+	}
+
+	switch v {
+	case V1:
+		key, iv := v1KeyAndIV(claims)
+		ciphertext, err := encryptCBC(key, iv, []byte(integrityToken))
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(ciphertext), nil
+	case V2:
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return "", fmt.Errorf("failed to generate IV: %w", err)
+		}
+		ciphertext, err := encryptCBC(deriveKey(claims, v2KeyLabel), iv, []byte(integrityToken))
+		if err != nil {
+			return "", err
+		}
+		return v.prefix() + base64.StdEncoding.EncodeToString(append(iv, ciphertext...)), nil
+	case V3:
+		aead, err := newGCM(deriveKey(claims, v3KeyLabel))
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		// prefix is authenticated too, so that token can't be passed off as another version
+		ciphertext := aead.Seal(nonce, nonce, []byte(integrityToken), []byte(v.prefix()))
+		return v.prefix() + base64.StdEncoding.EncodeToString(ciphertext), nil
 	}
+	return "", fmt.Errorf("unsupported version %d", v)
+}
 
-	plaintext := []byte(integrityToken)
+// Decrypt decrypts token encrypted with authToken in any format.
+func Decrypt(integrityTokenEncd, authToken string) (string, error) {
+	v, payload, err := parseVersion(integrityTokenEncd)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := giraauth.ParseClaims(authToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse auth token: %w", err)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	var plaintext []byte
+	switch v {
+	case V1:
+		key, iv := v1KeyAndIV(claims)
+		plaintext, err = decryptCBC(key, iv, ciphertext)
+	case V2:
+		if len(ciphertext) < aes.BlockSize {
+			return "", fmt.Errorf("invalid ciphertext length")
+		}
+		plaintext, err = decryptCBC(deriveKey(claims, v2KeyLabel), ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:])
+	case V3:
+		var aead cipher.AEAD
+		if aead, err = newGCM(deriveKey(claims, v3KeyLabel)); err != nil {
+			return "", err
+		}
+		if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+			return "", fmt.Errorf("invalid ciphertext length")
+		}
+		nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		if plaintext, err = aead.Open(nil, nonce, sealed, []byte(v.prefix())); err != nil {
+			return "", fmt.Errorf("failed to decrypt: %w", err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (v Version) prefix() string {
+	return "v" + strconv.Itoa(int(v)) + ":"
+}
 
+// parseVersion splits encrypted token into version and base64 payload.
+func parseVersion(s string) (Version, string, error) {
+	prefix, payload, ok := strings.Cut(s, ":")
+	if !ok {
+		return V1, s, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(prefix, "v"))
+	if err != nil || !strings.HasPrefix(prefix, "v") {
+		return 0, "", fmt.Errorf("invalid version prefix %q", prefix)
+	}
+	switch v := Version(n); v {
+	case V1, V2, V3:
+		return v, payload, nil
+	}
+	return 0, "", fmt.Errorf("unsupported version %d", n)
+}
+
+func v1KeyAndIV(claims giraauth.Claims) ([]byte, []byte) {
+	key := strings.ReplaceAll(claims.Subject, "-", "")
+	return []byte(key), []byte(claims.ID[:16])
+}
+
+// deriveKey returns AES-256 key derived from the claims with HMAC-SHA256, separated by label.
+func deriveKey(claims giraauth.Claims, label string) []byte {
+	mac := hmac.New(sha256.New, []byte(claims.ID))
+	mac.Write([]byte(label))
+	mac.Write([]byte(claims.Subject))
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+func encryptCBC(key, iv, plaintext []byte) ([]byte, error) {
 	// PKCS7 padding
-	blockSize := 16
-	padding := blockSize - (len(plaintext) % blockSize)
+	padding := aes.BlockSize - (len(plaintext) % aes.BlockSize)
 	padtext := make([]byte, len(plaintext)+padding)
 	copy(padtext, plaintext)
 	for i := len(plaintext); i < len(padtext); i++ {
@@ -29,34 +216,23 @@ func Encrypt(integrityToken, authToken string) (string, error) {
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	ciphertext := make([]byte, len(padtext))
 	mode := cipher.NewCBCEncrypter(block, iv)
 	mode.CryptBlocks(ciphertext, padtext)
-
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return ciphertext, nil
 }
 
-func decrypt(integrityTokenEncd, authToken string) (string, error) {
-	key, iv, err := getKeyAndIV(authToken)
-	if err != nil {
-		return "", fmt.Errorf("failed to get key and IV: %w", err)
-	}
-
-	ciphertext, err := base64.StdEncoding.DecodeString(integrityTokenEncd)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
-	}
-
+func decryptCBC(key, iv, ciphertext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	if len(ciphertext) < aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
-		return "", fmt.Errorf("invalid ciphertext length")
+		return nil, fmt.Errorf("invalid ciphertext length")
 	}
 
 	plaintext := make([]byte, len(ciphertext))
@@ -65,44 +241,15 @@ func decrypt(integrityTokenEncd, authToken string) (string, error) {
 
 	// PKCS7 padding
 	paddingLen := int(plaintext[len(plaintext)-1])
-	if paddingLen > 16 || paddingLen < 1 {
-		return "", fmt.Errorf("invalid padding")
+	if paddingLen > aes.BlockSize || paddingLen < 1 {
+		return nil, fmt.Errorf("invalid padding")
 	}
 
 	for i := len(plaintext) - paddingLen; i < len(plaintext); i++ {
 		if plaintext[i] != byte(paddingLen) {
-			return "", fmt.Errorf("invalid padding")
+			return nil, fmt.Errorf("invalid padding")
 		}
 	}
 
-	return string(plaintext[:len(plaintext)-paddingLen]), nil
-}
-
-func getKeyAndIV(authToken string) ([]byte, []byte, error) {
-	tok, _, err := jwt.NewParser().ParseUnverified(authToken, jwt.MapClaims{})
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse auth token: %w", err)
-	}
-
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, nil, fmt.Errorf("failed to parse auth token claims")
-	}
-
-	sub, ok := claims["sub"].(string)
-	if !ok || len(sub) < 36 {
-		return nil, nil, fmt.Errorf("invalid auth token: sub claim is too short")
-	}
-
-	key := strings.ReplaceAll(sub, "-", "")
-	if len(key) != 32 {
-		return nil, nil, fmt.Errorf("invalid auth token: sub claim is invalid")
-	}
-
-	jti, ok := claims["jti"].(string)
-	if !ok || len(jti) < 16 {
-		return nil, nil, fmt.Errorf("invalid auth token: jti claim is too short")
-	}
-
-	return []byte(key), []byte(jti[:16]), nil
+	return plaintext[:len(plaintext)-paddingLen], nil
 }
@@ -1,6 +1,7 @@
 package tokencrypto
 
 import (
+	"encoding/base64"
 	"strings"
 	"testing"
 
@@ -11,6 +12,7 @@ func TestEncrypt(t *testing.T) {
 	token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
 		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
 		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": 1700000000,
 	})
 
 	authToken, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
@@ -36,7 +38,7 @@ func TestEncrypt(t *testing.T) {
 		t.Errorf("encrypted token does not match expected value: got %s, want %s", enc, expected)
 	}
 
-	dec, err := decrypt(enc, authToken)
+	dec, err := Decrypt(enc, authToken)
 	if err != nil {
 		t.Errorf("failed to decrypt: %v", err)
 	}
@@ -45,3 +47,64 @@ func TestEncrypt(t *testing.T) {
 		t.Errorf("decrypted token does not match original value: got %s, want %s", dec, intgr)
 	}
 }
+
+func TestVersions(t *testing.T) {
+	authToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": 1700000000,
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to create test token: %v", err)
+	}
+
+	intgr := strings.Repeat("e", 100)
+	for _, v := range []Version{V1, V2, V3} {
+		enc, err := EncryptVersion(v, intgr, authToken)
+		if err != nil {
+			t.Fatalf("v%d: failed to encrypt: %v", v, err)
+		}
+		if v != V1 && !strings.HasPrefix(enc, v.prefix()) {
+			t.Errorf("v%d: encrypted token %q has no version prefix", v, enc)
+		}
+
+		dec, err := Decrypt(enc, authToken)
+		if err != nil || dec != intgr {
+			t.Errorf("v%d: decrypt = %q, %v, want original token", v, dec, err)
+		}
+	}
+
+	// V1 with explicit prefix is accepted too
+	enc, _ := Encrypt(intgr, authToken)
+	if dec, err := Decrypt(V1.prefix()+enc, authToken); err != nil || dec != intgr {
+		t.Errorf("prefixed v1: decrypt = %q, %v, want original token", dec, err)
+	}
+
+	if _, err := Decrypt("v9:"+enc, authToken); err == nil {
+		t.Error("decrypt of unknown version succeeded, want error")
+	}
+
+	// V3 is authenticated, tampered tokens are rejected
+	enc, _ = EncryptVersion(V3, intgr, authToken)
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(enc, V3.prefix()))
+	raw[len(raw)-1] ^= 1
+	if _, err := Decrypt(V3.prefix()+base64.StdEncoding.EncodeToString(raw), authToken); err == nil {
+		t.Error("decrypt of tampered v3 token succeeded, want error")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for accepts, want := range map[string]Version{
+		"":              V1,
+		"garbage":       V1,
+		"v1":            V1,
+		"v2, v1":        V2,
+		"v1, v3":        V3,
+		"v1,v2,v3,v9":   V3,
+		" v2 , garbage": V2,
+	} {
+		if got := Negotiate(accepts); got != want {
+			t.Errorf("Negotiate(%q) = %d, want %d", accepts, got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tokenserver
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// endpointFailThreshold is how many consecutive failures make endpoint skipped for endpointCooldown.
+	endpointFailThreshold = 3
+	endpointCooldown      = 5 * time.Minute
+)
+
+// endpointPool is a list of exchange servers, the first one is primary. Requests go to healthy endpoints
+// in order, and an endpoint is skipped for cooldown after failThreshold consecutive failures
+// (network errors, 5xx responses or empty token pool). It's safe for concurrent use.
+type endpointPool struct {
+	failThreshold int
+	cooldown      time.Duration
+	log           *slog.Logger
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+}
+
+type endpoint struct {
+	url       string
+	failures  int
+	downUntil time.Time
+}
+
+func newEndpointPool(urls []string, failThreshold int, cooldown time.Duration, log *slog.Logger) *endpointPool {
+	p := &endpointPool{failThreshold: failThreshold, cooldown: cooldown, log: log}
+	for _, u := range urls {
+		p.endpoints = append(p.endpoints, &endpoint{url: strings.TrimSuffix(strings.TrimSpace(u), "/")})
+	}
+	return p
+}
+
+// ordered returns endpoints in order they should be tried: healthy ones in order of preference,
+// then cooling down ones, as they might have recovered already.
+func (p *endpointPool) ordered(now time.Time) []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, down []*endpoint
+	for _, e := range p.endpoints {
+		if now.Before(e.downUntil) {
+			down = append(down, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// report records the outcome of request sent to the endpoint.
+func (p *endpointPool) report(e *endpoint, failed bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		e.failures = 0
+		e.downUntil = time.Time{}
+		return
+	}
+
+	e.failures++
+	if e.failures >= p.failThreshold && len(p.endpoints) > 1 {
+		p.log.Warn("firebasetoken: endpoint failed, skipping it", "endpoint", e.url, "failures", e.failures, "cooldown", p.cooldown)
+		e.failures = 0
+		e.downUntil = now.Add(p.cooldown)
+	}
+}
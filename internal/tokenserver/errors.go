@@ -0,0 +1,125 @@
+package tokenserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira/firebasetoken"
+)
+
+var (
+	// ErrNoTokens is the same as firebasetoken.ErrNoTokens, so that its metrics count empty pool.
+	ErrNoTokens     = firebasetoken.ErrNoTokens
+	ErrBadAuthToken = errors.New("firebasetoken: auth token not accepted")
+	ErrRateLimited  = errors.New("firebasetoken: rate limited")
+)
+
+// ErrorCode is a machine-readable code of exchange server error.
+type ErrorCode string
+
+const (
+	CodeNoTokens     ErrorCode = "no_tokens"
+	CodeBadAuthToken ErrorCode = "bad_auth_token"
+	CodeRateLimited  ErrorCode = "rate_limited"
+	// CodeAuthFailed is returned if Gira auth API failed to verify the auth token.
+	CodeAuthFailed ErrorCode = "auth_failed"
+	CodeInternal   ErrorCode = "internal"
+)
+
+// ErrorResponse is the body of exchange server error responses.
+type ErrorResponse struct {
+	Error struct {
+		Code    ErrorCode `json:"code"`
+		Message string    `json:"message"`
+	} `json:"error"`
+}
+
+// WriteError writes error response with status, code and message, for exchange server.
+func WriteError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	var resp ErrorResponse
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// httpError is a non-OK response of exchange server. It matches ErrNoTokens, ErrBadAuthToken
+// and ErrRateLimited with errors.Is.
+type httpError struct {
+	status     string
+	statusCode int
+	code       ErrorCode
+	// message has the reason, e.g. that Gira didn't accept the auth token
+	message string
+	// retryAfter is the delay requested with Retry-After header, if any
+	retryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	if e.code != "" {
+		return fmt.Sprintf("firebasetoken: http %s: %s (%s)", e.status, e.message, e.code)
+	}
+	return fmt.Sprintf("firebasetoken: http %s: %s", e.status, e.message)
+}
+
+func (e *httpError) Is(target error) bool {
+	switch e.code {
+	case CodeNoTokens:
+		return target == ErrNoTokens
+	case CodeBadAuthToken:
+		return target == ErrBadAuthToken
+	case CodeRateLimited:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+// parseError returns error of non-OK response with body. Servers which predate ErrorResponse
+// respond with plain text, then the code is guessed from status and text.
+func parseError(resp *http.Response, body []byte) *httpError {
+	e := &httpError{
+		status:     resp.Status,
+		statusCode: resp.StatusCode,
+		message:    strings.TrimSpace(string(body)),
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	var er ErrorResponse
+	if json.Unmarshal(body, &er) == nil && er.Error.Code != "" {
+		e.code = er.Error.Code
+		e.message = er.Error.Message
+		return e
+	}
+
+	switch {
+	case strings.Contains(e.message, "no tokens available"):
+		e.code = CodeNoTokens
+	case resp.StatusCode == http.StatusUnauthorized:
+		e.code = CodeBadAuthToken
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.code = CodeRateLimited
+	}
+	return e
+}
+
+// parseRetryAfter parses Retry-After header value, which is either delay in seconds or HTTP date.
+// It returns 0 if header is absent or invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(0, time.Duration(secs)*time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, t.Sub(now))
+	}
+	return 0
+}
@@ -0,0 +1,34 @@
+package tokenserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, http.StatusNotFound, CodeNoTokens, "pool is empty")
+
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"envelope", http.StatusNotFound, rec.Body.String(), ErrNoTokens},
+		{"legacy no tokens", http.StatusNotFound, "no tokens available\n", ErrNoTokens},
+		{"legacy unauthorized", http.StatusUnauthorized, "failed to get token: failed to get user ID: unauthorized", ErrBadAuthToken},
+		{"rate limited", http.StatusTooManyRequests, "", ErrRateLimited},
+		{"other", http.StatusBadGateway, `{"error": {"code": "auth_failed", "message": "oops"}}`, nil},
+	} {
+		resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: http.Header{}}
+		err := parseError(resp, []byte(tt.body))
+		for _, target := range []error{ErrNoTokens, ErrBadAuthToken, ErrRateLimited} {
+			if got := errors.Is(err, target); got != (target == tt.want) {
+				t.Errorf("%s: errors.Is(%v, %v) = %v", tt.name, err, target, got)
+			}
+		}
+	}
+}
@@ -1,19 +1,144 @@
+// Package tokenserver is the client of token exchange servers, see token-server. Its transports are
+// gira/firebasetoken ones, configured with the bot's exchange servers, encryption and persistence.
+// gira/firebasetoken stays a public API of the gira module for consumers with their own token source,
+// so only the wiring lives here.
 package tokenserver
 
 import (
 	"context"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"math/rand"
 	"net/http"
-	"strings"
+	"time"
 
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ilyaluk/girabot/gira/firebasetoken"
+	"github.com/ilyaluk/girabot/gira/giraauth"
 	"github.com/ilyaluk/girabot/internal/tokencrypto"
 )
 
-func GetEncrypted(ctx context.Context, authToken string) (string, error) {
-	tok, err := Get(ctx, authToken)
+const (
+	defaultUserAgent = "girabot (https://t.me/BetterGiraBot)"
+	// defaultTimeout limits each request to exchange server, so that failover happens before caller gives up.
+	defaultTimeout = 10 * time.Second
+	// defaultAttempts and defaultRetryDelay are retries of failed fetches, delay grows retryMultiplier times
+	// with each retry and is jittered by retryJitter fraction.
+	defaultAttempts   = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	retryMultiplier   = 2
+	retryJitter       = 0.2
+)
+
+// Client gets Firebase tokens from token exchange servers. It's safe for concurrent use.
+type Client struct {
+	httpc     *http.Client
+	userAgent string
+	timeout   time.Duration
+	// attempts is the maximum number of passes over endpoints, retryDelay is the delay before the first retry
+	attempts   int
+	retryDelay time.Duration
+	log        *slog.Logger
+	failover   []string
+	endpoints  *endpointPool
+	// fetches dedupes concurrent Get calls of one user, e.g. when docks of several stations are fetched at once
+	fetches singleflight.Group
+	// cache is shared by transports, so that Firebase tokens outlive per-request clients
+	cache *firebasetoken.Cache
+	// staticToken is returned by Get instead of fetching, see WithStaticToken
+	staticToken string
+	// onFetch is notified about tokens fetched by transports, see WithOnFetch
+	onFetch func(source oauth2.TokenSource, token string)
+}
+
+type Option func(*Client)
+
+// WithHTTPClient makes client use httpc for requests instead of http.DefaultClient.
+func WithHTTPClient(httpc *http.Client) Option {
+	return func(c *Client) {
+		c.httpc = httpc
+	}
+}
+
+// WithUserAgent sets User-Agent of requests.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithTimeout limits each request to exchange server to d, 0 disables the limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRetries makes client try all endpoints up to attempts times, waiting for exponentially growing
+// delay starting at baseDelay between tries. 1 disables retries.
+func WithRetries(attempts int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+		c.retryDelay = baseDelay
+	}
+}
+
+// WithLogger makes client log to l instead of slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.log = l
+	}
+}
+
+// WithFailover adds exchange servers used when the primary one is down or has no tokens, see endpointPool.
+func WithFailover(urls ...string) Option {
+	return func(c *Client) {
+		c.failover = append(c.failover, urls...)
+	}
+}
+
+// WithStaticToken makes client return tok for all users instead of asking exchange servers, for development.
+func WithStaticToken(tok string) Option {
+	return func(c *Client) {
+		c.staticToken = tok
+	}
+}
+
+// WithOnFetch makes client call f with each Firebase token fetched by its transports, and the source
+// of the transport, e.g. to persist it for Restore. It's not called with static token.
+func WithOnFetch(f func(source oauth2.TokenSource, token string)) Option {
+	return func(c *Client) {
+		c.onFetch = f
+	}
+}
+
+// NewClient returns client of exchange server at endpoint base URL.
+func NewClient(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		httpc:      http.DefaultClient,
+		userAgent:  defaultUserAgent,
+		timeout:    defaultTimeout,
+		attempts:   defaultAttempts,
+		retryDelay: defaultRetryDelay,
+		log:        slog.Default(),
+		cache:      firebasetoken.NewCache(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.endpoints = newEndpointPool(append([]string{endpoint}, c.failover...), endpointFailThreshold, endpointCooldown, c.log)
+	return c
+}
+
+// GetEncrypted returns Firebase token for authToken, encrypted with it.
+func (c *Client) GetEncrypted(ctx context.Context, authToken string) (string, error) {
+	tok, err := c.Get(ctx, authToken)
 	if err != nil {
 		return "", err
 	}
@@ -21,39 +146,149 @@ func GetEncrypted(ctx context.Context, authToken string) (string, error) {
 	return tokencrypto.Encrypt(tok, authToken)
 }
 
-var tokenEndpoint = flag.String("token-url", "http://localhost:8080", "token exchange server base url")
+// Get returns Firebase token for authToken from the first exchange server which has one, see endpointPool.
+// Errors which are not endpoint's fault, like rejected authToken, are returned right away.
+// Concurrent calls for the same user share one exchange.
+func (c *Client) Get(ctx context.Context, authToken string) (string, error) {
+	if c.staticToken != "" {
+		return c.staticToken, nil
+	}
 
-var ErrTokenFetch = fmt.Errorf("firebasetoken: token fetch error")
+	key := authToken
+	if claims, err := giraauth.ParseClaims(authToken); err == nil {
+		key = claims.Subject
+	}
 
-func Get(ctx context.Context, authToken string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *tokenEndpoint+"/exchange", nil)
+	ch := c.fetches.DoChan(key, func() (any, error) {
+		// shared by callers, so one of them giving up shouldn't fail the others,
+		// but retries are still limited by its deadline
+		fetchCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			fetchCtx, cancel = context.WithDeadline(fetchCtx, deadline)
+			defer cancel()
+		}
+		return c.get(fetchCtx, authToken)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// get tries all endpoints, and retries if they failed with transient errors, as long as ctx allows.
+func (c *Client) get(ctx context.Context, authToken string) (string, error) {
+	for retries := 0; ; retries++ {
+		tok, retryAfter, err := c.getAny(ctx, authToken)
+		if err == nil || retryAfter < 0 || retries+1 >= c.attempts {
+			return tok, err
+		}
+
+		d := c.retryDelay * time.Duration(math.Pow(retryMultiplier, float64(retries)))
+		d = time.Duration(float64(d) * (1 + retryJitter*(2*rand.Float64()-1)))
+		d = max(d, retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return "", err
+		}
+
+		c.log.Debug("firebasetoken: retrying token fetch", "delay", d, "error", err)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return "", err
+		}
+	}
+}
+
+// getAny tries endpoints in order until one returns a token. If all of them failed, retryAfter is the
+// longest delay they requested, or -1 if none of the errors is transient, see isTransient.
+func (c *Client) getAny(ctx context.Context, authToken string) (tok string, retryAfter time.Duration, err error) {
+	retryAfter = -1
+	var errs []error
+	for _, e := range c.endpoints.ordered(time.Now()) {
+		tok, err := c.getFrom(ctx, e.url, authToken)
+		failed := err != nil && ctx.Err() == nil && isEndpointError(err)
+		c.endpoints.report(e, failed, time.Now())
+		if !failed {
+			return tok, -1, err
+		}
+		errs = append(errs, err)
+
+		if isTransient(err) {
+			var httpErr *httpError
+			if errors.As(err, &httpErr) {
+				retryAfter = max(retryAfter, httpErr.retryAfter)
+			} else {
+				retryAfter = max(retryAfter, 0)
+			}
+		}
+	}
+	return "", retryAfter, errors.Join(errs...)
+}
+
+// isEndpointError returns whether err is endpoint's fault, so that other endpoints should be tried:
+// network error, 5xx or 429 response, or empty token pool.
+func isEndpointError(err error) bool {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.statusCode/100 == 5 || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrNoTokens)
+	}
+	return true
+}
+
+// isTransient returns whether endpoint error is worth retrying. Empty token pool isn't,
+// it's refilled by app instances, which doesn't happen in seconds.
+func isTransient(err error) bool {
+	return isEndpointError(err) && !errors.Is(err, ErrNoTokens)
+}
+
+// do sends GET request to api of exchange server at endpoint with headers, and returns the response
+// with its body read.
+func (c *Client) do(ctx context.Context, endpoint, api string, headers map[string]string) (*http.Response, []byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+api, nil)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	req.Header.Set("User-Agent", "girabot (https://t.me/BetterGiraBot)")
-	req.Header.Set("X-Gira-Token", authToken)
-	resp, err := http.DefaultClient.Do(req)
+	req.Header.Set("User-Agent", c.userAgent)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.httpc.Do(req)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("firebasetoken: reading body: %w", err)
+		return nil, nil, fmt.Errorf("firebasetoken: reading body: %w", err)
 	}
-	body := string(bodyBytes)
+	return resp, body, nil
+}
 
-	if strings.Contains(body, "no tokens available") {
-		return "", ErrTokenFetch
+func (c *Client) getFrom(ctx context.Context, endpoint, authToken string) (string, error) {
+	resp, body, err := c.do(ctx, endpoint, "/exchange", map[string]string{"X-Gira-Token": authToken})
+	if err != nil {
+		return "", err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("firebasetoken: http %s", resp.Status)
+		return "", parseError(resp, body)
 	}
 
-	return body, nil
+	return string(body), nil
 }
 
 type Stats struct {
@@ -68,22 +303,16 @@ type Stats struct {
 	AssignedTokens int64 `json:"assigned_tokens"`
 }
 
-func GetStats(ctx context.Context, fbToken string) (*Stats, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *tokenEndpoint+"/stats", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("User-Agent", "girabot (https://t.me/BetterGiraBot)")
-	req.Header.Set("X-Firebase-Token", fbToken)
-	resp, err := http.DefaultClient.Do(req)
+func (c *Client) GetStats(ctx context.Context, fbToken string) (*Stats, error) {
+	// stats are only for debugging, don't bother with failover
+	endpoint := c.endpoints.ordered(time.Now())[0].url
+	resp, body, err := c.do(ctx, endpoint, "/stats", map[string]string{"X-Firebase-Token": fbToken})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	var res Stats
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	if err := json.Unmarshal(body, &res); err != nil {
 		return nil, fmt.Errorf("firebasetoken: reading stats: %w", err)
 	}
 
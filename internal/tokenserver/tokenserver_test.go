@@ -0,0 +1,152 @@
+package tokenserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGetFailover(t *testing.T) {
+	hits := map[string]int{}
+	server := func(name string, status int, body string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	empty := server("empty", http.StatusNotFound, "no tokens available")
+	broken := server("broken", http.StatusBadGateway, "oops")
+	rejecting := server("rejecting", http.StatusUnauthorized, "bad token")
+	ok := server("ok", http.StatusOK, "fbtoken")
+
+	ctx := context.Background()
+
+	c := NewClient(empty.URL, WithFailover(broken.URL, ok.URL))
+	for range 4 {
+		tok, err := c.Get(ctx, "auth")
+		if err != nil || tok != "fbtoken" {
+			t.Fatalf("get = %q, %v, want fbtoken", tok, err)
+		}
+	}
+	// failing endpoints are skipped after endpointFailThreshold failures
+	if hits["empty"] != endpointFailThreshold || hits["broken"] != endpointFailThreshold || hits["ok"] != 4 {
+		t.Errorf("hits = %v, want empty and broken %d, ok 4", hits, endpointFailThreshold)
+	}
+
+	c = NewClient(rejecting.URL, WithFailover(ok.URL))
+	if _, err := c.Get(ctx, "auth"); err == nil {
+		t.Error("get with rejected auth token succeeded, want error")
+	}
+	if hits["ok"] != 4 {
+		t.Errorf("rejected auth token was sent to another endpoint")
+	}
+
+	c = NewClient(empty.URL)
+	if _, err := c.Get(ctx, "auth"); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("get from empty pool error = %v, want ErrNoTokens", err)
+	}
+}
+
+func TestGetSingleflight(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		fmt.Fprint(w, "fbtoken")
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.URL)
+	authToken := func(jti string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+			"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+			"jti": jti,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	var wg sync.WaitGroup
+	for i := range 5 {
+		// different access tokens of the same user
+		tok := authToken(fmt.Sprintf("3ebb9117-7150-4547-8cca-f51fd6e55f4%d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.Get(context.Background(), tok); err != nil || got != "fbtoken" {
+				t.Errorf("Get = %q, %v, want fbtoken", got, err)
+			}
+		}()
+	}
+	// let all calls join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := hits.Load(); n != 1 {
+		t.Errorf("exchange server got %d requests, want 1", n)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "fbtoken")
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.URL, WithRetries(3, time.Millisecond))
+	if got, err := c.Get(context.Background(), "auth"); err != nil || got != "fbtoken" {
+		t.Fatalf("Get = %q, %v, want fbtoken", got, err)
+	}
+
+	// retries don't outlive caller's deadline
+	hits.Store(0)
+	c = NewClient(srv.URL, WithRetries(3, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Get(ctx, "auth"); err == nil {
+		t.Error("Get succeeded, want error after the first attempt")
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("exchange server got %d requests, want 1", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"garbage", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+	} {
+		if got := parseRetryAfter(tt.v, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
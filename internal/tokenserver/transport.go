@@ -0,0 +1,44 @@
+package tokenserver
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/gira/firebasetoken"
+	"github.com/ilyaluk/girabot/internal/tokencrypto"
+)
+
+// Transport returns transport which adds Firebase token for source's access token to requests sent with base,
+// encrypted the way Gira API expects. Tokens are kept in the client's cache, shared by all its transports,
+// unless the token is static, see WithStaticToken.
+func (c *Client) Transport(base http.RoundTripper, source oauth2.TokenSource) *firebasetoken.Transport {
+	t := &firebasetoken.Transport{
+		Base:   base,
+		Source: source,
+		Fetch:  c.Get,
+		Encode: tokencrypto.Encrypt,
+		Logger: c.log,
+	}
+	if c.staticToken != "" {
+		// nothing to cache or persist, Get returns it right away
+		return t
+	}
+
+	t.Cache = c.cache
+	if c.onFetch != nil {
+		t.OnFetch = func(token string) {
+			c.onFetch(source, token)
+		}
+	}
+	return t
+}
+
+// Restore puts Firebase token of accessToken, persisted from WithOnFetch, into the cache of the client's
+// transports, e.g. after restart. It's a no-op with static token.
+func (c *Client) Restore(accessToken, token string) error {
+	if c.staticToken != "" {
+		return nil
+	}
+	return c.cache.Set(accessToken, token)
+}
@@ -0,0 +1,106 @@
+package tokenserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/internal/tokencrypto"
+)
+
+func TestTransport(t *testing.T) {
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": 1700000000,
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	gira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("x-firebase-token")
+	}))
+	t.Cleanup(gira.Close)
+
+	c := NewClient("http://invalid", WithStaticToken("fbtoken"))
+	httpc := &http.Client{Transport: c.Transport(nil, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken}))}
+	resp, err := httpc.Get(gira.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// Gira API expects the token encrypted with the access token
+	if dec, err := tokencrypto.Decrypt(got, accessToken); err != nil || dec != "fbtoken" {
+		t.Errorf("sent token %q decrypts to %q, %v, want fbtoken", got, dec, err)
+	}
+}
+
+func TestTransportOnFetch(t *testing.T) {
+	signed := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	accessToken := signed(jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	fbToken := signed(jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+	exchange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fbToken)
+	}))
+	t.Cleanup(exchange.Close)
+
+	source := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken})
+	type fetched struct {
+		source oauth2.TokenSource
+		token  string
+	}
+	var got []fetched
+	onFetch := WithOnFetch(func(source oauth2.TokenSource, token string) {
+		got = append(got, fetched{source, token})
+	})
+
+	c := NewClient(exchange.URL, onFetch)
+	tr := c.Transport(nil, source)
+	for range 2 {
+		if _, err := tr.Token(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 1 || got[0].source != source || got[0].token != fbToken {
+		t.Errorf("OnFetch calls = %v, want one with the transport's source and fetched token", got)
+	}
+
+	// restored token is used without fetching
+	got = nil
+	c = NewClient("http://invalid", onFetch)
+	if err := c.Restore(accessToken, fbToken); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.Transport(nil, source).Token(context.Background()); err != nil || tok != fbToken {
+		t.Errorf("token after Restore = %q, %v, want restored one", tok, err)
+	}
+
+	// static token is not persisted
+	c = NewClient("http://invalid", WithStaticToken("fbtoken"), onFetch)
+	if _, err := c.Transport(nil, source).Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("OnFetch called %d times, want none", len(got))
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	// liveLocationInterval is how often nearby stations message is refreshed while live location is shared.
+	liveLocationInterval = 30 * time.Second
+	// liveLocationMaxDuration limits updates for indefinite or very long live locations.
+	liveLocationMaxDuration = 8 * time.Hour
+)
+
+// liveLocation is a live location shared by user with a nearby stations message following it.
+type liveLocation struct {
+	// liveMsgID is the ID of user's message with live location, edits of it carry new location.
+	liveMsgID int
+	listMsg   *tele.Message
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	loc     *tele.Location
+	changed bool
+}
+
+func (l *liveLocation) set(loc *tele.Location) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loc = loc
+	l.changed = true
+}
+
+// take returns the latest location if it has changed since last call.
+func (l *liveLocation) take() (*tele.Location, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.changed {
+		return nil, false
+	}
+	l.changed = false
+	return l.loc, true
+}
+
+// startLiveLocation sends nearby stations list and keeps it updated while user moves.
+func (c *customContext) startLiveLocation(loc *tele.Location) error {
+	err, cleanup := c.sendStationLoader()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	text, rm, err := c.getNearbyStationsMessage(loc)
+	if err != nil {
+		return err
+	}
+	listMsg, err := c.Bot().Reply(c.Message(), text, tele.NoPreview, tele.ModeMarkdown, rm)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		min(time.Duration(loc.LivePeriod)*time.Second, liveLocationMaxDuration),
+	)
+	ll := &liveLocation{
+		liveMsgID: c.Message().ID,
+		listMsg:   listMsg,
+		cancel:    cancel,
+		loc:       loc,
+	}
+
+	c.s.mu.Lock()
+	if old, ok := c.s.liveLocations[c.user.ID]; ok {
+		// only the latest live location is followed
+		old.cancel()
+	}
+	c.s.liveLocations[c.user.ID] = ll
+	c.s.mu.Unlock()
+
+	go c.s.runLiveLocation(ctx, c.user.ID, ll)
+	return nil
+}
+
+// runLiveLocation refreshes the list until ctx is done. User is reloaded for each refresh, as settings,
+// filters or active account might change meanwhile.
+func (s *server) runLiveLocation(ctx context.Context, uid int64, ll *liveLocation) {
+	log.Printf("[uid:%d] following live location", uid)
+	defer func() {
+		ll.cancel()
+
+		s.mu.Lock()
+		if s.liveLocations[uid] == ll {
+			delete(s.liveLocations, uid)
+		}
+		s.mu.Unlock()
+
+		log.Printf("[uid:%d] stopped following live location", uid)
+	}()
+
+	ticker := time.NewTicker(liveLocationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		loc, ok := ll.take()
+		if !ok {
+			continue
+		}
+
+		var u User
+		if err := s.db.First(&u, uid).Error; err != nil {
+			// most likely, user deleted their account
+			log.Printf("[uid:%d] live location user load error: %v", uid, err)
+			return
+		}
+
+		// empty context update, message is edited directly via bot
+		c, cancel := s.newCustomContext(s.bot.NewContext(tele.Update{}), &u)
+		text, rm, err := c.getNearbyStationsMessage(loc)
+		cancel()
+		if err != nil {
+			log.Printf("[uid:%d] ignored live location stations error: %v", uid, err)
+			continue
+		}
+
+		_, err = s.bot.Edit(ll.listMsg, text, tele.NoPreview, tele.ModeMarkdown, rm)
+		if errors.Is(err, tele.ErrSameMessageContent) {
+			continue
+		}
+		if err != nil {
+			// most likely, the list was closed by user
+			log.Printf("[uid:%d] live location edit error: %v", uid, err)
+			return
+		}
+	}
+}
+
+// handleEdited handles edited messages, which are used by Telegram to deliver live location updates.
+func (c *customContext) handleEdited() error {
+	msg := c.Message()
+	if msg == nil || msg.Location == nil {
+		return nil
+	}
+
+	c.user.LastLatitude = float64(msg.Location.Lat)
+	c.user.LastLongitude = float64(msg.Location.Lng)
+	c.user.LastLocationAt = time.Now()
+
+	c.s.mu.Lock()
+	ll, ok := c.s.liveLocations[c.user.ID]
+	c.s.mu.Unlock()
+
+	if ok && ll.liveMsgID == msg.ID {
+		ll.set(msg.Location)
+	}
+	return nil
+}
@@ -7,12 +7,14 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net"
 	"net/http"
 	_ "net/http/pprof" // exposed only at localhost
 	"os"
 	"os/signal"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -23,9 +25,10 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	"github.com/ilyaluk/girabot/internal/emeltls"
-	"github.com/ilyaluk/girabot/internal/gira"
-	"github.com/ilyaluk/girabot/internal/giraauth"
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/emeltls"
+	"github.com/ilyaluk/girabot/gira/giraauth"
+	"github.com/ilyaluk/girabot/gira/retryablehttp"
 	"github.com/ilyaluk/girabot/internal/tokenserver"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -42,24 +45,80 @@ type User struct {
 	// State is a state of user
 	State UserState
 
+	// ActiveAccount is the token ID of active Gira account, 0 for the primary one, see accounts.go
+	ActiveAccount int64
+	// AddingAccount is set while user logs in to an additional account
+	AddingAccount bool
+
 	Email          string
 	EmailMessageID int
 
 	Favorites         map[gira.StationSerial]string `gorm:"serializer:json"`
 	EditingStationFav gira.StationSerial
 
+	// TripAccount is the token ID of Gira account of the current trip, 0 for the primary one, see accounts.go
+	TripAccount             int64
 	CurrentTripCode         gira.TripCode
 	CurrentTripMessageID    string
 	RateMessageID           string
 	CurrentTripRating       gira.TripRating `gorm:"serializer:json"`
 	CurrentTripRateAwaiting bool
+	// RateRequestedAt, RateReminderSent and RateRemindedAt are used to remind about pending rating, see ratereminder.go
+	RateRequestedAt  time.Time
+	RateReminderSent bool
+	RateRemindedAt   time.Time
+	// CurrentTripRatingPhoto is Telegram file ID of photo attached to rating, it's uploaded on submit.
+	CurrentTripRatingPhoto string
+	// CurrentTripTariff is a name of tariff used for active trip cost estimation, see getCurrentTripTariff.
+	CurrentTripTariff string
+
+	// AvoidedBikes is a map of bikes user doesn't want to ride to their names.
+	AvoidedBikes map[gira.BikeSerial]string `gorm:"serializer:json"`
+	// FavoriteBikes is a map of bikes user likes to their names, they are highlighted in stations.
+	FavoriteBikes map[gira.BikeSerial]string `gorm:"serializer:json"`
+
+	// bike problem report in progress, see reports.go
+	ReportBikeSerial gira.BikeSerial
+	ReportBikeName   string
+	ReportTripCode   gira.TripCode
+	ReportCategory   string
+
+	// station issue report in progress
+	ReportStationSerial gira.StationSerial
+
+	// CommuteStations are stations in the scheduled commute report, see commute.go
+	CommuteStations []gira.StationSerial `gorm:"serializer:json"`
+
+	// which stations are shown in nearby list
+	NearbyFilter nearbyFilter
+
+	// last location shared by user, used for walking directions
+	LastLatitude   float64
+	LastLongitude  float64
+	LastLocationAt time.Time
 
 	// for sending the bike message again after trip interval limit
 	LastSelectedBikeCb string
 
 	FinishedTrips int
 
+	// aggregated trip stats, see recordTripEcoStats
+	TotalDistance float64
+	TotalCO2Saved float64
+	TotalCalories float64
+
+	// VisitedStations is a map of trip start/end stations to number of visits, see badges.go
+	VisitedStations map[gira.StationCode]int `gorm:"serializer:json"`
+	// Badges is a map of earned badge IDs to the time they were earned
+	Badges map[string]time.Time `gorm:"serializer:json"`
+
 	SentDonateMessage bool
+	// donations via Telegram Stars, see donate.go
+	DonatedStars   int
+	DonationsCount int
+	LastDonationAt time.Time
+
+	Settings UserSettings `gorm:"embedded;embeddedPrefix:setting_"`
 }
 
 func (c *customContext) getActiveTripMsg() tele.Editable {
@@ -84,21 +143,56 @@ func (u filteredUser) String() string {
 	if u.Email != "" {
 		u.Email = "<email>"
 	}
+	// location is zeroed, fields can't hold a placeholder
+	u.LastLatitude = 0
+	u.LastLongitude = 0
+	u.LastLocationAt = time.Time{}
 	u.Favorites = map[gira.StationSerial]string{
 		gira.StationSerial(fmt.Sprint(len(u.Favorites))): "",
 	}
+	u.AvoidedBikes = map[gira.BikeSerial]string{
+		gira.BikeSerial(fmt.Sprint(len(u.AvoidedBikes))): "",
+	}
+	u.FavoriteBikes = map[gira.BikeSerial]string{
+		gira.BikeSerial(fmt.Sprint(len(u.FavoriteBikes))): "",
+	}
+	u.VisitedStations = map[gira.StationCode]int{
+		gira.StationCode(fmt.Sprint(len(u.VisitedStations))): 0,
+	}
 	return fmt.Sprintf("%+v", User(u))
 }
 
+// Token is a Gira token of one account, see accounts.go for details on IDs.
 type Token struct {
-	ID    int64         `gorm:"primarykey"`
-	Token *oauth2.Token `gorm:"serializer:json"`
+	ID     int64         `gorm:"primarykey"`
+	UserID int64         `gorm:"index"`
+	Token  *oauth2.Token `gorm:"serializer:json"`
+	// FbToken is the last Firebase token of the account, so that restart doesn't make all active users
+	// fetch new ones at once, see loadFbTokens.
+	FbToken          string
+	FbTokenExpiresAt time.Time
 }
 
 type server struct {
 	db   *gorm.DB
 	bot  *tele.Bot
 	auth *giraauth.Client
+	// stationCache is shared by Gira clients of all users, as station list is the same for everyone.
+	stationCache *gira.StationCache
+	// docksCache is shared for the same reason, so that users at a popular station share docks requests.
+	docksCache *gira.DocksCache
+	// tokenServer gives Firebase tokens, see fbtokenclient.go.
+	tokenServer *tokenserver.Client
+	// giraEndpoints are Gira API endpoints shared by clients of all users, so that failover is global.
+	giraEndpoints *gira.EndpointPool
+	// indexer keeps locations of docked bikes, it's nil if disabled with -index-interval.
+	indexer *gira.Indexer
+	// giraLimiter limits requests of all clients, backgroundLimiter additionally limits background jobs.
+	// They are nil if disabled.
+	giraLimiter       *gira.RateLimiter
+	backgroundLimiter *gira.RateLimiter
+	// giraLogger is the logger of Gira clients and auth, its level is set with -gira-log-level.
+	giraLogger *slog.Logger
 
 	mu sync.Mutex
 	// tokenSources is a map of user ID to token source.
@@ -107,10 +201,31 @@ type server struct {
 	// activeTripsCancels is a map of user ID to cancel function for active trip watcher.
 	// It's used to cancel active trip watcher if for some reason two watchers are started for one user.
 	activeTripsCancels map[int64]context.CancelFunc
+	// liveLocations is a map of user ID to live location being followed, see livelocation.go.
+	liveLocations map[int64]*liveLocation
 	// lastUpdateID is a last update ID to avoid processing the same update twice.
 	lastUpdateID int
+
+	updateLag updateLag
+	// giraHealth tracks Gira failures to detect outages, see outage.go.
+	giraHealth giraHealth
+	// poolHealth tracks whether Firebase token pool is low, see poolhealth.go.
+	poolHealth poolHealth
 }
 
+var (
+	// backgroundRetryPolicy is for background jobs, which run again soon anyway and shouldn't hammer the backend.
+	backgroundRetryPolicy = retryablehttp.Policy{Attempts: 3, AttemptTimeout: 10 * time.Second, BaseDelay: 2 * time.Second, Multiplier: 2, Jitter: 0.2}
+	// webRetryPolicy keeps webapp requests within reasonable response time.
+	webRetryPolicy = retryablehttp.Policy{Attempts: 4, AttemptTimeout: 3 * time.Second, BaseDelay: 250 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+)
+
+const (
+	// giraEndpointFailThreshold is how many consecutive failures make endpoint skipped for giraEndpointCooldown.
+	giraEndpointFailThreshold = 5
+	giraEndpointCooldown      = 5 * time.Minute
+)
+
 var (
 	adminID    = flag.Int64("admin-id", 111504781, "admin user ID")
 	dbPath     = flag.String("db-path", "girabot.db", "path to sqlite database")
@@ -118,15 +233,61 @@ var (
 	urlPrefix  = flag.String("url-prefix", "/girabot_prod", "url prefix for webapp")
 	listenPort = flag.String("port", "8001", "port to listen on")
 	debugPort  = flag.String("debug-port", "9090", "debug port to listen on (metrics/pprof)")
+	ebikeRange = flag.Float64("ebike-range-km", gira.DefaultEBikeFullRangeKm, "approximate e-bike range with full battery, for range estimates")
+
+	stationCacheTTL = flag.Duration("station-cache-ttl", time.Hour, "how long station list is cached for single station lookups")
+	docksCacheTTL   = flag.Duration("docks-cache-ttl", 10*time.Second, "how long station docks are cached, so that concurrent views share requests")
+	indexInterval   = flag.Duration("index-interval", 0, "how often to crawl docks of all stations for bike index, 0 to disable")
+	giraEndpoints   = flag.String("gira-endpoint", gira.DefaultEndpoint, "Gira GraphQL endpoints, comma-separated, the ones after first are used for failover")
+	giraRate        = flag.Float64("gira-rate", 0, "max average Gira requests per second of all users, 0 to disable")
+	backgroundRate  = flag.Float64("background-rate", 2, "max average Gira requests per second of background jobs like indexer, 0 to disable")
+	giraLogLevel    = flag.String("gira-log-level", "debug", "level of Gira client logs: debug (includes redacted request bodies), info, warn or error")
+	traceFile       = flag.String("trace-file", "", "if set, OpenTelemetry spans of bot updates and Gira calls are appended to this file as JSON")
 )
 
 func main() {
 	flag.Parse()
 
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(*giraLogLevel)); err != nil {
+		log.Fatal(err)
+	}
+	giraLogger := slog.New(slog.NewTextHandler(log.Writer(), &slog.HandlerOptions{Level: logLevel}))
+
+	if *traceFile != "" {
+		shutdown, err := setupTracing(*traceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer shutdown()
+	}
+
 	s := server{
-		auth:               giraauth.New(&http.Client{Transport: emeltls.Transport()}),
 		tokenSources:       map[int64]*tokenSource{},
 		activeTripsCancels: map[int64]context.CancelFunc{},
+		liveLocations:      map[int64]*liveLocation{},
+		stationCache:       gira.NewStationCache(*stationCacheTTL),
+		docksCache:         gira.NewDocksCache(*docksCacheTTL),
+		giraLogger:         giraLogger,
+	}
+
+	endpoints, err := gira.NewEndpointPool(strings.Split(*giraEndpoints, ","), giraEndpointFailThreshold, giraEndpointCooldown)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.giraEndpoints = endpoints
+	s.auth = giraauth.New(
+		&http.Client{Transport: emeltls.Transport()},
+		retryablehttp.WithResultObserver(s.observeGiraResult),
+		retryablehttp.WithLogger(giraLogger),
+	)
+	s.tokenServer = s.newTokenServerClient(giraLogger)
+
+	if *giraRate > 0 {
+		s.giraLimiter = gira.NewRateLimiter("global", *giraRate, max(1, int(*giraRate)))
+	}
+	if *backgroundRate > 0 {
+		s.backgroundLimiter = gira.NewRateLimiter("background", *backgroundRate, 1)
 	}
 
 	// open DB
@@ -134,11 +295,20 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := db.AutoMigrate(&User{}, &Token{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &Token{}, &StationReport{}, &StationSample{}, &Feedback{}, &RideDay{}, &QueuedNotification{}, &CachedStation{}); err != nil {
+		log.Fatal(err)
+	}
+	if err := migrateTokens(db); err != nil {
 		log.Fatal(err)
 	}
 
 	s.db = db
+	if err := s.loadStationCache(); err != nil {
+		log.Fatal(err)
+	}
+	if err := s.loadFbTokens(); err != nil {
+		log.Fatal(err)
+	}
 
 	webhook := &tele.Webhook{
 		SecretToken: getRandomString(32),
@@ -151,7 +321,7 @@ func main() {
 	mux.Handle("/webhook", webhook)
 	mux.HandleFunc("/api/stations", s.handleWebStations)
 	mux.HandleFunc("/api/selectStation", s.handleWebSelectStation)
-	mux.Handle("/", staticServer)
+	mux.Handle("/", newAssetServer(*webappDir))
 
 	handler := http.StripPrefix(*urlPrefix, mux)
 
@@ -205,6 +375,16 @@ func main() {
 	setupHandlers(&s)
 
 	go s.refreshTokensWatcher()
+	go s.stationSampler()
+	go s.streakReminder()
+	go s.rateReminder()
+	go s.quietHoursFlusher()
+	go s.commuteReporter()
+	go s.poolHealthChecker()
+	if *indexInterval > 0 {
+		s.indexer = gira.NewIndexer(*indexInterval, s.getBackgroundClient)
+		go s.indexer.Run(context.Background())
+	}
 	s.loadActiveTrips()
 
 	log.Println("bot start")
@@ -230,7 +410,10 @@ type customContext struct {
 
 	s    *server
 	user *User
-	gira *gira.Client
+	gira gira.API
+
+	// userDeleted is set when user deleted their account, so it's not saved after handler
+	userDeleted bool
 }
 
 func (s *server) checkUpdateID(upd tele.Update) (doProcess bool) {
@@ -282,39 +465,102 @@ func (s *server) addCustomContext(next tele.HandlerFunc) tele.HandlerFunc {
 			}
 		}
 
+		// orig is the user as loaded, so that only changes made by handler are saved
+		var orig User
+		if err := s.db.First(&orig, u.ID).Error; err != nil {
+			return err
+		}
+
+		log.Printf("bot call, action: '%s', user: %+v", getAction(c, u), filteredUser(u))
+
+		ctx, cancel := s.newCustomContext(c, &u)
+		defer cancel()
+		defer ctx.startUpdateSpan()()
+
 		defer func() {
+			if ctx.userDeleted {
+				// don't recreate user that was just deleted
+				return
+			}
 			log.Println("saving user", filteredUser(u))
 			// update user in database with changes from handler
-			if err := s.db.Save(&u).Error; err != nil {
+			if err := s.saveUser(&u, &orig); err != nil {
 				log.Println("error saving user:", err)
 			}
 		}()
 
-		log.Printf("bot call, action: '%s', user: %+v", getAction(c, u), filteredUser(u))
-
-		ctx, cancel := s.newCustomContext(c, &u)
-		defer cancel()
 		return next(ctx)
 	}
 }
 
+// userBackgroundFields are updated outside of handlers, e.g. by trip watcher, with atomic updates.
+// Handler's copy of them is stale, so saveUser doesn't write them.
+var userBackgroundFields = []string{
+	"FinishedTrips", "TotalDistance", "TotalCO2Saved", "TotalCalories", "VisitedStations", "Badges",
+}
+
+// saveUser saves fields of user changed by handler since it was loaded as orig. Other fields might
+// have been changed meanwhile by background jobs, like rate reminder, so they are not written.
+func (s *server) saveUser(u, orig *User) error {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(&User{}); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	uv, origv := reflect.ValueOf(u).Elem(), reflect.ValueOf(orig).Elem()
+	var changed []string
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		v, _ := f.ValueOf(ctx, uv)
+		origV, _ := f.ValueOf(ctx, origv)
+		if !reflect.DeepEqual(v, origV) {
+			changed = append(changed, f.DBName)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return s.db.Model(u).Select(changed).Omit(userBackgroundFields...).Updates(u).Error
+}
+
 func (s *server) newCustomContext(c tele.Context, u *User) (*customContext, context.CancelFunc) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 
-	ts := s.getTokenSource(u.ID)
-	oauthC := &http.Client{Transport: &oauth2.Transport{Source: ts, Base: emeltls.Transport()}}
-	fbC := newFbTokenClient(oauthC.Transport, ts)
-	girac := gira.New(fbC)
-
 	return &customContext{
 		Context: c,
 		ctx:     ctx,
 		s:       s,
 		user:    u,
-		gira:    girac,
+		gira:    s.newGiraClient(u.tokenID()),
 	}, cancel
 }
 
+// newGiraClient returns gira client authenticated with token tokenID.
+// For primary accounts it's the same as user ID.
+func (s *server) newGiraClient(tokenID int64, extra ...gira.Option) *gira.Client {
+	ts := s.getTokenSource(tokenID)
+	oauthC := &http.Client{Transport: &oauth2.Transport{Source: gira.AuthTokenSource(ts), Base: emeltls.Transport()}}
+	fbC := s.newFbTokenClient(oauthC.Transport, ts)
+	opts := []gira.Option{
+		gira.WithEndpoints(s.giraEndpoints),
+		gira.WithStationCache(s.stationCache),
+		gira.WithDocksCache(s.docksCache),
+		gira.WithResultObserver(s.observeGiraResult),
+		gira.WithLogger(s.giraLogger),
+	}
+	if s.indexer != nil {
+		opts = append(opts, gira.WithIndexer(s.indexer))
+	}
+	if s.giraLimiter != nil {
+		opts = append(opts, gira.WithRateLimiter(s.giraLimiter))
+	}
+	return gira.New(fbC, append(opts, extra...)...)
+}
+
 var lisbonTZ *time.Location
 
 func init() {
@@ -371,6 +617,9 @@ func (s *server) onError(err error, c tele.Context) {
 		case errors.Is(err, giraauth.ErrInternalServer):
 			prettyErr = "Gira Auth API returned internal server error. Please try again."
 
+		case giraauth.CodeOf(err) == giraauth.CodeExpiredRefreshToken:
+			prettyErr = "Your Gira login has expired. Please re-login via /login."
+
 		case errors.Is(err, giraauth.ErrInvalidRefreshToken):
 			prettyErr = "Gira Auth API says that your token is invalid. Please re-login via /login."
 
@@ -444,9 +693,7 @@ func (s *server) onError(err error, c tele.Context) {
 				"Try again later, or buy Gira yearly pass. 🤷"
 
 		case errors.Is(err, gira.ErrServiceUnavailable):
-			loc, _ := time.LoadLocation("Europe/Lisbon")
-			hr := time.Now().In(loc).Hour()
-			if hr >= 2 && hr < 6 {
+			if isGiraMaintenance(time.Now()) {
 				prettyErr = "Gira is not available at night (2-6 AM)."
 			} else {
 				prettyErr = "Gira service is unavailable. Try again later."
@@ -459,13 +706,19 @@ func (s *server) onError(err error, c tele.Context) {
 
 			prettyErr = "There are some issues with bypassing the EMEL checks. We're working on it."
 
-		case errors.Is(err, tokenserver.ErrTokenFetch):
+		case errors.Is(err, tokenserver.ErrNoTokens):
 			if _, err := s.bot.Send(tele.ChatID(*adminID), "no tokens in source", tele.ModeMarkdown); err != nil {
 				log.Println("bot: error sending recovered error:", err)
 			}
 
 			prettyErr = "There's currently no tokens to circumvent Gira API limits. Please try again in a couple of minutes."
 
+		case errors.Is(err, tokenserver.ErrRateLimited):
+			prettyErr = "Too many requests to circumvent Gira API limits right now. Please try again in a minute."
+
+		case errors.Is(err, tokenserver.ErrBadAuthToken):
+			prettyErr = "Gira didn't accept your login. Please try again, and re-login via /login if it keeps happening."
+
 		case errors.Is(err, gira.ErrServiceUnavailable):
 			hr := time.Now().In(lisbonTZ).Hour()
 			if hr >= 2 && hr < 6 {
@@ -475,6 +728,15 @@ func (s *server) onError(err error, c tele.Context) {
 			}
 		}
 
+		if isGiraOutageError(err) {
+			// the request itself was already observed, only remember the user
+			s.giraHealth.markAffected(u.ID)
+			if s.giraHealth.isDown() {
+				prettyErr += "\n\n⚠️ Looks like Gira is having issues for everyone, it's not you. " +
+					"I'll let you know when it's back."
+			}
+		}
+
 		if prettyErr != "" {
 			if err := c.Send(prettyErr); err != nil {
 				msg := fmt.Sprintf("error sending pretty error to user %v: `%v`", username, err)
@@ -511,6 +773,9 @@ func getAction(c tele.Context, u User) string {
 	if c.Callback() != nil {
 		return fmt.Sprintf("cb: uniq:%s, data:%s", c.Callback().Unique, c.Callback().Data)
 	}
+	if c.PreCheckoutQuery() != nil {
+		return fmt.Sprintf("<checkout: %s>", c.PreCheckoutQuery().Payload)
+	}
 	if c.Message() == nil {
 		return fmt.Sprintf("<weird upd: %+v>", c.Update())
 	}
@@ -559,11 +824,18 @@ func (s *server) refreshTokensWatcher() {
 					s.bot.OnError(fmt.Errorf("failed token refresh for %d: %v (token was removed)", tok.ID, err), nil)
 					s.db.Delete(&tok)
 
-					s.db.Model(&User{}).Where("id = ?", tok.ID).Update("state", 0)
+					msg := "Your session has expired. Please log in again via /login."
+					if tok.ID != tok.UserID {
+						// additional account expired, fall back to primary one if it was active
+						s.db.Model(&User{}).Where("id = ? AND active_account = ?", tok.UserID, tok.ID).Update("active_account", 0)
+						msg = "Session of one of your additional Gira accounts has expired, it was removed. Add it again via /accounts."
+					} else {
+						s.db.Model(&User{}).Where("id = ?", tok.UserID).Update("state", 0)
+					}
 
-					_, err = s.bot.Send(tele.ChatID(tok.ID), "Your session has expired. Please log in again via /login.")
+					_, err = s.bot.Send(tele.ChatID(tok.UserID), msg)
 					if err != nil {
-						log.Printf("error sending session expired message to %d: %v", tok.ID, err)
+						log.Printf("error sending session expired message to %d: %v", tok.UserID, err)
 					}
 					continue
 				}
@@ -597,33 +869,48 @@ func (s *server) loadActiveTrips() {
 	}
 }
 
-// getTokenSource returns token source for user. It returns cached token source if it exists.
-func (s *server) getTokenSource(uid int64) oauth2.TokenSource {
+// getBackgroundClient returns Gira client with token of a random account for background jobs,
+// so that they don't depend on any single one.
+func (s *server) getBackgroundClient() (gira.API, error) {
+	var tok Token
+	if err := s.db.Order("RANDOM()").First(&tok).Error; err != nil {
+		return nil, err
+	}
+	opts := []gira.Option{gira.WithRetryPolicy(backgroundRetryPolicy)}
+	if s.backgroundLimiter != nil {
+		opts = append(opts, gira.WithRateLimiter(s.backgroundLimiter))
+	}
+	return s.newGiraClient(tok.ID, opts...), nil
+}
+
+// getTokenSource returns token source for token ID. It returns cached token source if it exists.
+func (s *server) getTokenSource(tokenID int64) oauth2.TokenSource {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if ts, ok := s.tokenSources[uid]; ok {
+	if ts, ok := s.tokenSources[tokenID]; ok {
 		return ts
 	}
 
-	s.tokenSources[uid] = &tokenSource{
-		db:   s.db,
-		auth: s.auth,
-		uid:  uid,
+	s.tokenSources[tokenID] = &tokenSource{
+		db:      s.db,
+		auth:    s.auth,
+		tokenID: tokenID,
 	}
-	return s.tokenSources[uid]
+	return s.tokenSources[tokenID]
 }
 
+// getTokenSource returns token source of user's active account.
 func (c *customContext) getTokenSource() oauth2.TokenSource {
-	return c.s.getTokenSource(c.user.ID)
+	return c.s.getTokenSource(c.user.tokenID())
 }
 
 // tokenSource is an oauth2 token source that saves token to database.
 // It also refreshes token if it's invalid. It's safe for concurrent use.
 type tokenSource struct {
-	db   *gorm.DB
-	auth *giraauth.Client
-	uid  int64
+	db      *gorm.DB
+	auth    *giraauth.Client
+	tokenID int64
 
 	mu sync.Mutex
 }
@@ -633,11 +920,11 @@ func (t *tokenSource) Token() (*oauth2.Token, error) {
 	defer t.mu.Unlock()
 
 	var tok Token
-	if err := t.db.First(&tok, t.uid).Error; err != nil {
+	if err := t.db.First(&tok, t.tokenID).Error; err != nil {
 		return nil, err
 	}
 
-	l := log.New(os.Stderr, fmt.Sprintf("tokenSource[uid:%d] ", t.uid), log.LstdFlags)
+	l := log.New(os.Stderr, fmt.Sprintf("tokenSource[token:%d] ", t.tokenID), log.LstdFlags)
 
 	if tok.Token.Valid() {
 		l.Printf("token is valid")
@@ -657,7 +944,8 @@ func (t *tokenSource) Token() (*oauth2.Token, error) {
 	l.Printf("refreshed ok")
 
 	tok.Token = newToken
-	if err := t.db.Save(&tok).Error; err != nil {
+	// only the token, Firebase token might have been saved concurrently, see saveFbToken
+	if err := t.db.Model(&tok).Select("Token").Updates(&tok).Error; err != nil {
 		l.Printf("save error: %v", err)
 		return nil, err
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// newTestServer returns server with empty database, and user uid in it.
+func newTestServer(t *testing.T, uid int64) *server {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}, &Token{}, &RideDay{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&User{ID: uid}).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d, _ := db.DB()
+		_ = d.Close()
+	})
+	return &server{db: db}
+}
+
+// loadTestUser returns user uid from the database of s.
+func loadTestUser(t *testing.T, s *server, uid int64) User {
+	t.Helper()
+	var u User
+	if err := s.db.First(&u, uid).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestFilteredUser(t *testing.T) {
+	u := User{
+		ID:             1,
+		Email:          "user@example.com",
+		Favorites:      map[gira.StationSerial]string{"ss1": "home"},
+		LastLatitude:   38.725177,
+		LastLongitude:  -9.149718,
+		LastLocationAt: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+	got := filteredUser(u).String()
+	for _, leaked := range []string{"user@example.com", "home", "38.72", "-9.14", "2024-07-01"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("filtered user contains %q:\n%s", leaked, got)
+		}
+	}
+	if u.LastLatitude == 0 || u.Email == "" {
+		t.Error("filtering modified the original user")
+	}
+}
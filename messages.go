@@ -36,34 +36,50 @@ const messageHelp = `
 How to use this bot:
 
 📍 Send me a location, and I'll show you the nearest bike stations. You can share your location using convenient menu button, or any point via 📎 → Location.
-🅿️ Tap on a station to see available bikes. Or just send station number to view it.
+🛰 If you share live location, I'll keep the list of nearest stations updated as you move.
+🔎 Use ⚡️/⚙️/🆓 buttons under the list to show only stations with e-bikes, regular bikes or free docks.
+🅿️ Tap on a station to see available bikes. Or just send station number to view it, or station and dock number (e.g. _472 12_) to unlock the bike in that dock, or bike number (e.g. _E1234_) to find where it's docked.
 ⚡️ – electric bikes, ⚙️ – regular bikes, 💯 – full battery
+📤 Use Share button under a station to send its availability and a link to open it in the bot to a friend.
 
-📋 Tap on a bike to open unlock menu.
+📷 Or send me a photo of the QR code on a dock or bike, and I'll find it at stations near your last location.
+📋 Tap on a bike to open unlock menu. If Gira gets stuck with a reserved bike, run /cancel.
+🚫 Bikes can be marked to avoid from the unlock menu, I'll warn you before unlocking them. 💖 Favorite bikes are highlighted when they show up in stations.
 
-ℹ️ I will show you the current trip status, and after returning the bike, I will show you the trip summary.
+ℹ️ I will show you the current trip status, and after returning the bike, I will show you the trip summary. If the trip message got lost, run /trip.
 🔚 While you have active trip, you can also send me location, I will show you how many docks are available there. _The station information is delayed, so the dock might end up being taken._
+💶 Run /pricing to see tariffs and how much your current or last trip costs under each of them.
 💸 If required, you can pay for the trip using buttons in the chat _(not well-tested)_.
-📈 Also, I'll ask you to rate the trip afterwards.
+📈 Also, I'll ask you to rate the trip afterwards. Older unrated trips can be rated via /unrated.
 
 ⭐️ You can name your favorite stations, I could list them, and include names in searches for convenience.
 
-🤓 If neat keyboard disappeared, run /help. To re-login run /login.
+📊 Run /stats to see your totals, including rough CO₂ and calories estimates.
+💰 Run /points to see points earned and spent on recent trips, and how far the next euro is.
+🧾 Run /export to get all your trips as CSV file, or /export json for JSON. Add a month, e.g. /export csv 2024-05, to get just its trips.
+
+🕗 Run /commute to get a morning report with bikes at your favorite stations.
+⚙️ Run /settings to change how many nearby stations are shown and how far to look, enable riding streak reminders, or set quiet hours for them.
+
+📝 Run /feedback to send a message to the author.
+🥰 Run /donate to support the bot with Telegram Stars.
+
+👥 If you manage several Gira accounts, add and switch between them via /accounts.
+
+🤓 If neat keyboard disappeared, run /help. To re-login run /login, to log out run /logout. To delete all your data from the bot, run /deleteaccount.
 `
 
 const messageFeedback = `
 ☺️ Hope you're enjoying the bot! It's a small pet project, and I'd love to hear your feedback.
-Feel free to drop me a message at @ilyaluk.
+Send me your thoughts, ideas or bug reports in one message, and I'll forward it to the author. Replies will come right here.
 `
 
 const messageDonate = `
-🥰 If you liked the bot, you can support it by donating. It will help me to keep the bot running and improve it.
-
-💳 revolut.me/ilyaluk (from any bank card)
+🥰 If you liked the bot, you can support it by donating with Telegram Stars. It will help me to keep the bot running and improve it.
 
 💌 Feel free to drop me a message at @ilyaluk if you have any questions or suggestions.
 
-Won't bother you with this message anymore. 🤗
+You can always come back to it via /donate.
 `
 
 const messageRateTrip = `
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+var giraDownGauge = promauto.NewGauge(prometheus.GaugeOpts{Name: "girabot_gira_down"})
+
+const (
+	// giraHealthWindow is the period over which Gira request outcomes are considered.
+	giraHealthWindow = 5 * time.Minute
+	// giraHealthMinRequests is the minimum number of requests in the window to make any conclusion.
+	giraHealthMinRequests = 10
+	// giraDownRatio and giraUpRatio are failure ratios to consider Gira down and recovered.
+	// They are different, so that the state doesn't flap on the edge.
+	giraDownRatio = 0.5
+	giraUpRatio   = 0.1
+	// giraOutageNotifyInterval limits how often users are notified about outages, in case it flaps anyway.
+	giraOutageNotifyInterval = time.Hour
+	// serviceNoticeTimeout limits fetching of service status for outage notification, Gira is likely failing then.
+	serviceNoticeTimeout = 15 * time.Second
+)
+
+type giraHealthEvent struct {
+	at     time.Time
+	failed bool
+}
+
+// giraHealth tracks Gira request failures across all users, to detect when the backend is down.
+type giraHealth struct {
+	mu     sync.Mutex
+	events []giraHealthEvent
+	down   bool
+	// affected are users who got Gira errors recently, they are notified about the outage and recovery.
+	affected map[int64]time.Time
+	// lastNotify is the last time users were notified about an outage,
+	// notified is whether they were notified about the current one
+	lastNotify time.Time
+	notified   bool
+}
+
+// isGiraMaintenance returns true during nightly hours when Gira is not available by design.
+func isGiraMaintenance(t time.Time) bool {
+	hr := t.In(lisbonTZ).Hour()
+	return hr >= 2 && hr < 6
+}
+
+// markAffected records that user got a Gira error, so that they are notified about the outage and recovery.
+// Request outcome itself is recorded by observe.
+func (h *giraHealth) markAffected(uid int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.affected == nil {
+		h.affected = make(map[int64]time.Time)
+	}
+	h.affected[uid] = time.Now()
+}
+
+// observe records one request outcome at time now and returns whether down state changed.
+func (h *giraHealth) observe(now time.Time, failed bool) (changed, down bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if isGiraMaintenance(now) {
+		return false, h.down
+	}
+
+	h.events = append(h.events, giraHealthEvent{at: now, failed: failed})
+
+	// drop old events, they are in chronological order
+	i := 0
+	for i < len(h.events) && now.Sub(h.events[i].at) > giraHealthWindow {
+		i++
+	}
+	h.events = h.events[i:]
+	for uid, at := range h.affected {
+		if !h.down && now.Sub(at) > giraHealthWindow {
+			delete(h.affected, uid)
+		}
+	}
+
+	if len(h.events) < giraHealthMinRequests {
+		return false, h.down
+	}
+
+	var failures int
+	for _, e := range h.events {
+		if e.failed {
+			failures++
+		}
+	}
+	ratio := float64(failures) / float64(len(h.events))
+
+	switch {
+	case !h.down && ratio >= giraDownRatio:
+		h.down = true
+	case h.down && ratio <= giraUpRatio:
+		h.down = false
+	default:
+		return false, h.down
+	}
+
+	log.Printf("bot: gira down state changed to %v, failure ratio %.2f of %d requests", h.down, ratio, len(h.events))
+	if h.down {
+		giraDownGauge.Set(1)
+	} else {
+		giraDownGauge.Set(0)
+	}
+	return true, h.down
+}
+
+// isDown returns whether Gira currently looks down.
+func (h *giraHealth) isDown() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down
+}
+
+// usersToNotify returns users who should be told about the outage state change, extra users are
+// added to the affected ones on outage. On recovery, affected users are reset.
+func (h *giraHealth) usersToNotify(down bool, extra []int64) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if down {
+		h.notified = time.Since(h.lastNotify) >= giraOutageNotifyInterval
+		if !h.notified {
+			return nil
+		}
+		h.lastNotify = time.Now()
+
+		if h.affected == nil {
+			h.affected = make(map[int64]time.Time)
+		}
+		for _, uid := range extra {
+			h.affected[uid] = time.Now()
+		}
+	}
+
+	var uids []int64
+	if h.notified {
+		uids = slices.Collect(maps.Keys(h.affected))
+	}
+	if !down {
+		h.affected = nil
+		h.notified = false
+	}
+	return uids
+}
+
+// isGiraOutageError returns true for errors which indicate Gira backend issues, not user's ones.
+func isGiraOutageError(err error) bool {
+	switch gira.ErrorCodeOf(err) {
+	case gira.CodeServiceUnavailable, gira.CodeTMLCommunication:
+		return true
+	}
+	return false
+}
+
+// serviceNotice returns Gira service status, if it's not operational, and current announcements,
+// formatted as plain text. It's supplementary, so errors are only logged.
+func serviceNotice(ctx context.Context, g gira.API) string {
+	var lines []string
+
+	status, err := g.GetServiceStatus(ctx)
+	if err != nil {
+		log.Println("bot: ignored service status error:", err)
+	} else if !status.Operational() {
+		lines = append(lines, "🚧 "+cmp.Or(status.Description, status.Name, status.Status))
+	}
+
+	msgs, err := g.GetMessages(ctx)
+	if err != nil {
+		log.Println("bot: ignored service messages error:", err)
+	}
+	for _, m := range msgs {
+		line := "📢 " + m.Title
+		if m.Description != "" {
+			line += ": " + m.Description
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// fetchServiceNotice returns serviceNotice using any account.
+func (s *server) fetchServiceNotice() string {
+	g, err := s.getBackgroundClient()
+	if err != nil {
+		log.Println("bot: ignored background client error:", err)
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serviceNoticeTimeout)
+	defer cancel()
+	return serviceNotice(ctx, g)
+}
+
+// observeGiraResult is retryablehttp result observer of all Gira clients.
+func (s *server) observeGiraResult(_ string, failed bool) {
+	s.observeGiraHealth(failed)
+}
+
+// observeGiraHealth is fed from all Gira requests, and notifies users on outage state change.
+func (s *server) observeGiraHealth(failed bool) {
+	changed, down := s.giraHealth.observe(time.Now(), failed)
+	if !changed {
+		return
+	}
+	// observer is called from request path, don't block it
+	go s.notifyGiraOutage(down)
+}
+
+func (s *server) notifyGiraOutage(down bool) {
+	adminMsg := "gira looks down"
+	msg := "⚠️ Gira seems to be having issues right now, it's not you. " +
+		"I'll let you know when it's back."
+	if !down {
+		adminMsg = "gira recovered"
+		msg = "✅ Gira seems to be working again. Sorry for the trouble!"
+	} else if notice := s.fetchServiceNotice(); notice != "" {
+		msg += "\n\nOfficial status:\n" + notice
+	}
+
+	if _, err := s.bot.Send(tele.ChatID(*adminID), adminMsg); err != nil {
+		log.Println("bot: error sending outage alert:", err)
+	}
+
+	var onTrip []int64
+	if down {
+		// users on a trip should know that trip updates might be delayed
+		if err := s.db.Model(&User{}).Where("current_trip_message_id != ''").Pluck("id", &onTrip).Error; err != nil {
+			log.Println("bot: error getting users on trip:", err)
+		}
+	}
+
+	uids := s.giraHealth.usersToNotify(down, onTrip)
+	if len(uids) == 0 {
+		return
+	}
+
+	var users []User
+	if err := s.db.Where("id IN ?", uids).Find(&users).Error; err != nil {
+		log.Println("bot: error getting users for outage notification:", err)
+		return
+	}
+
+	log.Printf("bot: notifying %d users about gira down state %v", len(users), down)
+	for _, u := range users {
+		if err := s.sendNotification(&u, notification{
+			Text: msg,
+			// state might change again, don't deliver stale news after quiet hours
+			ExpiresAt: time.Now().Add(giraOutageNotifyInterval),
+		}); err != nil {
+			log.Printf("[uid:%d] ignored outage notification error: %v", u.ID, err)
+		}
+	}
+}
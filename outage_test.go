@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira"
+	"github.com/ilyaluk/girabot/gira/girafake"
+)
+
+func TestGiraHealthObserve(t *testing.T) {
+	noon := time.Date(2024, 7, 1, 12, 0, 0, 0, lisbonTZ)
+
+	tests := []struct {
+		name string
+		// outcomes are observed a second apart, true is a failure
+		outcomes []bool
+		start    time.Time
+		wantDown bool
+	}{
+		{"no requests", nil, noon, false},
+		{"too few failures to conclude", []bool{true, true, true, true, true}, noon, false},
+		{"mostly failing", []bool{true, true, true, true, true, false, false, false, false, true}, noon, true},
+		{"some failures", []bool{true, true, true, false, false, false, false, false, false, false}, noon, false},
+		{"nightly maintenance", slices.Repeat([]bool{true}, 20), noon.Add(-9 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		var h giraHealth
+		var changes int
+		for i, failed := range tt.outcomes {
+			if changed, _ := h.observe(tt.start.Add(time.Duration(i)*time.Second), failed); changed {
+				changes++
+			}
+		}
+		if h.isDown() != tt.wantDown {
+			t.Errorf("%s: down = %v, want %v", tt.name, h.isDown(), tt.wantDown)
+		}
+		if tt.wantDown && changes != 1 {
+			t.Errorf("%s: state changed %d times, want 1", tt.name, changes)
+		}
+	}
+}
+
+func TestGiraHealthRecovery(t *testing.T) {
+	noon := time.Date(2024, 7, 1, 12, 0, 0, 0, lisbonTZ)
+
+	var h giraHealth
+	for i := range giraHealthMinRequests {
+		h.observe(noon.Add(time.Duration(i)*time.Second), true)
+	}
+	if !h.isDown() {
+		t.Fatal("not down after failures")
+	}
+
+	// old failures leave the window, recovery needs mostly successful requests
+	later := noon.Add(giraHealthWindow + time.Minute)
+	for i := range giraHealthMinRequests {
+		changed, down := h.observe(later.Add(time.Duration(i)*time.Second), false)
+		if want := i == giraHealthMinRequests-1; changed != want || down == want {
+			t.Fatalf("request %d: changed = %v, down = %v", i, changed, down)
+		}
+	}
+}
+
+func TestGiraHealthUsersToNotify(t *testing.T) {
+	var h giraHealth
+	h.markAffected(1)
+	h.markAffected(2)
+
+	got := h.usersToNotify(true, []int64{3})
+	slices.Sort(got)
+	if want := []int64{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("outage users = %v, want %v", got, want)
+	}
+
+	// users hitting errors during the outage are told about recovery too
+	h.markAffected(4)
+	got = h.usersToNotify(false, nil)
+	slices.Sort(got)
+	if want := []int64{1, 2, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("recovery users = %v, want %v", got, want)
+	}
+
+	// outage right after the previous one is not announced
+	h.markAffected(5)
+	if got := h.usersToNotify(true, nil); got != nil {
+		t.Errorf("flapping outage users = %v, want none", got)
+	}
+	if got := h.usersToNotify(false, nil); got != nil {
+		t.Errorf("flapping recovery users = %v, want none", got)
+	}
+}
+
+func TestServiceNotice(t *testing.T) {
+	fake := girafake.New()
+	if got := serviceNotice(context.Background(), fake); got != "" {
+		t.Errorf("notice for operational service = %q, want empty", got)
+	}
+
+	fake.ServiceStatus = gira.ServiceStatus{Status: "inactive", Description: "Maintenance"}
+	fake.Messages = []gira.Message{
+		{Title: "Station 101 closed", Description: "Roadworks"},
+		{Title: "Old news", EndDate: time.Now().Add(-time.Hour)},
+	}
+	want := "🚧 Maintenance\n📢 Station 101 closed: Roadworks"
+	if got := serviceNotice(context.Background(), fake); got != want {
+		t.Errorf("notice = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	// pointsPerEuro is how many Gira points are worth one euro when paying for trips.
+	pointsPerEuro = 500
+	// pointsHistoryTrips is how many recent trips are shown in /points.
+	pointsHistoryTrips = 10
+)
+
+func (c *customContext) handlePoints() error {
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := c.gira.GetBalance(c)
+	if err != nil {
+		return err
+	}
+	trips, err := c.gira.GetTripHistory(c, 1, pointsHistoryTrips)
+	if err != nil {
+		return err
+	}
+
+	toNext := pointsPerEuro - info.Bonus%pointsPerEuro
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf(
+		"💰 Points: %d (%d€)\n"+
+			"🎯 %d more points to the next euro\n",
+		info.Bonus,
+		info.Bonus/pointsPerEuro,
+		toNext,
+	))
+
+	if len(trips) == 0 {
+		return c.Send(sb.String())
+	}
+
+	sb.WriteString("\n🧾 Recent trips, earned / spent → balance after:\n")
+	// walk back from the current balance, newest trip first
+	balance := info.Bonus
+	for _, t := range trips {
+		sb.WriteString(fmt.Sprintf(
+			"• %s %s: +%d / -%d → %d\n",
+			t.StartDate.In(lisbonTZ).Format("02.01 15:04"),
+			t.BikeName,
+			t.TotalBonus,
+			t.CostBonus,
+			balance,
+		))
+		balance = balance - t.TotalBonus + t.CostBonus
+	}
+	sb.WriteString("_Balance is estimated from trips, points given or expired outside of trips are not shown._")
+
+	return c.Send(sb.String(), tele.ModeMarkdown)
+}
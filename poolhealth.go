@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/internal/tokenserver"
+)
+
+var poolAlertThreshold = flag.Int64("pool-alert-threshold", 5,
+	"admin is notified when Firebase tokens available in 10 minutes drop below this, 0 to disable")
+
+const (
+	// poolHealthCheckInterval is how often the token pool is checked for low-pool alerts.
+	poolHealthCheckInterval = 5 * time.Minute
+	// poolHealthTimeout limits one check, token server might be the thing that's down.
+	poolHealthTimeout = 30 * time.Second
+)
+
+// poolHealth tracks whether token pool is low, so that admin is notified once per episode.
+type poolHealth struct {
+	mu  sync.Mutex
+	low bool
+}
+
+// observe records available tokens and returns whether low state changed.
+func (h *poolHealth) observe(available, threshold int64) (changed, low bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	low = available < threshold
+	changed = low != h.low
+	h.low = low
+	return changed, low
+}
+
+// getPoolStats returns token pool stats. Exchange server accepts any of its Firebase tokens as stats auth,
+// the cached one of admin's active account is used, so that checks don't take tokens from the pool.
+func (s *server) getPoolStats(ctx context.Context) (*tokenserver.Stats, error) {
+	var admin User
+	if err := s.db.First(&admin, *adminID).Error; err != nil {
+		return nil, fmt.Errorf("loading admin: %w", err)
+	}
+	tokenID := admin.tokenID()
+
+	fbToken, err := s.tokenServer.Transport(nil, s.getTokenSource(tokenID)).Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting firebase token: %w", err)
+	}
+	return s.tokenServer.GetStats(ctx, fbToken)
+}
+
+func formatPoolStats(st *tokenserver.Stats) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Available: *%d*\n", st.AvailableTokens)
+	fmt.Fprintf(&sb, "Available in 10 mins: *%d*", st.AvailableTokensAfter10Mins)
+	if *poolAlertThreshold > 0 && st.AvailableTokensAfter10Mins < *poolAlertThreshold {
+		fmt.Fprintf(&sb, " ⚠️ below %d", *poolAlertThreshold)
+	}
+	fmt.Fprintf(&sb, "\nAssigned: %d\n", st.AssignedTokens)
+	fmt.Fprintf(&sb, "Valid: %d of %d total\n", st.ValidTokens, st.TotalTokens)
+	fmt.Fprintf(&sb, "Expired unassigned: %d", st.ExpiredUnassigned)
+	return sb.String()
+}
+
+func (c *customContext) handlePoolHealth() error {
+	st, err := c.s.getPoolStats(c)
+	if err != nil {
+		return err
+	}
+	return c.Send("🔑 Token pool\n\n"+formatPoolStats(st), tele.ModeMarkdown)
+}
+
+// poolHealthChecker notifies admin when token pool gets low, and when it recovers.
+// It's a no-op without -firebase-token, or with static token.
+func (s *server) poolHealthChecker() {
+	if *poolAlertThreshold <= 0 || !*useFbToken || *staticFbToken != "" {
+		return
+	}
+
+	for {
+		time.Sleep(poolHealthCheckInterval)
+
+		ctx, cancel := context.WithTimeout(context.Background(), poolHealthTimeout)
+		st, err := s.getPoolStats(ctx)
+		cancel()
+		if err != nil {
+			log.Println("pool health check error:", err)
+			continue
+		}
+
+		changed, low := s.poolHealth.observe(st.AvailableTokensAfter10Mins, *poolAlertThreshold)
+		if !changed {
+			continue
+		}
+
+		msg := "🔑 Token pool recovered\n\n"
+		if low {
+			msg = "🔑 Token pool is low, unlocks may start failing\n\n"
+		}
+		if _, err := s.bot.Send(tele.ChatID(*adminID), msg+formatPoolStats(st), tele.ModeMarkdown); err != nil {
+			log.Println("error sending pool health alert:", err)
+		}
+	}
+}
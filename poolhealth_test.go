@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/ilyaluk/girabot/internal/tokenserver"
+)
+
+func TestPoolHealthObserve(t *testing.T) {
+	var h poolHealth
+	for _, tt := range []struct {
+		available   int64
+		wantChanged bool
+		wantLow     bool
+	}{
+		{10, false, false},
+		{4, true, true},
+		{2, false, true},
+		{5, true, false},
+		{7, false, false},
+	} {
+		changed, low := h.observe(tt.available, 5)
+		if changed != tt.wantChanged || low != tt.wantLow {
+			t.Errorf("observe(%d) = %v, %v, want %v, %v", tt.available, changed, low, tt.wantChanged, tt.wantLow)
+		}
+	}
+}
+
+func TestGetPoolStats(t *testing.T) {
+	const admin, secondary = 1, 7
+
+	signed := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	accessToken := signed(jwt.MapClaims{
+		"sub": "45e33173-2943-47ae-92de-59afbcab4c4c",
+		"jti": "3ebb9117-7150-4547-8cca-f51fd6e55f46",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	fbToken := signed(jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+	var exchanges int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/exchange":
+			if r.Header.Get("X-Gira-Token") != accessToken {
+				t.Errorf("exchange with token of another account")
+			}
+			exchanges++
+			fmt.Fprint(w, fbToken)
+		case "/stats":
+			if r.Header.Get("X-Firebase-Token") != fbToken {
+				t.Errorf("stats with unexpected firebase token")
+			}
+			fmt.Fprint(w, `{"available_tokens": 3}`)
+		}
+	}))
+	defer srv.Close()
+
+	s := newTestServer(t, admin)
+	s.tokenServer = tokenserver.NewClient(srv.URL)
+	s.tokenSources = map[int64]*tokenSource{}
+	if err := s.db.Model(&User{ID: admin}).Update("ActiveAccount", secondary).Error; err != nil {
+		t.Fatal(err)
+	}
+	tok := &oauth2.Token{AccessToken: accessToken, Expiry: time.Now().Add(time.Hour)}
+	if err := s.db.Create(&Token{ID: secondary, UserID: admin, Token: tok}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	oldAdminID := *adminID
+	*adminID = admin
+	defer func() { *adminID = oldAdminID }()
+
+	for range 2 {
+		st, err := s.getPoolStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.AvailableTokens != 3 {
+			t.Errorf("available = %d, want 3", st.AvailableTokens)
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("exchanges = %d, want 1, cached token should be reused", exchanges)
+	}
+}
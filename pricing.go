@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// tariff describes how trips are charged under a subscription type.
+// Trips are free up to freeTime, after that each started period costs periodCost.
+type tariff struct {
+	name         string
+	price        string
+	freeTime     time.Duration
+	period       time.Duration
+	periodCost   gira.Money
+	nameKeywords []string
+}
+
+// tariffs are Gira trip tariffs as published on gira-bicicletasdelisboa.pt.
+// These are encoded here as API doesn't expose them, update when they change.
+var tariffs = []tariff{
+	{
+		name:         "Annual",
+		price:        "25€/year",
+		freeTime:     45 * time.Minute,
+		period:       45 * time.Minute,
+		periodCost:   100,
+		nameKeywords: []string{"anual", "annual"},
+	},
+	{
+		name:         "Monthly",
+		price:        "15€/month",
+		freeTime:     45 * time.Minute,
+		period:       45 * time.Minute,
+		periodCost:   100,
+		nameKeywords: []string{"mensal", "month"},
+	},
+	{
+		name:         "Daily",
+		price:        "2€/day",
+		freeTime:     45 * time.Minute,
+		period:       45 * time.Minute,
+		periodCost:   200,
+		nameKeywords: []string{"diári", "diari", "daily", "24h"},
+	},
+}
+
+// cost returns the cost of the trip of given duration under the tariff.
+func (t tariff) cost(d time.Duration) gira.Money {
+	if d <= t.freeTime {
+		return 0
+	}
+	periods := math.Ceil(float64(d-t.freeTime) / float64(t.period))
+	return gira.Money(periods) * t.periodCost
+}
+
+func (t tariff) String() string {
+	return fmt.Sprintf(
+		"%s (%s): first %.0f min free, then %s per started %.0f min",
+		t.name, t.price, t.freeTime.Minutes(), t.periodCost, t.period.Minutes(),
+	)
+}
+
+// findTariff returns tariff of the first recognized active subscription, or nil.
+func findTariff(subs []gira.ClientSubscription) *tariff {
+	for _, s := range subs {
+		if !s.Active {
+			continue
+		}
+		name := strings.ToLower(s.SubscriptionName + " " + s.SubscriptionCode)
+		for i, t := range tariffs {
+			if slices.ContainsFunc(t.nameKeywords, func(k string) bool { return strings.Contains(name, k) }) {
+				return &tariffs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// tariffUnknown is stored in User.CurrentTripTariff if user's subscription wasn't recognized,
+// so that it's not looked up on every trip update.
+const tariffUnknown = "unknown"
+
+func tariffByName(name string) *tariff {
+	for i, t := range tariffs {
+		if t.name == name {
+			return &tariffs[i]
+		}
+	}
+	return nil
+}
+
+// getCurrentTripTariff returns the tariff active trip is charged with, or nil if it's unknown.
+// Subscription is looked up once per trip and stored in user.
+func (c *customContext) getCurrentTripTariff(ctx context.Context) *tariff {
+	if c.user.CurrentTripTariff == "" {
+		info, err := c.gira.GetClientInfo(ctx)
+		if err != nil {
+			log.Printf("[uid:%d] ignored client info error: %v", c.user.ID, err)
+			return nil
+		}
+
+		c.user.CurrentTripTariff = tariffUnknown
+		if t := findTariff(info.ActiveSubscriptions); t != nil {
+			c.user.CurrentTripTariff = t.name
+		}
+		if err := c.s.db.Model(c.user).Update("CurrentTripTariff", c.user.CurrentTripTariff).Error; err != nil {
+			log.Printf("[uid:%d] ignored save tariff error: %v", c.user.ID, err)
+		}
+	}
+	return tariffByName(c.user.CurrentTripTariff)
+}
+
+func (c *customContext) handlePricing() error {
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := c.gira.GetClientInfo(c)
+	if err != nil {
+		return err
+	}
+	userTariff := findTariff(info.ActiveSubscriptions)
+
+	sb := strings.Builder{}
+	sb.WriteString("💶 Gira tariffs:\n")
+	for _, t := range tariffs {
+		sb.WriteString("• " + t.String() + "\n")
+	}
+	sb.WriteString("_Tariffs are encoded in the bot and might be outdated, check the official app for exact prices._\n\n")
+
+	if userTariff != nil {
+		sb.WriteString(fmt.Sprintf("🎫 Your subscription: %s\n\n", userTariff.name))
+	} else {
+		sb.WriteString("🎫 I couldn't recognize your active subscription.\n\n")
+	}
+
+	var (
+		tripDuration time.Duration
+		tripTitle    string
+	)
+	trip, err := c.gira.GetActiveTrip(c)
+	switch {
+	case err == nil:
+		tripDuration = time.Since(trip.StartDate)
+		tripTitle = "current trip"
+	case errors.Is(err, gira.ErrNoActiveTrip):
+		trips, err := c.gira.GetTripHistory(c, 1, 1)
+		if err != nil {
+			return err
+		}
+		if len(trips) == 0 {
+			return c.Send(sb.String(), tele.ModeMarkdown)
+		}
+		trip = trips[0]
+		tripDuration = trip.EndDate.Sub(trip.StartDate)
+		tripTitle = "last trip"
+	default:
+		return err
+	}
+
+	sb.WriteString(fmt.Sprintf(
+		"🚲 Your %s (%v) would cost:\n",
+		tripTitle,
+		tripDuration.Truncate(time.Second),
+	))
+	for i, t := range tariffs {
+		var mark string
+		if userTariff == &tariffs[i] {
+			mark = " ← you"
+		}
+		sb.WriteString(fmt.Sprintf("• %s: %s%s\n", t.name, t.cost(tripDuration), mark))
+	}
+
+	return c.Send(sb.String(), tele.ModeMarkdown)
+}
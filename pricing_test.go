@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+func TestTariffCost(t *testing.T) {
+	annual := tariff{freeTime: 45 * time.Minute, period: 45 * time.Minute, periodCost: 100}
+	daily := tariff{freeTime: 45 * time.Minute, period: 45 * time.Minute, periodCost: 200}
+
+	tests := []struct {
+		tariff tariff
+		d      time.Duration
+		want   gira.Money
+	}{
+		{annual, 0, 0},
+		{annual, 10 * time.Minute, 0},
+		{annual, 45 * time.Minute, 0},
+		{annual, 45*time.Minute + time.Second, 100},
+		{annual, 90 * time.Minute, 100},
+		{annual, 91 * time.Minute, 200},
+		{annual, 3 * time.Hour, 300},
+		{daily, 46 * time.Minute, 200},
+		{daily, 2 * time.Hour, 400},
+	}
+
+	for _, tt := range tests {
+		if got := tt.tariff.cost(tt.d); got != tt.want {
+			t.Errorf("cost(%v) with %v periods = %v, want %v", tt.d, tt.tariff.periodCost, got, tt.want)
+		}
+	}
+}
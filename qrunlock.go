@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+var zbarimgPath = flag.String("zbarimg-path", "zbarimg", "path to zbarimg binary used to decode QR codes on photos, empty to disable")
+
+// qrSearchStations is how many stations around user's last location are searched for the dock from QR code.
+const qrSearchStations = 10
+
+// qrMinTokenLen is the minimum length of QR content token to be matched against identifiers,
+// shorter ones would match dock numbers and other noise.
+const qrMinTokenLen = 4
+
+// decodeQR returns contents of all QR codes and barcodes found on the image.
+// Decoding is done with zbarimg from zbar tools, as there's no decent pure Go decoder.
+func decodeQR(ctx context.Context, img io.Reader) ([]string, error) {
+	if *zbarimgPath == "" {
+		return nil, errors.New("qr: decoding disabled")
+	}
+
+	f, err := os.CreateTemp("", "girabot-qr-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, img); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, *zbarimgPath, "--quiet", "--raw", f.Name())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		// zbarimg exits with 4 if no symbols were found
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 4 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("qr: zbarimg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var res []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// qrTokens splits decoded QR codes contents into tokens which might be dock or bike identifiers.
+// Format of the codes on docks is not documented, so instead of parsing a specific format,
+// all alphanumeric parts (e.g. URL path segments and query values) are matched against
+// identifiers of docks and bikes around, see matchQRDock.
+func qrTokens(contents []string) []string {
+	var res []string
+	for _, c := range contents {
+		tokens := strings.FieldsFunc(c, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+		})
+		for _, t := range tokens {
+			t = strings.ToUpper(strings.Trim(t, "-_"))
+			if len(t) >= qrMinTokenLen && !slices.Contains(res, t) {
+				res = append(res, t)
+			}
+		}
+	}
+	return res
+}
+
+// matchQRDock returns the dock which code, serial, or its bike's name, code or serial is one of tokens.
+func matchQRDock(docks gira.Docks, tokens []string) *gira.Dock {
+	matches := func(id string) bool {
+		return id != "" && slices.Contains(tokens, strings.ToUpper(id))
+	}
+
+	for i, d := range docks {
+		if matches(string(d.Code)) || matches(string(d.Serial)) {
+			return &docks[i]
+		}
+		if d.Bike != nil && (matches(d.Bike.Name) || matches(string(d.Bike.Code)) || matches(string(d.Bike.Serial))) {
+			return &docks[i]
+		}
+	}
+	return nil
+}
+
+func (c *customContext) handlePhoto() error {
+	if c.user.State == UserStateWaitingForRateComment {
+		return c.handleRatePhoto()
+	}
+
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	photo := c.Message().Photo
+	rc, err := c.Bot().File(&photo.File)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	contents, err := decodeQR(ctx, rc)
+	if err != nil {
+		log.Printf("[uid:%d] qr decode error: %v", c.user.ID, err)
+		return c.Reply("😔 Sorry, I can't read QR codes right now, send me station number or location instead.")
+	}
+	log.Printf("[uid:%d] decoded qr: %q", c.user.ID, contents)
+
+	tokens := qrTokens(contents)
+	if len(tokens) == 0 {
+		return c.Reply("🤔 I couldn't find dock QR code on this photo. Try again closer, or send me station number.")
+	}
+
+	if c.user.LastLocationAt.IsZero() || time.Since(c.user.LastLocationAt) > lastLocationMaxAge {
+		return c.Reply("📍 Please send me your location first, so I know where to look for this dock, then send the photo again.")
+	}
+
+	station, dock, err := c.findQRDockNear(tokens, &tele.Location{
+		Lat: float32(c.user.LastLatitude),
+		Lng: float32(c.user.LastLongitude),
+	})
+	if err != nil {
+		return err
+	}
+	if dock == nil {
+		return c.Reply("😔 I couldn't find the dock from this QR code at stations near your last location.")
+	}
+	if dock.Bike == nil {
+		return c.Reply(fmt.Sprintf("Dock %d at station %s is empty", dock.Number, station.Number()))
+	}
+
+	return c.sendBikeMessage(dock.Bike.CallbackData())
+}
+
+// findQRDockNear looks for the dock matching QR code tokens at stations nearest to loc.
+func (c *customContext) findQRDockNear(tokens []string, loc *tele.Location) (gira.Station, *gira.Dock, error) {
+	ss, err := c.gira.GetStations(c)
+	if err != nil {
+		return gira.Station{}, nil, err
+	}
+
+	ss = slices.DeleteFunc(ss, func(i gira.Station) bool {
+		return i.Status != gira.AssetStatusActive
+	})
+	slices.SortFunc(ss, func(i, j gira.Station) int {
+		return cmp.Compare(distance(i, loc), distance(j, loc))
+	})
+	ss = ss[:min(qrSearchStations, len(ss))]
+
+	for i, docks := range c.getStationsDocks(ss) {
+		if d := matchQRDock(docks, tokens); d != nil {
+			return ss[i], d, nil
+		}
+	}
+	return gira.Station{}, nil, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+func TestQRTokens(t *testing.T) {
+	tests := []struct {
+		contents []string
+		want     []string
+	}{
+		{nil, nil},
+		{[]string{"E1234"}, []string{"E1234"}},
+		{[]string{"https://gira.pt/unlock?bike=e1234&dock=12"}, []string{"HTTPS", "GIRA", "UNLOCK", "BIKE", "E1234", "DOCK"}},
+		{[]string{"  -abc_12-  ", "ABC_12"}, []string{"ABC_12"}},
+		{[]string{"12 ab x"}, nil},
+		{[]string{"C-1234/D-4"}, []string{"C-1234"}},
+	}
+
+	for _, tt := range tests {
+		if got := qrTokens(tt.contents); !slices.Equal(got, tt.want) {
+			t.Errorf("qrTokens(%q) = %q, want %q", tt.contents, got, tt.want)
+		}
+	}
+}
+
+func TestMatchQRDock(t *testing.T) {
+	docks := gira.Docks{
+		{Code: "dock-a", Serial: "DS0001", Number: 1},
+		{Code: "dock-b", Serial: "DS0002", Number: 2, Bike: &gira.Bike{Code: "bike-b", Serial: "BS0002", Name: "E0002"}},
+		{Code: "dock-c", Serial: "DS0003", Number: 3, Bike: &gira.Bike{Code: "bike-c", Serial: "BS0003", Name: "C0003"}},
+	}
+
+	tests := []struct {
+		tokens []string
+		want   int
+	}{
+		{nil, 0},
+		{[]string{"UNKNOWN"}, 0},
+		{[]string{"DS0001"}, 1},
+		{[]string{"DOCK-B"}, 2},
+		{[]string{"HTTPS", "C0003"}, 3},
+		{[]string{"BIKE-C"}, 3},
+		{[]string{"BS0002"}, 2},
+	}
+
+	for _, tt := range tests {
+		got := matchQRDock(docks, tt.tokens)
+		var num int
+		if got != nil {
+			num = got.Number
+		}
+		if num != tt.want {
+			t.Errorf("matchQRDock(%q) = dock %d, want %d", tt.tokens, num, tt.want)
+		}
+	}
+}
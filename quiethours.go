@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// quietHoursOptions are presets for quiet hours setting, encoded as start*100+end hours, 0 is off.
+var quietHoursOptions = []int{0, 2208, 2307, 9}
+
+const quietHoursFlushInterval = 5 * time.Minute
+
+func formatQuietHours(v int) string {
+	if v == 0 {
+		return "Off"
+	}
+	return fmt.Sprintf("%02d–%02d", v/100, v%100)
+}
+
+// inQuietHours returns whether non-critical notifications should be held back at time t.
+func (s UserSettings) inQuietHours(t time.Time) bool {
+	start, end := s.QuietHours/100, s.QuietHours%100
+	if start == end {
+		return false
+	}
+
+	h := t.In(lisbonTZ).Hour()
+	if start < end {
+		return h >= start && h < end
+	}
+	// overnight, e.g. 22-08
+	return h >= start || h < end
+}
+
+// QueuedNotification is a notification held back during user's quiet hours.
+type QueuedNotification struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID    int64 `gorm:"index"`
+	Text      string
+	ParseMode tele.ParseMode
+	// Markup is JSON-encoded inline keyboard, if any
+	Markup string
+	// ExpiresAt is the time after which notification is not relevant anymore and is dropped, zero means never
+	ExpiresAt time.Time
+}
+
+// notification is a non-critical message to user, which respects quiet hours.
+type notification struct {
+	Text      string
+	ParseMode tele.ParseMode
+	Markup    *tele.ReplyMarkup
+	ExpiresAt time.Time
+}
+
+// sendNotification sends non-critical notification to user, or queues it until quiet hours end.
+// All reminders and alerts should go through it.
+func (s *server) sendNotification(u *User, n notification) error {
+	if !u.Settings.inQuietHours(time.Now()) {
+		return s.deliverNotification(u.ID, n)
+	}
+
+	q := QueuedNotification{
+		UserID:    u.ID,
+		Text:      n.Text,
+		ParseMode: n.ParseMode,
+		ExpiresAt: n.ExpiresAt,
+	}
+	if n.Markup != nil {
+		markup, err := json.Marshal(n.Markup)
+		if err != nil {
+			return err
+		}
+		q.Markup = string(markup)
+	}
+
+	log.Printf("[uid:%d] queued notification during quiet hours", u.ID)
+	return s.db.Create(&q).Error
+}
+
+func (s *server) deliverNotification(uid int64, n notification) error {
+	opts := &tele.SendOptions{ParseMode: n.ParseMode}
+	if n.Markup != nil {
+		opts.ReplyMarkup = n.Markup
+	}
+	_, err := s.bot.Send(tele.ChatID(uid), n.Text, opts)
+	return err
+}
+
+// quietHoursFlusher delivers queued notifications after quiet hours end.
+func (s *server) quietHoursFlusher() {
+	for {
+		time.Sleep(quietHoursFlushInterval)
+
+		if err := s.flushQueuedNotifications(); err != nil {
+			log.Println("quiet hours flusher error:", err)
+		}
+	}
+}
+
+func (s *server) flushQueuedNotifications() error {
+	var queued []QueuedNotification
+	if err := s.db.Order("id").Find(&queued).Error; err != nil {
+		return err
+	}
+
+	users := map[int64]*User{}
+	for _, q := range queued {
+		u, ok := users[q.UserID]
+		if !ok {
+			u = &User{}
+			if err := s.db.First(u, q.UserID).Error; err != nil {
+				// user was deleted, or some db error, in any case drop the notification
+				log.Printf("[uid:%d] dropping queued notification: %v", q.UserID, err)
+				u = nil
+			}
+			users[q.UserID] = u
+		}
+
+		if u != nil && u.Settings.inQuietHours(time.Now()) {
+			continue
+		}
+
+		if u != nil && (q.ExpiresAt.IsZero() || time.Now().Before(q.ExpiresAt)) {
+			n := notification{
+				Text:      q.Text,
+				ParseMode: q.ParseMode,
+			}
+			if q.Markup != "" {
+				n.Markup = &tele.ReplyMarkup{}
+				if err := json.Unmarshal([]byte(q.Markup), n.Markup); err != nil {
+					log.Printf("[uid:%d] ignored queued markup error: %v", q.UserID, err)
+					n.Markup = nil
+				}
+			}
+			if err := s.deliverNotification(q.UserID, n); err != nil {
+				log.Printf("[uid:%d] ignored queued notification delivery error: %v", q.UserID, err)
+			}
+		}
+
+		if err := s.db.Delete(&q).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
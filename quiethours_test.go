@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 7, 1, hour, min, 0, 0, lisbonTZ)
+	}
+
+	tests := []struct {
+		quietHours int
+		t          time.Time
+		want       bool
+	}{
+		{0, at(3, 0), false},
+		{0, at(12, 0), false},
+		// overnight 22-08
+		{2208, at(21, 59), false},
+		{2208, at(22, 0), true},
+		{2208, at(23, 30), true},
+		{2208, at(0, 0), true},
+		{2208, at(7, 59), true},
+		{2208, at(8, 0), false},
+		{2208, at(15, 0), false},
+		// after midnight 00-09
+		{9, at(23, 59), false},
+		{9, at(0, 0), true},
+		{9, at(8, 59), true},
+		{9, at(9, 0), false},
+		// Lisbon time is used, not the time zone of t
+		{2208, time.Date(2024, 7, 1, 21, 30, 0, 0, time.UTC), true},
+		{2208, time.Date(2024, 1, 1, 21, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		s := UserSettings{QuietHours: tt.quietHours}
+		if got := s.inQuietHours(tt.t); got != tt.want {
+			t.Errorf("inQuietHours(%v) with %s = %v, want %v", tt.t, formatQuietHours(tt.quietHours), got, tt.want)
+		}
+	}
+}
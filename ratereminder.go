@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	rateReminderDelay = flag.Duration("rate-reminder-delay", 3*time.Hour, "remind about unrated trip after this time, 0 to disable")
+	rateExpireDelay   = flag.Duration("rate-expire-delay", 24*time.Hour, "expire pending trip rating after this time, 0 to disable")
+)
+
+const rateReminderCheckInterval = 10 * time.Minute
+
+// rateReminder periodically reminds users about pending ratings and expires old ones,
+// so that the bot doesn't stay stuck waiting for rating forever.
+func (s *server) rateReminder() {
+	for {
+		time.Sleep(rateReminderCheckInterval)
+
+		var users []User
+		if err := s.db.Where("current_trip_rate_awaiting = ?", true).Find(&users).Error; err != nil {
+			log.Println("rate reminder: error getting users:", err)
+			continue
+		}
+
+		for i := range users {
+			u := &users[i]
+			if u.CurrentTripMessageID != "" {
+				// a new trip has started, trip code is the active one now, and rating will be requested again
+				// after it ends, so neither reminding nor expiring must touch the trip state
+				continue
+			}
+			if u.RateRequestedAt.IsZero() {
+				// rating was requested before reminders were introduced, start counting now
+				u.RateRequestedAt = time.Now()
+				if err := s.db.Model(u).Update("RateRequestedAt", u.RateRequestedAt).Error; err != nil {
+					log.Printf("[uid:%d] rate reminder: error saving: %v", u.ID, err)
+				}
+				continue
+			}
+
+			var err error
+			switch pendingRateAction(u, time.Now(), *rateReminderDelay, *rateExpireDelay) {
+			case rateActionExpire:
+				err = s.expireRating(u)
+			case rateActionRemind:
+				err = s.remindRating(u)
+			}
+			if err != nil {
+				log.Printf("[uid:%d] rate reminder error: %v", u.ID, err)
+			}
+		}
+	}
+}
+
+type rateAction int
+
+const (
+	rateActionNone rateAction = iota
+	rateActionRemind
+	rateActionExpire
+)
+
+// pendingRateAction returns what to do with pending rating of u at now. Reminder is postponed during
+// quiet hours, and expiry is counted from the reminder, so that the rating doesn't expire before user
+// was reminded about it. With default delays, rating expires a day after the request, if reminder wasn't postponed.
+func pendingRateAction(u *User, now time.Time, remindDelay, expireDelay time.Duration) rateAction {
+	if remindDelay <= 0 {
+		if expireDelay > 0 && now.Sub(u.RateRequestedAt) > expireDelay {
+			return rateActionExpire
+		}
+		return rateActionNone
+	}
+
+	if !u.RateReminderSent {
+		// reminder is re-sent as the rate message itself, so it's postponed rather than queued
+		if now.Sub(u.RateRequestedAt) > remindDelay && !u.Settings.inQuietHours(now) {
+			return rateActionRemind
+		}
+		return rateActionNone
+	}
+
+	remindedAt := u.RateRemindedAt
+	if remindedAt.IsZero() {
+		// reminded before the time was recorded
+		remindedAt = u.RateRequestedAt.Add(remindDelay)
+	}
+	if expireDelay > 0 && now.Sub(remindedAt) > max(expireDelay-remindDelay, 0) {
+		return rateActionExpire
+	}
+	return rateActionNone
+}
+
+// remindRating re-sends rate message, so that it's at the bottom of the chat.
+func (s *server) remindRating(u *User) error {
+	log.Printf("[uid:%d] reminding about pending rating", u.ID)
+
+	m, err := s.bot.Send(
+		tele.ChatID(u.ID),
+		"👋 Gentle reminder, you haven't rated your last trip yet.\n"+messageRateTrip,
+		getStarButtons(u.CurrentTripRating.Rating),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.bot.Delete(tele.StoredMessage{ChatID: u.ID, MessageID: u.RateMessageID}); err != nil {
+		log.Printf("[uid:%d] ignored delete old rate message error: %v", u.ID, err)
+	}
+
+	// conditional, so that rating which was submitted meanwhile is not reopened
+	return s.db.Model(u).
+		Where("current_trip_rate_awaiting = ? AND rate_message_id = ?", true, u.RateMessageID).
+		Updates(map[string]any{
+			"RateMessageID":    strconv.Itoa(m.ID),
+			"RateReminderSent": true,
+			"RateRemindedAt":   time.Now(),
+		}).Error
+}
+
+// expireRating clears pending rating state. The trip can still be rated via /unrated.
+func (s *server) expireRating(u *User) error {
+	log.Printf("[uid:%d] expiring pending rating for %s", u.ID, u.CurrentTripCode)
+
+	if _, err := s.bot.Edit(
+		tele.StoredMessage{ChatID: u.ID, MessageID: u.RateMessageID},
+		"⌛️ Rating request expired. You can still rate the trip via /unrated.",
+		&tele.ReplyMarkup{},
+	); err != nil {
+		log.Printf("[uid:%d] ignored edit rate message error: %v", u.ID, err)
+	}
+
+	updates := map[string]any{
+		"CurrentTripCode":         "",
+		"CurrentTripRating":       "{}",
+		"CurrentTripRateAwaiting": false,
+		"RateMessageID":           "",
+	}
+	if u.State == UserStateWaitingForRateComment {
+		updates["State"] = UserStateLoggedIn
+	}
+	// conditional, so that trip state changed meanwhile, e.g. rating submitted or new trip, is not cleared
+	return s.db.Model(u).
+		Where("current_trip_rate_awaiting = ? AND rate_message_id = ? AND current_trip_message_id = ?", true, u.RateMessageID, "").
+		Updates(updates).Error
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingRateAction(t *testing.T) {
+	const remind, expire = 3 * time.Hour, 24 * time.Hour
+	// trip ended at 21:00, user has quiet hours 22-08
+	requested := time.Date(2024, 7, 1, 21, 0, 0, 0, lisbonTZ)
+	at := func(d time.Duration) time.Time { return requested.Add(d) }
+
+	u := &User{RateRequestedAt: requested, Settings: UserSettings{QuietHours: 2208}}
+	for _, tt := range []struct {
+		now  time.Time
+		want rateAction
+	}{
+		{at(time.Hour), rateActionNone},
+		// reminder is due at midnight, but it's postponed until 08:00
+		{at(3*time.Hour + time.Minute), rateActionNone},
+		{at(10*time.Hour + 59*time.Minute), rateActionNone},
+		{at(11 * time.Hour), rateActionRemind},
+	} {
+		if got := pendingRateAction(u, tt.now, remind, expire); got != tt.want {
+			t.Errorf("before reminder at %v: got %v, want %v", tt.now, got, tt.want)
+		}
+	}
+
+	// even if reminder is postponed for long, rating doesn't expire before it's sent
+	if got := pendingRateAction(u, at(25*time.Hour), remind, expire); got != rateActionNone {
+		t.Errorf("unreminded at 25h: got %v, want %v", got, rateActionNone)
+	}
+
+	// expiry is counted from the reminder
+	u.RateReminderSent = true
+	u.RateRemindedAt = at(11 * time.Hour)
+	if got := pendingRateAction(u, at(25*time.Hour), remind, expire); got != rateActionNone {
+		t.Errorf("reminded at 11h, at 25h: got %v, want %v", got, rateActionNone)
+	}
+	if got := pendingRateAction(u, at(32*time.Hour+time.Minute), remind, expire); got != rateActionExpire {
+		t.Errorf("reminded at 11h, at 32h: got %v, want %v", got, rateActionExpire)
+	}
+
+	// without reminders, expiry is counted from the request
+	u.RateReminderSent = false
+	if got := pendingRateAction(u, at(25*time.Hour), 0, expire); got != rateActionExpire {
+		t.Errorf("no reminders at 25h: got %v, want %v", got, rateActionExpire)
+	}
+}
+
+func TestSaveUserKeepsBackgroundChanges(t *testing.T) {
+	s := newTestServer(t, 1)
+
+	handlerUser := loadTestUser(t, s, 1)
+	handlerOrig := loadTestUser(t, s, 1)
+
+	// rate reminder re-sent the message while handler was running
+	if err := s.db.Model(&User{ID: 1}).Updates(map[string]any{"RateMessageID": "42", "RateReminderSent": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	handlerUser.Settings.QuietHours = 2208
+	if err := s.saveUser(&handlerUser, &handlerOrig); err != nil {
+		t.Fatal(err)
+	}
+
+	u := loadTestUser(t, s, 1)
+	if u.RateMessageID != "42" || !u.RateReminderSent {
+		t.Errorf("reminder changes were overwritten: RateMessageID = %q, RateReminderSent = %v", u.RateMessageID, u.RateReminderSent)
+	}
+	if u.Settings.QuietHours != 2208 {
+		t.Errorf("QuietHours = %d, handler changes were not saved", u.Settings.QuietHours)
+	}
+}
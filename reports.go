@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+var bikeProblemCategories = []string{
+	"🛑 Brakes",
+	"💺 Seat",
+	"⛓ Chain/gears",
+	"🔋 Battery/motor",
+	"🛞 Tires",
+	"❓ Other",
+}
+
+// handleReportBike starts bike problem report from the bike menu.
+func (c *customContext) handleReportBike() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	bike, err := gira.BikeFromCallbackData(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	c.user.ReportBikeSerial = bike.Serial
+	c.user.ReportBikeName = bike.Name
+	c.user.ReportTripCode = ""
+
+	return c.sendReportCategories()
+}
+
+// handleReportTrip starts bike problem report from the trip summary.
+// Callback data is "tripCode|bikeName".
+func (c *customContext) handleReportTrip() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	code, bikeName, _ := strings.Cut(cb.Data, "|")
+
+	c.user.ReportBikeSerial = ""
+	c.user.ReportBikeName = bikeName
+	c.user.ReportTripCode = gira.TripCode(code)
+
+	return c.sendReportCategories()
+}
+
+func (c *customContext) sendReportCategories() error {
+	var btns []tele.Btn
+	for i, cat := range bikeProblemCategories {
+		btns = append(btns, tele.Btn{
+			Unique: btnKeyTypeReportCategory,
+			Text:   cat,
+			Data:   fmt.Sprint(i),
+		})
+	}
+
+	rm := &tele.ReplyMarkup{}
+	rows := rm.Split(2, btns)
+	rows = append(rows, tele.Row{{
+		Unique: btnKeyTypeCloseMenu,
+		Text:   "❌ Cancel",
+	}})
+	rm.Inline(rows...)
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	return c.Send(fmt.Sprintf("🛠 What's wrong with bike %s?", c.user.ReportBikeName), rm)
+}
+
+func (c *customContext) handleReportCategory() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	var idx int
+	if _, err := fmt.Sscan(cb.Data, &idx); err != nil || idx < 0 || idx >= len(bikeProblemCategories) {
+		return fmt.Errorf("invalid report category: %s", cb.Data)
+	}
+
+	c.user.ReportCategory = bikeProblemCategories[idx]
+	c.user.State = UserStateWaitingForBikeReport
+
+	return c.Edit(fmt.Sprintf(
+		"🛠 Bike %s: %s\nPlease describe the problem in one message.",
+		c.user.ReportBikeName,
+		c.user.ReportCategory,
+	), getReportCancelMarkup())
+}
+
+func getReportCancelMarkup() *tele.ReplyMarkup {
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(tele.Row{{
+		Unique: btnKeyTypeReportCancel,
+		Text:   "❌ Cancel",
+	}})
+	return rm
+}
+
+// handleReportCancel cancels report that is waiting for description.
+func (c *customContext) handleReportCancel() error {
+	if c.user.State == UserStateWaitingForBikeReport {
+		c.user.State = UserStateLoggedIn
+		c.user.ReportBikeSerial = ""
+		c.user.ReportBikeName = ""
+		c.user.ReportTripCode = ""
+		c.user.ReportCategory = ""
+	}
+	if c.user.State == UserStateWaitingForStationReport {
+		c.user.State = UserStateLoggedIn
+		c.user.ReportStationSerial = ""
+	}
+	return c.Delete()
+}
+
+// submitBikeReport is called with the report text. It forwards the report to admin,
+// and if it's about the trip that is being rated, also adds it to the rating comment.
+func (c *customContext) submitBikeReport(text string) error {
+	c.user.State = UserStateLoggedIn
+
+	report := fmt.Sprintf(
+		"bike report from %d (@%s)\nbike: %s (serial %s)\ntrip: %s\ncategory: %s\n\n%s",
+		c.user.ID,
+		c.user.TGUsername,
+		c.user.ReportBikeName,
+		c.user.ReportBikeSerial,
+		c.user.ReportTripCode,
+		c.user.ReportCategory,
+		text,
+	)
+	log.Printf("[uid:%d] %s", c.user.ID, report)
+
+	if _, err := c.Bot().Send(tele.ChatID(*adminID), report); err != nil {
+		return err
+	}
+
+	reply := "Thanks for the report! 🛠"
+	if c.user.ReportTripCode != "" && c.user.ReportTripCode == c.user.CurrentTripCode && c.user.CurrentTripRateAwaiting {
+		comment := fmt.Sprintf("[%s] %s", c.user.ReportCategory, text)
+		if c.user.CurrentTripRating.Comment != "" {
+			comment = c.user.CurrentTripRating.Comment + "\n" + comment
+		}
+		c.user.CurrentTripRating.Comment = comment
+		reply += "\nIt was also added to the trip rating comment, don't forget to submit the rating."
+	}
+
+	c.user.ReportBikeSerial = ""
+	c.user.ReportBikeName = ""
+	c.user.ReportTripCode = ""
+	c.user.ReportCategory = ""
+
+	return c.Send(reply)
+}
+
+// StationReport is a user report about broken dock or station.
+// They are stored to track recurring issues and forward them to EMEL.
+type StationReport struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID        int64
+	StationSerial gira.StationSerial `gorm:"index"`
+	// DockNumber is 0 for station-wide issues
+	DockNumber  int
+	Description string
+}
+
+func (c *customContext) handleReportStation() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	c.user.ReportStationSerial = gira.StationSerial(cb.Data)
+	c.user.State = UserStateWaitingForStationReport
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	return c.Send(
+		"⚠️ Please describe the issue in one message.\n"+
+			"If it's about a specific dock, start with its number, e.g. `12 doesn't lock the bike`.",
+		tele.ModeMarkdown,
+		getReportCancelMarkup(),
+	)
+}
+
+// submitStationReport parses and saves the station report, and notifies admin.
+func (c *customContext) submitStationReport(text string) error {
+	c.user.State = UserStateLoggedIn
+
+	report := StationReport{
+		UserID:        c.user.ID,
+		StationSerial: c.user.ReportStationSerial,
+		Description:   text,
+	}
+	c.user.ReportStationSerial = ""
+
+	// optional leading dock number
+	if numStr, rest, ok := strings.Cut(text, " "); ok {
+		if num, err := strconv.Atoi(strings.TrimPrefix(numStr, "#")); err == nil && num > 0 && num < 1000 {
+			report.DockNumber = num
+			report.Description = strings.TrimSpace(rest)
+		}
+	}
+
+	if err := c.s.db.Create(&report).Error; err != nil {
+		return err
+	}
+
+	var prevReports int64
+	if err := c.s.db.Model(&StationReport{}).
+		Where("station_serial = ? AND dock_number = ? AND id != ?", report.StationSerial, report.DockNumber, report.ID).
+		Count(&prevReports).Error; err != nil {
+		return err
+	}
+
+	stationName := string(report.StationSerial)
+	if station, err := c.gira.GetStationCached(c, report.StationSerial); err == nil {
+		stationName = station.MapTitle()
+	}
+
+	dock := "station-wide"
+	if report.DockNumber != 0 {
+		dock = fmt.Sprintf("dock %d", report.DockNumber)
+	}
+
+	adminMsg := fmt.Sprintf(
+		"station report #%d from %d (@%s)\nstation: %s (serial %s)\n%s, previous reports: %d\n\n%s",
+		report.ID,
+		c.user.ID,
+		c.user.TGUsername,
+		stationName,
+		report.StationSerial,
+		dock,
+		prevReports,
+		report.Description,
+	)
+	log.Printf("[uid:%d] %s", c.user.ID, adminMsg)
+
+	if _, err := c.Bot().Send(tele.ChatID(*adminID), adminMsg); err != nil {
+		return err
+	}
+
+	return c.Send("Thanks for the report! ⚠️ I'll pass it on.")
+}
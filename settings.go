@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// UserSettings are user preferences changeable via /settings.
+// Zero values mean defaults, so existing users don't need migration.
+type UserSettings struct {
+	// NearbyMaxResults is how many nearby stations to show.
+	NearbyMaxResults int
+	// NearbyMaxRadius is the maximum distance to nearby stations in meters, 0 means unlimited.
+	NearbyMaxRadius int
+	// StreakReminder enables evening reminder to keep the riding streak, see streaks.go.
+	StreakReminder bool
+	// QuietHours are hours when reminders are held back, see quiethours.go.
+	QuietHours int
+	// CommuteTime is the time of commute report in minutes after midnight, 0 is off, see commute.go.
+	CommuteTime int
+	// CommuteWeekends enables commute report on weekends too.
+	CommuteWeekends bool
+}
+
+// nearbyMaxResultsLimit is the maximum number of nearby stations user can request.
+const nearbyMaxResultsLimit = 10
+
+var (
+	nearbyMaxResultsOptions = []int{3, 5, 8, nearbyMaxResultsLimit}
+	nearbyMaxRadiusOptions  = []int{0, 500, 1000, 2000}
+)
+
+const (
+	settingNearbyMaxResults = "nearby_results"
+	settingNearbyMaxRadius  = "nearby_radius"
+	settingStreakReminder   = "streak_reminder"
+	settingQuietHours       = "quiet_hours"
+)
+
+func (s UserSettings) nearbyMaxResults() int {
+	if s.NearbyMaxResults <= 0 {
+		return stationMaxResults
+	}
+	return min(s.NearbyMaxResults, nearbyMaxResultsLimit)
+}
+
+func formatRadius(meters int) string {
+	switch {
+	case meters == 0:
+		return "Any"
+	case meters < 1000:
+		return fmt.Sprintf("%dm", meters)
+	default:
+		return strconv.FormatFloat(float64(meters)/1000, 'f', -1, 64) + "km"
+	}
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func (c *customContext) handleSettings() error {
+	text, rm := c.getSettingsMessage()
+	return c.Send(text, rm)
+}
+
+func (c *customContext) getSettingsMessage() (string, *tele.ReplyMarkup) {
+	settings := c.user.Settings
+
+	optionsRow := func(key string, options []int, current int, format func(int) string) tele.Row {
+		var row tele.Row
+		for _, o := range options {
+			text := format(o)
+			if o == current {
+				text = "• " + text + " •"
+			}
+			row = append(row, tele.Btn{
+				Unique: btnKeyTypeSetting,
+				Text:   text,
+				Data:   fmt.Sprintf("%s|%d", key, o),
+			})
+		}
+		return row
+	}
+
+	toggleRow := func(key, text string, current bool) tele.Row {
+		value := 1
+		if current {
+			value = 0
+		}
+		return tele.Row{{
+			Unique: btnKeyTypeSetting,
+			Text:   fmt.Sprintf("%s: %s", text, onOff(current)),
+			Data:   fmt.Sprintf("%s|%d", key, value),
+		}}
+	}
+
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(
+		optionsRow(settingNearbyMaxResults, nearbyMaxResultsOptions, settings.nearbyMaxResults(), strconv.Itoa),
+		optionsRow(settingNearbyMaxRadius, nearbyMaxRadiusOptions, settings.NearbyMaxRadius, formatRadius),
+		toggleRow(settingStreakReminder, "🔥 Streak reminder", settings.StreakReminder),
+		optionsRow(settingQuietHours, quietHoursOptions, settings.QuietHours, formatQuietHours),
+		tele.Row{{Unique: btnKeyTypeCloseMenuKeepReply, Text: "Close"}},
+	)
+
+	text := fmt.Sprintf(
+		"⚙️ Settings\n\n"+
+			"📍 Nearby stations shown: %d\n"+
+			"📏 Max distance to nearby stations: %s\n"+
+			"🔥 Evening reminder to keep riding streak: %s\n"+
+			"🌙 Quiet hours for reminders: %s",
+		settings.nearbyMaxResults(),
+		formatRadius(settings.NearbyMaxRadius),
+		onOff(settings.StreakReminder),
+		formatQuietHours(settings.QuietHours),
+	)
+	return text, rm
+}
+
+func (c *customContext) handleSetting() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	key, valueStr, _ := strings.Cut(cb.Data, "|")
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case settingNearbyMaxResults:
+		if value <= 0 || value > nearbyMaxResultsLimit {
+			return fmt.Errorf("invalid nearby results count: %d", value)
+		}
+		c.user.Settings.NearbyMaxResults = value
+	case settingNearbyMaxRadius:
+		if value < 0 {
+			return fmt.Errorf("invalid nearby radius: %d", value)
+		}
+		c.user.Settings.NearbyMaxRadius = value
+	case settingStreakReminder:
+		c.user.Settings.StreakReminder = value == 1
+	case settingQuietHours:
+		if !slices.Contains(quietHoursOptions, value) {
+			return fmt.Errorf("invalid quiet hours: %d", value)
+		}
+		c.user.Settings.QuietHours = value
+	default:
+		return fmt.Errorf("unknown setting: %q", key)
+	}
+
+	if err := c.Respond(&tele.CallbackResponse{Text: "Saved"}); err != nil {
+		return err
+	}
+
+	text, rm := c.getSettingsMessage()
+	err = c.Edit(text, rm)
+	if errors.Is(err, tele.ErrSameMessageContent) {
+		return nil
+	}
+	return err
+}
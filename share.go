@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// stationDeepLinkPrefix is a /start payload prefix which opens the station view, see handleStart.
+const stationDeepLinkPrefix = "station_"
+
+// stationDeepLink returns t.me link which opens the station in the bot.
+func (c *customContext) stationDeepLink(serial gira.StationSerial) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", c.Bot().Me.Username, stationDeepLinkPrefix, serial)
+}
+
+// handleStartPayload handles /start deep links, it returns false if payload is not recognized.
+func (c *customContext) handleStartPayload(payload string) (bool, error) {
+	serial, ok := strings.CutPrefix(payload, stationDeepLinkPrefix)
+	if !ok || serial == "" {
+		return false, nil
+	}
+	return true, c.handleStationInner(gira.StationSerial(serial))
+}
+
+// handleShareStation sends a station card with current availability, which can be forwarded to other chats.
+func (c *customContext) handleShareStation() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+	serial := gira.StationSerial(cb.Data)
+
+	station, err := c.gira.GetStationCached(c, serial)
+	if err != nil {
+		return err
+	}
+	docks, err := c.gira.GetStationDocks(c, serial)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Respond(); err != nil {
+		return err
+	}
+	return c.Send(fmt.Sprintf(
+		"🅿️ %s\n"+
+			"⚡️ %d e-bikes, ⚙️ %d bikes, 🆓 %d docks (as of %s)\n\n"+
+			"Open in BetterGiraBot: %s",
+		station.MapTitle(),
+		docks.ElectricBikesAvailable(),
+		docks.ConventionalBikesAvailable(),
+		docks.Free(),
+		time.Now().In(lisbonTZ).Format("15:04"),
+		c.stationDeepLink(serial),
+	))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// CachedStation is a persisted entry of the shared station cache, so that station lookups
+// work right after restart, even if Gira is down.
+type CachedStation struct {
+	Serial gira.StationSerial `gorm:"primarykey"`
+	Code   gira.StationCode
+	Status gira.AssetStatus
+
+	Type        string
+	Name        string
+	Description string
+
+	Latitude  float64
+	Longitude float64
+
+	Docks int
+	Bikes int
+
+	FetchedAt time.Time
+}
+
+// loadStationCache restores the shared station cache from DB and makes it persist fresh station lists.
+func (s *server) loadStationCache() error {
+	var cached []CachedStation
+	if err := s.db.Find(&cached).Error; err != nil {
+		return err
+	}
+
+	if len(cached) > 0 {
+		stations := make([]gira.Station, len(cached))
+		for i, cs := range cached {
+			stations[i] = gira.Station{
+				Code:        cs.Code,
+				Serial:      cs.Serial,
+				Status:      cs.Status,
+				Type:        cs.Type,
+				Name:        cs.Name,
+				Description: cs.Description,
+				Latitude:    cs.Latitude,
+				Longitude:   cs.Longitude,
+				Docks:       cs.Docks,
+				Bikes:       cs.Bikes,
+			}
+		}
+		s.stationCache.Restore(stations, cached[0].FetchedAt)
+		log.Printf("bot: restored %d stations fetched at %v", len(stations), cached[0].FetchedAt)
+	}
+
+	s.stationCache.OnUpdate(func(stations []gira.Station, fetchedAt time.Time) {
+		// called on request path, don't block it
+		go func() {
+			if err := s.saveStationCache(stations, fetchedAt); err != nil {
+				log.Println("bot: ignored station cache save error:", err)
+			}
+		}()
+	})
+	return nil
+}
+
+// saveStationCache replaces persisted stations with the fresh list.
+func (s *server) saveStationCache(stations []gira.Station, fetchedAt time.Time) error {
+	if len(stations) == 0 {
+		return nil
+	}
+
+	cached := make([]CachedStation, len(stations))
+	for i, st := range stations {
+		cached[i] = CachedStation{
+			Serial:      st.Serial,
+			Code:        st.Code,
+			Status:      st.Status,
+			Type:        st.Type,
+			Name:        st.Name,
+			Description: st.Description,
+			Latitude:    st.Latitude,
+			Longitude:   st.Longitude,
+			Docks:       st.Docks,
+			Bikes:       st.Bikes,
+			FetchedAt:   fetchedAt,
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&CachedStation{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(cached, 100).Error
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+// Very rough estimates, they are here for fun, not for science.
+const (
+	// co2GramsPerKm is average CO2 emission of a passenger car, which the trip presumably replaced.
+	co2GramsPerKm = 120
+	// caloriesPerKm are burned by average person riding a conventional bike at a leisure pace.
+	caloriesPerKm = 30
+	// caloriesPerKmElectric is lower, as the motor does part of the work.
+	caloriesPerKmElectric = 15
+)
+
+type ecoStats struct {
+	DistanceKm float64
+	CO2Grams   float64
+	Calories   float64
+}
+
+// estimateEcoStats estimates CO2 saved and calories burned for the trip.
+// Gira reports trip distance in meters.
+func estimateEcoStats(distance float64, bikeName string) ecoStats {
+	km := distance / 1000
+	cal := caloriesPerKm
+	if strings.HasPrefix(bikeName, "E") {
+		cal = caloriesPerKmElectric
+	}
+	return ecoStats{
+		DistanceKm: km,
+		CO2Grams:   km * co2GramsPerKm,
+		Calories:   km * float64(cal),
+	}
+}
+
+func (e ecoStats) String() string {
+	return fmt.Sprintf("🌱 CO₂ saved: ~%.0fg, 🔥 calories: ~%.0f kcal", e.CO2Grams, e.Calories)
+}
+
+// recordTripEcoStats adds finished trip estimates to user totals and returns a summary line for the trip message.
+func (c *customContext) recordTripEcoStats(trip gira.Trip, bikeName string) (string, error) {
+	if trip.Distance <= 0 {
+		return "", nil
+	}
+
+	stats := estimateEcoStats(trip.Distance, bikeName)
+
+	// called outside of handler (from watchActiveTrip), so totals are incremented in place,
+	// they are not overwritten by handlers, see userBackgroundFields
+	if err := c.s.db.Model(c.user).UpdateColumns(map[string]any{
+		"total_distance":  gorm.Expr("total_distance + ?", stats.DistanceKm),
+		"total_co2_saved": gorm.Expr("total_co2_saved + ?", stats.CO2Grams),
+		"total_calories":  gorm.Expr("total_calories + ?", stats.Calories),
+	}).Error; err != nil {
+		return "", err
+	}
+	c.user.TotalDistance += stats.DistanceKm
+	c.user.TotalCO2Saved += stats.CO2Grams
+	c.user.TotalCalories += stats.Calories
+
+	return fmt.Sprintf("📏 Distance: %.1fkm\n%s\n", stats.DistanceKm, stats), nil
+}
+
+func (c *customContext) handleStats() error {
+	if c.user.FinishedTrips == 0 {
+		return c.Send("No finished trips yet, go ride a bike! 🚲")
+	}
+
+	return c.Send(fmt.Sprintf(
+		"Your stats with BetterGiraBot:\n"+
+			"🚲 Trips: %d\n"+
+			"📏 Distance: %.1fkm\n"+
+			"🌱 CO₂ saved: ~%.1fkg\n"+
+			"🔥 Calories burned: ~%.0f kcal\n"+
+			"%s"+
+			"%s\n"+
+			"_Estimates are very rough, and only include trips with known distance._",
+		c.user.FinishedTrips,
+		c.user.TotalDistance,
+		c.user.TotalCO2Saved/1000,
+		c.user.TotalCalories,
+		c.getStreakSummary(),
+		c.getBadgesSummary(),
+	), tele.ModeMarkdown)
+}
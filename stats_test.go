@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+func TestRecordTripEcoStats(t *testing.T) {
+	s := newTestServer(t, 1)
+
+	// handler loaded the user before the trip finished, and saves it after
+	handlerUser := loadTestUser(t, s, 1)
+	handlerOrig := handlerUser
+
+	watcherUser := loadTestUser(t, s, 1)
+	c := &customContext{ctx: context.Background(), s: s, user: &watcherUser}
+	// Gira reports distance in meters, totals and messages are in kilometers
+	for _, tt := range []struct {
+		distance float64
+		want     string
+	}{
+		{2500, "Distance: 2.5km"},
+		{1500, "Distance: 1.5km"},
+	} {
+		line, err := c.recordTripEcoStats(gira.Trip{Distance: tt.distance}, "E0001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(line, tt.want) {
+			t.Errorf("trip line %q doesn't contain %q", line, tt.want)
+		}
+	}
+
+	handlerUser.TGName = "Renamed"
+	if err := s.saveUser(&handlerUser, &handlerOrig); err != nil {
+		t.Fatal(err)
+	}
+
+	u := loadTestUser(t, s, 1)
+	if math.Abs(u.TotalDistance-4) > 1e-9 {
+		t.Errorf("TotalDistance = %v km, want 4", u.TotalDistance)
+	}
+	if math.Abs(u.TotalCO2Saved-4*co2GramsPerKm) > 1e-9 || math.Abs(u.TotalCalories-4*caloriesPerKmElectric) > 1e-9 {
+		t.Errorf("TotalCO2Saved = %v, TotalCalories = %v, want totals of 4km", u.TotalCO2Saved, u.TotalCalories)
+	}
+	if u.TGName != "Renamed" {
+		t.Errorf("TGName = %q, handler changes were not saved", u.TGName)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RideDay is a day when user finished at least one trip, used for streaks.
+type RideDay struct {
+	UserID int64 `gorm:"primaryKey;autoIncrement:false"`
+	// Day is a date in Lisbon timezone, formatted as rideDayLayout
+	Day   string `gorm:"primaryKey"`
+	Trips int
+}
+
+const (
+	rideDayLayout = "2006-01-02"
+	// streakReminderHour is the hour in Lisbon when users are reminded to keep their streak.
+	streakReminderHour = 20
+	// streakReminderMinStreak is the minimum streak for reminder to be sent, no point in keeping 1-day streaks.
+	streakReminderMinStreak = 2
+)
+
+func rideDay(t time.Time) string {
+	return t.In(lisbonTZ).Format(rideDayLayout)
+}
+
+// computeStreaks returns current and longest streaks of consecutive days.
+// days should be sorted ascending. Current streak is not broken if the last ride was yesterday,
+// as the user still has time to ride today.
+func computeStreaks(days []string, today string) (current, longest int) {
+	var (
+		run  int
+		prev time.Time
+	)
+	for _, d := range days {
+		t, err := time.Parse(rideDayLayout, d)
+		if err != nil {
+			continue
+		}
+		if !prev.IsZero() && t.Sub(prev) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+		prev = t
+	}
+
+	todayT, err := time.Parse(rideDayLayout, today)
+	if err != nil || prev.IsZero() {
+		return 0, longest
+	}
+	if diff := todayT.Sub(prev); diff == 0 || diff == 24*time.Hour {
+		current = run
+	}
+	return current, longest
+}
+
+func (s *server) getStreaks(uid int64) (current, longest int, ridToday bool, err error) {
+	var days []string
+	if err := s.db.Model(&RideDay{}).Where("user_id = ?", uid).Order("day").Pluck("day", &days).Error; err != nil {
+		return 0, 0, false, err
+	}
+
+	today := rideDay(time.Now())
+	current, longest = computeStreaks(days, today)
+	ridToday = len(days) > 0 && days[len(days)-1] == today
+	return current, longest, ridToday, nil
+}
+
+// recordRideDay marks today as a ride day and returns a summary line with the streak for the trip message.
+func (c *customContext) recordRideDay() (string, error) {
+	if err := c.s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{"trips": gorm.Expr("trips + 1")}),
+	}).Create(&RideDay{
+		UserID: c.user.ID,
+		Day:    rideDay(time.Now()),
+		Trips:  1,
+	}).Error; err != nil {
+		return "", err
+	}
+
+	current, longest, _, err := c.s.getStreaks(c.user.ID)
+	if err != nil {
+		return "", err
+	}
+	if current < 2 {
+		// single day is not much of a streak
+		return "", nil
+	}
+	if current == longest {
+		return fmt.Sprintf("🔥 Streak: %d days in a row, your best!\n", current), nil
+	}
+	return fmt.Sprintf("🔥 Streak: %d days in a row\n", current), nil
+}
+
+// getStreakSummary returns streaks for /stats.
+func (c *customContext) getStreakSummary() string {
+	current, longest, _, err := c.s.getStreaks(c.user.ID)
+	if err != nil {
+		log.Printf("[uid:%d] ignored streaks error: %v", c.user.ID, err)
+		return ""
+	}
+	if longest == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🔥 Streak: %d days, longest %d days\n", current, longest)
+}
+
+// streakReminder reminds users with enabled setting to ride today, if they have a streak going.
+func (s *server) streakReminder() {
+	for {
+		now := time.Now().In(lisbonTZ)
+		next := time.Date(now.Year(), now.Month(), now.Day(), streakReminderHour, 0, 0, 0, lisbonTZ)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(time.Until(next))
+
+		if err := s.sendStreakReminders(); err != nil {
+			log.Println("streak reminder error:", err)
+		}
+	}
+}
+
+func (s *server) sendStreakReminders() error {
+	var users []User
+	if err := s.db.Where("setting_streak_reminder = ?", true).Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		current, _, ridToday, err := s.getStreaks(u.ID)
+		if err != nil {
+			return err
+		}
+		if ridToday || current < streakReminderMinStreak {
+			continue
+		}
+
+		now := time.Now().In(lisbonTZ)
+		if err := s.sendNotification(&u, notification{
+			Text: fmt.Sprintf(
+				"🔥 You have a %d-day riding streak, don't break it! There's still time for a ride today.\n"+
+					"_Turn off these reminders in /settings._",
+				current,
+			),
+			ParseMode: tele.ModeMarkdown,
+			// no point in reminding after the day is over
+			ExpiresAt: time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, lisbonTZ),
+		}); err != nil {
+			log.Printf("[uid:%d] ignored streak reminder error: %v", u.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestComputeStreaks(t *testing.T) {
+	tests := []struct {
+		days             []string
+		today            string
+		current, longest int
+	}{
+		{nil, "2024-03-10", 0, 0},
+		{[]string{"2024-03-10"}, "2024-03-10", 1, 1},
+		{[]string{"2024-03-09"}, "2024-03-10", 1, 1},
+		{[]string{"2024-03-08"}, "2024-03-10", 0, 1},
+		{[]string{"2024-03-07", "2024-03-08", "2024-03-09"}, "2024-03-10", 3, 3},
+		{[]string{"2024-03-01", "2024-03-02", "2024-03-03", "2024-03-09", "2024-03-10"}, "2024-03-10", 2, 3},
+		{[]string{"2024-03-01", "2024-03-02", "2024-03-05"}, "2024-03-10", 0, 2},
+		// across month end and DST change
+		{[]string{"2024-03-30", "2024-03-31", "2024-04-01"}, "2024-04-01", 3, 3},
+		{[]string{"2024-03-09", "bad", "2024-03-10"}, "2024-03-10", 2, 2},
+	}
+
+	for _, tt := range tests {
+		current, longest := computeStreaks(tt.days, tt.today)
+		if current != tt.current || longest != tt.longest {
+			t.Errorf("computeStreaks(%q, %s) = %d, %d, want %d, %d", tt.days, tt.today, current, longest, tt.current, tt.longest)
+		}
+	}
+}
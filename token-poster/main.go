@@ -0,0 +1,58 @@
+// token-poster reads harvested Firebase tokens from stdin, one per line, and posts them to the token
+// exchange server. It's an example of harvester package usage.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ilyaluk/girabot/harvester"
+)
+
+var (
+	tokenURL = flag.String("token-url", "http://localhost:8080", "token exchange server base url")
+	source   = flag.String("source", "", "label of token source, e.g. emulator farm name, up to 32 chars")
+)
+
+func main() {
+	flag.Parse()
+
+	c, err := harvester.NewClient(*tokenURL, *source)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var posted, duplicates, failed int
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() && ctx.Err() == nil {
+		token := strings.TrimSpace(sc.Text())
+		if token == "" {
+			continue
+		}
+
+		switch err := c.Post(ctx, token); {
+		case err == nil:
+			posted++
+		case errors.Is(err, harvester.ErrDuplicate):
+			duplicates++
+		default:
+			log.Printf("ignored post error: %v", err)
+			failed++
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("posted %d tokens, %d duplicates, %d failed", posted, duplicates, failed)
+}
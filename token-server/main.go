@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,9 +14,8 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/ilyaluk/girabot/internal/emeltls"
-	"github.com/ilyaluk/girabot/internal/giraauth"
+	"github.com/ilyaluk/girabot/gira/emeltls"
+	"github.com/ilyaluk/girabot/gira/giraauth"
 	"github.com/ilyaluk/girabot/internal/tokencrypto"
 	"github.com/ilyaluk/girabot/internal/tokenserver"
 	"gorm.io/driver/sqlite"
@@ -24,9 +24,10 @@ import (
 )
 
 var (
-	dbPath    = flag.String("db-path", "gira-tokens.db", "path to the SQLite database")
-	bind      = flag.String("bind", ":8080", "address to bind")
-	urlPrefix = flag.String("url-prefix", "", "URL prefix for the server")
+	dbPath         = flag.String("db-path", "gira-tokens.db", "path to the SQLite database")
+	bind           = flag.String("bind", ":8080", "address to bind")
+	urlPrefix      = flag.String("url-prefix", "", "URL prefix for the server")
+	userIDCacheTTL = flag.Duration("user-id-cache-ttl", 2*time.Minute, "how long verified access tokens are cached, 0 disables")
 )
 
 func main() {
@@ -46,6 +47,9 @@ func main() {
 		db:   db,
 		auth: giraauth.New(&http.Client{Transport: emeltls.Transport()}),
 	}
+	if *userIDCacheTTL > 0 {
+		s.auth = s.auth.WithUserIDCache(giraauth.NewUserIDCache(*userIDCacheTTL))
+	}
 
 	go s.cleanupTokens()
 
@@ -175,14 +179,36 @@ func (s *server) handlePostToken(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("thanks!"))
 }
 
+// authError is returned by getIntegrityToken if Gira auth API didn't verify the token.
+type authError struct {
+	code giraauth.ErrorCode
+}
+
+func (e authError) Error() string {
+	return "failed to get user ID: " + string(e.code)
+}
+
+// writeIntegrityTokenError responds with the reason getIntegrityToken failed, see tokenserver.ErrorResponse.
+func writeIntegrityTokenError(w http.ResponseWriter, err error) {
+	var authErr authError
+	switch {
+	case errors.Is(err, noTokensError):
+		tokenserver.WriteError(w, http.StatusNotFound, tokenserver.CodeNoTokens, err.Error())
+	case errors.Is(err, badTokenError):
+		tokenserver.WriteError(w, http.StatusBadRequest, tokenserver.CodeBadAuthToken, err.Error())
+	case errors.As(err, &authErr) && authErr.code == giraauth.CodeUnauthorized:
+		tokenserver.WriteError(w, http.StatusUnauthorized, tokenserver.CodeBadAuthToken, "failed to get token: "+err.Error())
+	case errors.As(err, &authErr):
+		tokenserver.WriteError(w, http.StatusBadGateway, tokenserver.CodeAuthFailed, "failed to get token: "+err.Error())
+	default:
+		tokenserver.WriteError(w, http.StatusInternalServerError, tokenserver.CodeInternal, "failed to get token: "+err.Error())
+	}
+}
+
 func (s *server) handleExchangeToken(w http.ResponseWriter, r *http.Request) {
 	token, err := s.getIntegrityToken(r)
-	if errors.Is(err, noTokensError) {
-		http.Error(w, "no tokens available", http.StatusNotFound)
-		return
-	}
 	if err != nil {
-		http.Error(w, "failed to get token: "+err.Error(), http.StatusInternalServerError)
+		writeIntegrityTokenError(w, err)
 		return
 	}
 
@@ -191,48 +217,46 @@ func (s *server) handleExchangeToken(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleExchangeTokenEncrypted(w http.ResponseWriter, r *http.Request) {
 	integrityToken, err := s.getIntegrityToken(r)
-	if errors.Is(err, noTokensError) {
-		http.Error(w, "no tokens available", http.StatusNotFound)
-		return
-	}
 	if err != nil {
-		http.Error(w, "failed to get token: "+err.Error(), http.StatusInternalServerError)
+		writeIntegrityTokenError(w, err)
 		return
 	}
 
 	// We know it's okay-ish for from getIntegrityToken
 	giraToken := r.Header.Get("x-gira-token")
 
-	enc, err := tokencrypto.Encrypt(integrityToken, giraToken)
+	// consumers which don't send tokencrypto.Header predate versioning, and get V1 format
+	v := tokencrypto.Negotiate(r.Header.Get(tokencrypto.Header))
+	enc, err := tokencrypto.EncryptVersion(v, integrityToken, giraToken)
 	if err != nil {
 		log.Printf("failed to encrypt token: %v", err)
 		http.Error(w, "failed to encrypt token", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set(tokencrypto.Header, fmt.Sprintf("v%d", v))
 	w.Write([]byte(enc))
 }
 
-var noTokensError = fmt.Errorf("no tokens available")
+var (
+	noTokensError = fmt.Errorf("no tokens available")
+	badTokenError = fmt.Errorf("bad token")
+)
 
 func (s *server) getIntegrityToken(r *http.Request) (string, error) {
 	token := r.Header.Get("x-gira-token")
 	if token == "" {
-		return "", fmt.Errorf("missing token")
+		return "", fmt.Errorf("missing token: %w", badTokenError)
 	}
 
 	// First, blindly parse auth token to get "sub". If we have a valid integrity
 	// token for this user, just return it.
 	// Access tokens are 2minutes long, calling auth api for each one is slow.
-	jwtToken, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
-	if err != nil {
-		return "", fmt.Errorf("bad token")
-	}
-
-	sub, err := jwtToken.Claims.GetSubject()
+	claims, err := giraauth.ParseClaims(token)
 	if err != nil {
-		return "", fmt.Errorf("bad token")
+		return "", badTokenError
 	}
+	sub := claims.Subject
 
 	// Add leeway to match auth token lifetime. This adds some wasted firebase
 	// tokens, but makes UX more stable for users.
@@ -250,7 +274,7 @@ func (s *server) getIntegrityToken(r *http.Request) (string, error) {
 	id, err := s.auth.UserID(r.Context(), token)
 	if err != nil {
 		log.Printf("failed to get user ID: %v", err)
-		return "", fmt.Errorf("failed to get user ID")
+		return "", authError{code: cmp.Or(giraauth.CodeOf(err), giraauth.CodeUnknown)}
 	}
 
 	err = s.db.Transaction(func(tx *gorm.DB) error {
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	tele "gopkg.in/telebot.v3"
+)
+
+var tracer = otel.Tracer("github.com/ilyaluk/girabot")
+
+// setupTracing makes spans of bot updates and Gira calls to be written as JSON lines to path.
+// It returns a function which flushes pending spans.
+func setupTracing(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %w", err)
+	}
+
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		return nil, fmt.Errorf("creating trace exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(tp)
+
+	return func() {
+		_ = tp.Shutdown(context.Background())
+		_ = f.Close()
+	}, nil
+}
+
+// spanName returns name of the span for update, without any user input.
+func spanName(c tele.Context) string {
+	switch {
+	case c.Callback() != nil:
+		return "bot.callback " + c.Callback().Unique
+	case c.PreCheckoutQuery() != nil:
+		return "bot.checkout"
+	case c.Message() == nil:
+		return "bot.update"
+	case c.Message().Location != nil:
+		return "bot.location"
+	}
+	return "bot.message"
+}
+
+// startUpdateSpan starts the root span of user interaction, Gira calls made with c become its children.
+func (c *customContext) startUpdateSpan() func() {
+	ctx, span := tracer.Start(c.ctx, spanName(c.Context))
+	span.SetAttributes(attribute.Int64("user.id", c.user.ID))
+	c.ctx = ctx
+	return func() { span.End() }
+}
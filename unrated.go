@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+const unratedMaxResults = 10
+
+func (c *customContext) handleUnratedTrips() error {
+	err, cleanup := c.sendTyping()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	trips, err := c.gira.GetUnratedTrips(c, 1, unratedMaxResults)
+	if err != nil {
+		return err
+	}
+
+	var sent int
+	for _, trip := range trips {
+		if trip.Code == c.user.CurrentTripCode && c.user.CurrentTripRateAwaiting {
+			// current trip is rated via the usual rate message
+			continue
+		}
+
+		if err := c.Send(oldTripString(trip), getTripStarButtons(trip.Code, 0)); err != nil {
+			return err
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return c.Send("No unrated trips, good job! ⭐️")
+	}
+	return nil
+}
+
+func oldTripString(trip gira.Trip) string {
+	dur := trip.EndDate.Sub(trip.StartDate).Truncate(time.Second)
+	return fmt.Sprintf(
+		"📈 Unrated trip on %s, duration %v",
+		trip.StartDate.In(lisbonTZ).Format("2006-01-02 15:04"),
+		dur,
+	)
+}
+
+// getTripStarButtons is like getStarButtons, but for rating arbitrary trip by code.
+// Selected rating is kept in the button data, as there's no per-trip state stored for old trips.
+func getTripStarButtons(code gira.TripCode, rating int) *tele.ReplyMarkup {
+	rm := &tele.ReplyMarkup{}
+	rm.Inline(
+		getStarsRow(btnKeyTypeRateOldStar, string(code)+"|", rating),
+		tele.Row{
+			{
+				Unique: btnKeyTypeRateOldSubmit,
+				Text:   "📤 Submit",
+				Data:   fmt.Sprintf("%s|%d", code, rating),
+			},
+		},
+	)
+	return rm
+}
+
+// parseTripRatingCallback parses "code|rating" callback data.
+func parseTripRatingCallback(data string) (gira.TripCode, int, error) {
+	codeStr, ratingStr, ok := strings.Cut(data, "|")
+	if !ok || codeStr == "" {
+		return "", 0, fmt.Errorf("invalid trip rating callback data: %s", data)
+	}
+	rating, err := strconv.Atoi(ratingStr)
+	if err != nil {
+		return "", 0, err
+	}
+	return gira.TripCode(codeStr), rating, nil
+}
+
+func (c *customContext) handleRateOldStar() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	code, rating, err := parseTripRatingCallback(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Edit(getTripStarButtons(code, rating)); err != nil {
+		return err
+	}
+	return c.Respond()
+}
+
+func (c *customContext) handleRateOldSubmit() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	code, rating, err := parseTripRatingCallback(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	if rating == 0 {
+		return c.Respond(&tele.CallbackResponse{Text: "Please select some stars first"})
+	}
+
+	ok, err := c.gira.RateTrip(c, code, gira.TripRating{Rating: rating})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.Respond(&tele.CallbackResponse{Text: "Can't rate trip, try again?"})
+	}
+
+	stars := strings.Repeat("⭐️", rating) + strings.Repeat("☆", 5-rating)
+	return c.Edit(c.Message().Text+"\nRated: "+stars, &tele.ReplyMarkup{})
+}
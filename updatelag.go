@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	updateLagHist = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "girabot_update_lag_seconds",
+		Help:    "Time between message being sent by user and bot starting processing it.",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 300},
+	})
+	overloadedGauge = promauto.NewGauge(prometheus.GaugeOpts{Name: "girabot_overloaded"})
+)
+
+const (
+	// updateLagThreshold is the lag after which the bot is considered backed up.
+	updateLagThreshold = 15 * time.Second
+	// updateLagAlertInterval limits how often admin is notified about the lag.
+	updateLagAlertInterval = 10 * time.Minute
+)
+
+// updateLag tracks webhook delivery lag. When lag is high, bot is marked as overloaded
+// and non-essential work (like typing indicators) is skipped.
+type updateLag struct {
+	overloaded atomic.Bool
+
+	mu        sync.Mutex
+	lastAlert time.Time
+}
+
+// observe records the lag of one update and returns whether admin should be alerted.
+func (l *updateLag) observe(lag time.Duration) (alert bool) {
+	updateLagHist.Observe(lag.Seconds())
+
+	isOverloaded := lag > updateLagThreshold
+	if l.overloaded.Swap(isOverloaded) != isOverloaded {
+		log.Printf("bot: overloaded state changed to %v, lag %v", isOverloaded, lag)
+		if isOverloaded {
+			overloadedGauge.Set(1)
+		} else {
+			overloadedGauge.Set(0)
+		}
+	}
+
+	if !isOverloaded {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastAlert) < updateLagAlertInterval {
+		return false
+	}
+	l.lastAlert = time.Now()
+	return true
+}
+
+func (s *server) updateLagMiddleware(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		// Callbacks and edits don't have own timestamp, and message date is the one of original message,
+		// so only plain messages are measured.
+		if c.Callback() == nil && c.Update().EditedMessage == nil && c.Message() != nil && c.Message().Unixtime != 0 {
+			lag := time.Since(c.Message().Time())
+			if s.updateLag.observe(lag) {
+				msg := fmt.Sprintf("webhook is backed up: update lag %v", lag.Truncate(time.Millisecond))
+				log.Println("bot:", msg)
+				// don't block the update on admin notification
+				go func() {
+					if _, err := s.bot.Send(tele.ChatID(*adminID), msg); err != nil {
+						log.Println("bot: error sending lag alert:", err)
+					}
+				}()
+			}
+		}
+		return next(c)
+	}
+}
+
+// isOverloaded returns true if the bot is lagging behind on updates and should skip non-essential work.
+func (s *server) isOverloaded() bool {
+	return s.updateLag.overloaded.Load()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"slices"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/ilyaluk/girabot/gira"
+)
+
+const (
+	maxAvoidedBikes  = 50
+	maxFavoriteBikes = 20
+)
+
+func (c *customContext) isBikeAvoided(serial gira.BikeSerial) bool {
+	_, ok := c.user.AvoidedBikes[serial]
+	return ok
+}
+
+func (c *customContext) isBikeFavorite(serial gira.BikeSerial) bool {
+	_, ok := c.user.FavoriteBikes[serial]
+	return ok
+}
+
+// dockButtonString is like Dock.ButtonString, but also flags bikes user wants to avoid or likes.
+func (c *customContext) dockButtonString(dock gira.Dock, isMax bool) string {
+	if dock.Bike != nil && c.isBikeAvoided(dock.Bike.Serial) {
+		return "🚫" + dock.ButtonString(isMax)
+	}
+	if dock.Bike != nil && c.isBikeFavorite(dock.Bike.Serial) {
+		return "💖" + dock.ButtonString(isMax)
+	}
+	return dock.ButtonString(isMax)
+}
+
+// favoriteBikesIn returns user's favorite bikes that are docked in docks.
+func (c *customContext) favoriteBikesIn(docks gira.Docks) []gira.Bike {
+	var res []gira.Bike
+	for _, d := range docks {
+		if d.Bike != nil && c.isBikeFavorite(d.Bike.Serial) {
+			res = append(res, *d.Bike)
+		}
+	}
+	return res
+}
+
+// bestElectricBike returns the best e-bike in docks, skipping bikes user wants to avoid.
+func (c *customContext) bestElectricBike(docks gira.Docks) *gira.Bike {
+	docks = slices.DeleteFunc(slices.Clone(docks), func(d gira.Dock) bool {
+		return d.Bike != nil && c.isBikeAvoided(d.Bike.Serial)
+	})
+	return docks.BestElectricBike()
+}
+
+// getBikeMarkup returns buttons for bike unlock menu.
+func (c *customContext) getBikeMarkup(bike gira.Bike) *tele.ReplyMarkup {
+	avoidBtn := tele.InlineButton{
+		Text:   "🚫 Avoid this bike",
+		Unique: btnKeyTypeAvoidBike,
+		Data:   bike.CallbackData(),
+	}
+	if c.isBikeAvoided(bike.Serial) {
+		avoidBtn.Text = "✅ Stop avoiding"
+	}
+
+	favBtn := tele.InlineButton{
+		Text:   "💖 Favorite bike",
+		Unique: btnKeyTypeFavBike,
+		Data:   bike.CallbackData(),
+	}
+	if c.isBikeFavorite(bike.Serial) {
+		favBtn.Text = "💔 Unfavorite"
+	}
+
+	return &tele.ReplyMarkup{
+		InlineKeyboard: [][]tele.InlineButton{
+			{
+				{
+					Text:   "🔓 Unlock",
+					Unique: btnKeyTypeBikeUnlock,
+					Data:   bike.CallbackData(),
+				},
+				{
+					Text:   "❌ Cancel",
+					Unique: btnKeyTypeCloseMenu,
+				},
+			},
+			{favBtn, avoidBtn},
+			{{
+				Text:   "🛠 Report problem",
+				Unique: btnKeyTypeReportBike,
+				Data:   bike.CallbackData(),
+			}},
+		},
+	}
+}
+
+func (c *customContext) handleToggleAvoidBike() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	bike, err := gira.BikeFromCallbackData(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	if c.user.AvoidedBikes == nil {
+		c.user.AvoidedBikes = map[gira.BikeSerial]string{}
+	}
+
+	var resp string
+	if c.isBikeAvoided(bike.Serial) {
+		delete(c.user.AvoidedBikes, bike.Serial)
+		resp = "Bike removed from avoid list"
+	} else {
+		if len(c.user.AvoidedBikes) >= maxAvoidedBikes {
+			return c.Respond(&tele.CallbackResponse{Text: "Too many avoided bikes"})
+		}
+		c.user.AvoidedBikes[bike.Serial] = bike.Name
+		resp = "Bike added to avoid list, I'll warn you before unlocking it"
+	}
+
+	if err := c.Edit(c.getBikeMarkup(bike)); err != nil {
+		return err
+	}
+	return c.Respond(&tele.CallbackResponse{Text: resp})
+}
+
+func (c *customContext) handleToggleFavoriteBike() error {
+	cb := c.Callback()
+	if cb == nil {
+		return c.Send("No callback")
+	}
+
+	bike, err := gira.BikeFromCallbackData(cb.Data)
+	if err != nil {
+		return err
+	}
+
+	if c.user.FavoriteBikes == nil {
+		c.user.FavoriteBikes = map[gira.BikeSerial]string{}
+	}
+
+	var resp string
+	if c.isBikeFavorite(bike.Serial) {
+		delete(c.user.FavoriteBikes, bike.Serial)
+		resp = "Bike removed from favorites"
+	} else {
+		if len(c.user.FavoriteBikes) >= maxFavoriteBikes {
+			return c.Respond(&tele.CallbackResponse{Text: "Too many favorite bikes"})
+		}
+		c.user.FavoriteBikes[bike.Serial] = bike.Name
+		resp = "Bike added to favorites, I'll highlight it in stations"
+	}
+
+	if err := c.Edit(c.getBikeMarkup(bike)); err != nil {
+		return err
+	}
+	return c.Respond(&tele.CallbackResponse{Text: resp})
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"crypto/hmac"
 	"crypto/sha256"
-	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -16,21 +15,11 @@ import (
 	"sync"
 	"time"
 
-	"golang.org/x/oauth2"
 	tele "gopkg.in/telebot.v3"
 
-	"github.com/ilyaluk/girabot/internal/emeltls"
-	"github.com/ilyaluk/girabot/internal/gira"
+	"github.com/ilyaluk/girabot/gira"
 )
 
-//go:embed webapp/index.html
-var indexHTML []byte
-
-var staticServer = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(indexHTML)
-})
-
 func (s *server) handleWebStations(w http.ResponseWriter, r *http.Request) {
 	uid, err := s.validateTgUserId(r)
 	if err != nil {
@@ -42,12 +31,7 @@ func (s *server) handleWebStations(w http.ResponseWriter, r *http.Request) {
 	var user User
 	s.db.First(&user, uid)
 
-	ts := s.getTokenSource(uid)
-	oauthC := &http.Client{Transport: &oauth2.Transport{Source: ts, Base: emeltls.Transport()}}
-	fbC := newFbTokenClient(oauthC.Transport, ts)
-	girac := gira.New(fbC)
-
-	stations, err := girac.GetStations(r.Context())
+	stations, err := s.newGiraClient(uid, gira.WithRetryPolicy(webRetryPolicy)).GetStations(r.Context())
 	if err != nil {
 		log.Printf("web GetStations: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -60,6 +44,7 @@ func (s *server) handleWebStations(w http.ResponseWriter, r *http.Request) {
 		Lng     float64 `json:"lng"`
 		Bikes   int     `json:"bikes"`
 		Docks   int     `json:"docks"`
+		Free    int     `json:"free"`
 		Status  string  `json:"status"`
 		FavName string  `json:"fav_name,omitempty"`
 	}
@@ -77,6 +62,7 @@ func (s *server) handleWebStations(w http.ResponseWriter, r *http.Request) {
 			Lng:     station.Longitude,
 			Bikes:   station.Bikes,
 			Docks:   station.Docks,
+			Free:    station.FreeDocksEstimate(),
 			Status:  status,
 			FavName: user.Favorites[station.Serial],
 		}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed webapp
+var webappEmbedFS embed.FS
+
+var webappDir = flag.String("webapp-dir", "", "serve webapp assets from this directory instead of embedded ones, "+
+	"falling back to embedded ones for missing files (for development)")
+
+// assetServer serves webapp static files.
+//
+// index.html is rendered as a template with an `asset` function, which appends
+// content hash to the asset URL. Hashed URLs are cached by clients forever,
+// while index.html itself is always revalidated.
+type assetServer struct {
+	fsys fs.FS
+	// live is set when serving from a directory, files are re-read on each request
+	// so that frontend changes are visible without rebuilding the binary.
+	live bool
+
+	mu     sync.Mutex
+	assets map[string]*asset
+}
+
+type asset struct {
+	content []byte
+	hash    string
+}
+
+// newAssetServer returns asset server for dir, or for embedded files if dir is empty.
+func newAssetServer(dir string) *assetServer {
+	a := &assetServer{
+		assets: map[string]*asset{},
+	}
+
+	sub, err := fs.Sub(webappEmbedFS, "webapp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.fsys = sub
+
+	if dir != "" {
+		a.fsys = fallbackFS{primary: os.DirFS(dir), fallback: sub}
+		a.live = true
+	}
+
+	// fail early on broken index template
+	if _, err := a.load("index.html"); err != nil {
+		log.Fatalf("webapp: loading index.html: %v", err)
+	}
+
+	return a
+}
+
+// fallbackFS serves files from primary, and from fallback if they are missing in primary.
+type fallbackFS struct {
+	primary, fallback fs.FS
+}
+
+func (f fallbackFS) Open(name string) (fs.File, error) {
+	file, err := f.primary.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f.fallback.Open(name)
+	}
+	return file, err
+}
+
+func (a *assetServer) load(name string) (*asset, error) {
+	if !a.live {
+		a.mu.Lock()
+		as, ok := a.assets[name]
+		a.mu.Unlock()
+		if ok {
+			return as, nil
+		}
+	}
+
+	content, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "index.html" {
+		content, err = a.renderIndex(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha256.Sum256(content)
+	as := &asset{
+		content: content,
+		hash:    hex.EncodeToString(sum[:8]),
+	}
+
+	if !a.live {
+		a.mu.Lock()
+		a.assets[name] = as
+		a.mu.Unlock()
+	}
+
+	return as, nil
+}
+
+func (a *assetServer) renderIndex(content []byte) ([]byte, error) {
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		"asset": func(name string) (string, error) {
+			as, err := a.load(name)
+			if err != nil {
+				return "", err
+			}
+			// relative URL, as webapp is served under url prefix
+			return name + "?v=" + as.hash, nil
+		},
+	}).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *assetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	as, err := a.load(name)
+	if errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "" {
+		// webapp might be opened via any path, serve index for everything that doesn't look like a file
+		name = "index.html"
+		as, err = a.load(name)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("webapp: loading %s: %v", name, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case a.live || name == "index.html":
+		w.Header().Set("Cache-Control", "no-cache")
+	case r.URL.Query().Get("v") == as.hash:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		// stale or missing hash, let client revalidate via ETag
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+as.hash+`"`)
+
+	// ServeContent handles If-None-Match and sets Content-Type based on extension
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(as.content))
+}